@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// BitFieldOp is one subcommand of BITFIELD, operating on a signed or
+// unsigned integer of Bits bits starting at bit Offset
+type BitFieldOp struct {
+	Op     string // "GET", "SET" or "INCRBY"
+	Signed bool
+	Bits   int
+	Offset int
+	// Value is the value to SET or the increment of INCRBY
+	Value int64
+	// Overflow is the overflow policy of SET and INCRBY: "WRAP", "SAT" or
+	// "FAIL"
+	Overflow string
+}
+
+// readField returns the bits-wide field at offset of buf as an unsigned
+// integer, bits past the end of buf reading as 0
+func readField(buf []byte, offset, bits int) uint64 {
+	var v uint64
+	for i := offset; i < offset+bits; i++ {
+		v <<= 1
+		if i/8 < len(buf) {
+			v |= uint64(buf[i/8]>>(7-i%8)) & 1
+		}
+	}
+	return v
+}
+
+// writeField stores the low bits of v at offset of buf, which must be long
+// enough
+func writeField(buf []byte, offset, bits int, v uint64) {
+	for i := offset + bits - 1; i >= offset; i-- {
+		mask := byte(0x80) >> (i % 8)
+		if v&1 != 0 {
+			buf[i/8] |= mask
+		} else {
+			buf[i/8] &^= mask
+		}
+		v >>= 1
+	}
+}
+
+// fieldValue interprets the raw bits of a field as a signed or unsigned
+// integer
+func fieldValue(raw uint64, bits int, signed bool) int64 {
+	if signed && bits < 64 && raw&(1<<(bits-1)) != 0 {
+		// sign-extend
+		raw |= ^uint64(0) << bits
+	}
+	return int64(raw)
+}
+
+// fitField applies the overflow policy to v for a field of the given type.
+// It returns the value that fits, or false when the FAIL policy rejects it.
+func fitField(v *big.Int, bits int, signed bool, overflow string) (int64, bool) {
+	lo, hi := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if signed {
+		lo.Neg(new(big.Int).Rsh(hi, 1))
+		hi.Rsh(hi, 1)
+	}
+	hi.Sub(hi, big.NewInt(1))
+	if v.Cmp(lo) >= 0 && v.Cmp(hi) <= 0 {
+		return v.Int64(), true
+	}
+	switch overflow {
+	case "SAT":
+		if v.Cmp(lo) < 0 {
+			return lo.Int64(), true
+		}
+		return hi.Int64(), true
+	case "FAIL":
+		return 0, false
+	default: // WRAP
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits)), big.NewInt(1))
+		raw := new(big.Int).And(v, mask).Uint64()
+		return fieldValue(raw, bits, signed), true
+	}
+}
+
+// BitField: run ops on the integer fields of the string stored at key. Each
+// element of the result is the int64 value of its op (the old value for SET,
+// the new one for INCRBY), or nil when the FAIL overflow policy skipped it.
+func (k *Kv) BitField(key string, ops []BitFieldOp) ([]interface{}, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return nil, err
+	}
+	cur, _ := k.getLocked(key)
+	buf := []byte(cur)
+	written := false
+	out := make([]interface{}, 0, len(ops))
+	for _, op := range ops {
+		old := fieldValue(readField(buf, op.Offset, op.Bits), op.Bits, op.Signed)
+		if op.Op == "GET" {
+			out = append(out, old)
+			continue
+		}
+		v := big.NewInt(op.Value)
+		if op.Op == "INCRBY" {
+			v.Add(v, big.NewInt(old))
+		}
+		val, ok := fitField(v, op.Bits, op.Signed, op.Overflow)
+		if !ok {
+			out = append(out, nil)
+			continue
+		}
+		if need := (op.Offset + op.Bits + 7) / 8; need > len(buf) {
+			buf = append(buf, make([]byte, need-len(buf))...)
+		}
+		writeField(buf, op.Offset, op.Bits, uint64(val))
+		written = true
+		if op.Op == "SET" {
+			out = append(out, old)
+		} else {
+			out = append(out, val)
+		}
+	}
+	if written {
+		k.data[key] = string(buf)
+	}
+	return out, nil
+}
+
+// BitFieldGetOp is a GET subcommand of BITFIELD_RO
+type BitFieldGetOp struct {
+	Signed bool
+	Bits   int
+	Offset int
+}
+
+// BitFieldRO: read the integer fields described by ops from the string
+// stored at key
+func (k *Kv) BitFieldRO(key string, ops []BitFieldGetOp) ([]int64, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return nil, err
+	}
+	cur, _ := k.getLocked(key)
+	buf := []byte(cur)
+	out := make([]int64, len(ops))
+	for i, op := range ops {
+		out[i] = fieldValue(readField(buf, op.Offset, op.Bits), op.Bits, op.Signed)
+	}
+	return out, nil
+}
+
+// parseBitFieldType parses a field type such as i16 or u8. Unsigned fields
+// are limited to 63 bits so their values fit an int64.
+func parseBitFieldType(s string) (signed bool, bits int, err error) {
+	errType := errors.New("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	if len(s) < 2 || (s[0] != 'i' && s[0] != 'I' && s[0] != 'u' && s[0] != 'U') {
+		return false, 0, errType
+	}
+	signed = s[0] == 'i' || s[0] == 'I'
+	bits, err = strconv.Atoi(s[1:])
+	if err != nil || bits < 1 || (signed && bits > 64) || (!signed && bits > 63) {
+		return false, 0, errType
+	}
+	return signed, bits, nil
+}
+
+// parseBitFieldOffset parses a field offset, either in bits or, when
+// prefixed with '#', in multiples of the field width
+func parseBitFieldOffset(s string, bits int) (int, error) {
+	mul := 1
+	if strings.HasPrefix(s, "#") {
+		mul, s = bits, s[1:]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > maxBitOffset/mul || n*mul+bits-1 > maxBitOffset {
+		return 0, errors.New("bit offset is not an integer or out of range")
+	}
+	return n * mul, nil
+}
+
+// parseBitFieldOps parses the subcommands of BITFIELD
+func parseBitFieldOps(args []string) ([]BitFieldOp, error) {
+	var ops []BitFieldOp
+	overflow := "WRAP"
+	for i := 0; i < len(args); i++ {
+		sub := strings.ToUpper(args[i])
+		switch sub {
+		case "OVERFLOW":
+			if i+1 >= len(args) {
+				return nil, errors.New("syntax error")
+			}
+			overflow = strings.ToUpper(args[i+1])
+			if overflow != "WRAP" && overflow != "SAT" && overflow != "FAIL" {
+				return nil, errors.New("Invalid OVERFLOW type specified")
+			}
+			i++
+		case "GET", "SET", "INCRBY":
+			nargs := 3
+			if sub == "GET" {
+				nargs = 2
+			}
+			if i+nargs >= len(args) {
+				return nil, errors.New("syntax error")
+			}
+			op := BitFieldOp{Op: sub, Overflow: overflow}
+			var err error
+			if op.Signed, op.Bits, err = parseBitFieldType(args[i+1]); err != nil {
+				return nil, err
+			}
+			if op.Offset, err = parseBitFieldOffset(args[i+2], op.Bits); err != nil {
+				return nil, err
+			}
+			if sub != "GET" {
+				if op.Value, err = strconv.ParseInt(args[i+3], 10, 64); err != nil {
+					return nil, errors.New("value is not an integer or out of range")
+				}
+			}
+			ops = append(ops, op)
+			i += nargs
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	return ops, nil
+}
+
+// parseBitFieldGetOps parses the subcommands of BITFIELD_RO, which may only
+// be GET
+func parseBitFieldGetOps(args []string) ([]BitFieldGetOp, error) {
+	var ops []BitFieldGetOp
+	for i := 0; i < len(args); i += 3 {
+		if !strings.EqualFold(args[i], "GET") {
+			return nil, errors.New("BITFIELD_RO only supports the GET subcommand")
+		}
+		if i+2 >= len(args) {
+			return nil, errors.New("syntax error")
+		}
+		var op BitFieldGetOp
+		var err error
+		if op.Signed, op.Bits, err = parseBitFieldType(args[i+1]); err != nil {
+			return nil, err
+		}
+		if op.Offset, err = parseBitFieldOffset(args[i+2], op.Bits); err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// Handlers for bitfield commands
+
+func bitfield(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("BITFIELD requires at least one argument")
+	}
+	ops, err := parseBitFieldOps(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	vals, err := kv.BitField(args[0], ops)
+	if err != nil {
+		return nil, err
+	}
+	respArray := make(Array, len(vals))
+	for i, v := range vals {
+		if v != nil {
+			respArray[i] = integer(v.(int64))
+		}
+	}
+	return respArray, nil
+}
+
+func bitfieldRO(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("BITFIELD_RO requires at least one argument")
+	}
+	ops, err := parseBitFieldGetOps(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	vals, err := kv.BitFieldRO(args[0], ops)
+	if err != nil {
+		return nil, err
+	}
+	respArray := make(Array, len(vals))
+	for i, v := range vals {
+		respArray[i] = integer(v)
+	}
+	return respArray, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// bitfieldInts runs BITFIELD and converts its reply, nil becoming -999
+func bitfieldInts(t *testing.T, kv *Kv, args ...string) []int64 {
+	t.Helper()
+	resp, err := bitfield(args, kv)
+	if err != nil {
+		t.Fatalf("BITFIELD %v error: %v", args, err)
+	}
+	var out []int64
+	for _, v := range resp.(Array) {
+		if v == nil {
+			out = append(out, -999)
+		} else {
+			out = append(out, int64(v.(integer)))
+		}
+	}
+	return out
+}
+
+func equalInts(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBitFieldGetSet(t *testing.T) {
+	kv := NewKv()
+	got := bitfieldInts(t, kv, "k", "SET", "u8", "0", "255", "GET", "u8", "0", "GET", "i8", "0")
+	if !equalInts(got, []int64{0, 255, -1}) {
+		t.Fatalf("BITFIELD SET/GET = %v", got)
+	}
+	// unaligned fields spanning bytes, '#' offsets counting in field widths
+	got = bitfieldInts(t, kv, "k", "SET", "i5", "#2", "-3", "GET", "i5", "10", "GET", "u5", "10", "GET", "u4", "4")
+	if !equalInts(got, []int64{0, -3, 29, 15}) {
+		t.Fatalf("BITFIELD unaligned = %v", got)
+	}
+	if val, _, _ := kv.Get("k"); val != "\xff\x3a" {
+		t.Fatalf("k = %q, want \\xff\\x3a", val)
+	}
+	got = bitfieldInts(t, kv, "w", "SET", "i64", "0", "-1", "GET", "u63", "1", "GET", "i64", "0")
+	if !equalInts(got, []int64{0, math.MaxInt64, -1}) {
+		t.Fatalf("BITFIELD 64-bit = %v", got)
+	}
+	// reading a missing key does not create it
+	bitfieldInts(t, kv, "missing", "GET", "u8", "100")
+	if kv.Exists([]string{"missing"}) != 0 {
+		t.Fatalf("expected GET not to create the key")
+	}
+}
+
+func TestBitFieldOverflow(t *testing.T) {
+	kv := NewKv()
+	tests := []struct {
+		args []string
+		want []int64
+	}{
+		{[]string{"INCRBY", "u2", "100", "1", "INCRBY", "u2", "100", "3"}, []int64{1, 0}},
+		{[]string{"INCRBY", "i8", "0", "127", "INCRBY", "i8", "0", "1"}, []int64{127, -128}},
+		{[]string{"OVERFLOW", "SAT", "INCRBY", "i8", "0", "-1000", "INCRBY", "u4", "200", "20"}, []int64{-128, 15}},
+		{[]string{"OVERFLOW", "SAT", "SET", "i8", "0", "1000", "GET", "i8", "0"}, []int64{-128, 127}},
+		{[]string{"OVERFLOW", "FAIL", "INCRBY", "i8", "0", "1", "GET", "i8", "0"}, []int64{-999, 127}},
+		{[]string{"OVERFLOW", "FAIL", "SET", "u4", "300", "16", "SET", "u4", "300", "15"}, []int64{-999, 0}},
+		{[]string{"OVERFLOW", "WRAP", "SET", "u4", "400", "17", "GET", "u4", "400"}, []int64{0, 1}},
+		{[]string{"OVERFLOW", "SAT", "INCRBY", "i64", "500", "9223372036854775807", "INCRBY", "i64", "500", "1"}, []int64{math.MaxInt64, math.MaxInt64}},
+		{[]string{"INCRBY", "i64", "600", "-9223372036854775808", "INCRBY", "i64", "600", "-1"}, []int64{math.MinInt64, math.MaxInt64}},
+	}
+	for _, tt := range tests {
+		if got := bitfieldInts(t, kv, append([]string{"k"}, tt.args...)...); !equalInts(got, tt.want) {
+			t.Fatalf("BITFIELD %v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestBitFieldErrors(t *testing.T) {
+	kv := NewKv()
+	for _, args := range [][]string{
+		{"k", "GET", "u64", "0"},
+		{"k", "GET", "i65", "0"},
+		{"k", "GET", "x8", "0"},
+		{"k", "GET", "u8", "-1"},
+		{"k", "SET", "u8", "0"},
+		{"k", "OVERFLOW", "CLAMP"},
+		{"k", "INCR", "u8", "0", "1"},
+	} {
+		if _, err := bitfield(args, kv); err == nil {
+			t.Fatalf("expected error for BITFIELD %v", args)
+		}
+	}
+}
+
+func TestBitFieldRO(t *testing.T) {
+	kv := NewKv()
+	kv.Set("k", "\xff\x3a")
+	vals, err := kv.BitFieldRO("k", []BitFieldGetOp{{Bits: 8}, {Signed: true, Bits: 5, Offset: 10}})
+	if err != nil || !equalInts(vals, []int64{255, -3}) {
+		t.Fatalf("BitFieldRO = %v, %v; want [255 -3]", vals, err)
+	}
+	resp, err := bitfieldRO([]string{"k", "GET", "u4", "#1", "get", "i8", "8"}, kv)
+	if err != nil {
+		t.Fatalf("BITFIELD_RO error: %v", err)
+	}
+	if arr := resp.(Array); len(arr) != 2 || arr[0] != integer(15) || arr[1] != integer(0x3a) {
+		t.Fatalf("BITFIELD_RO reply = %v", arr)
+	}
+	for _, args := range [][]string{
+		{"k", "SET", "u8", "0", "1"},
+		{"k", "GET", "u8", "0", "INCRBY", "u8", "0", "1"},
+		{"k", "OVERFLOW", "SAT", "GET", "u8", "0"},
+		{"k", "GET", "u8"},
+	} {
+		if _, err := bitfieldRO(args, kv); err == nil {
+			t.Fatalf("expected error for BITFIELD_RO %v", args)
+		}
+	}
+	if val, _, _ := kv.Get("k"); val != "\xff\x3a" {
+		t.Fatalf("expected BITFIELD_RO not to change the string, got %q", val)
+	}
+}
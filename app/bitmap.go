@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// bitmap operations. Bitmaps are plain strings, bit 0 being the most
+// significant bit of the first byte.
+
+// maxBitOffset is the largest bit offset accepted, keeping strings under 512MB
+const maxBitOffset = 1<<32 - 1
+
+// SetBit: set the bit at offset in the string stored at key to val, growing
+// the string with zero bytes as needed. Returns the previous bit.
+func (k *Kv) SetBit(key string, offset int, val int) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return 0, err
+	}
+	cur, _ := k.getLocked(key)
+	buf := []byte(cur)
+	if need := offset/8 + 1; need > len(buf) {
+		buf = append(buf, make([]byte, need-len(buf))...)
+	}
+	mask := byte(0x80) >> (offset % 8)
+	old := 0
+	if buf[offset/8]&mask != 0 {
+		old = 1
+	}
+	if val == 1 {
+		buf[offset/8] |= mask
+	} else {
+		buf[offset/8] &^= mask
+	}
+	k.data[key] = string(buf)
+	return old, nil
+}
+
+// GetBit: get the bit at offset in the string stored at key, 0 past its end
+func (k *Kv) GetBit(key string, offset int) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return 0, err
+	}
+	cur, _ := k.getLocked(key)
+	if offset/8 >= len(cur) {
+		return 0, nil
+	}
+	return int(cur[offset/8]>>(7-offset%8)) & 1, nil
+}
+
+// popcount holds the number of set bits of every byte value
+var popcount = func() (t [256]uint8) {
+	for i := range t {
+		t[i] = t[i/2] + uint8(i&1)
+	}
+	return t
+}()
+
+// BitCount: count the set bits of the string stored at key between start
+// and end (inclusive, negative offsets counting from the end), which are byte
+// offsets when unit is "BYTE" and bit offsets when it is "BIT"
+func (k *Kv) BitCount(key string, start, end int, unit string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return 0, err
+	}
+	cur, _ := k.getLocked(key)
+	if unit != "BIT" {
+		start, end, ok := clampRange(len(cur), start, end)
+		if !ok {
+			return 0, nil
+		}
+		n := 0
+		for i := start; i <= end; i++ {
+			n += int(popcount[cur[i]])
+		}
+		return n, nil
+	}
+	start, end, ok := clampRange(len(cur)*8, start, end)
+	if !ok {
+		return 0, nil
+	}
+	n := 0
+	for i := start; i <= end; {
+		if i%8 == 0 && i+7 <= end {
+			// whole byte
+			n += int(popcount[cur[i/8]])
+			i += 8
+			continue
+		}
+		n += int(cur[i/8]>>(7-i%8)) & 1
+		i++
+	}
+	return n, nil
+}
+
+// BitOp: store in dst the bitwise AND, OR, XOR or NOT (of a single key) of
+// the strings stored at keys, shorter strings being padded with zero bytes.
+// Returns the length of the result, dst being deleted when it is empty.
+func (k *Kv) BitOp(op, dst string, keys []string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	srcs := make([]string, len(keys))
+	maxLen := 0
+	for i, key := range keys {
+		if err := k.checkType(key, "string"); err != nil {
+			return 0, err
+		}
+		srcs[i], _ = k.getLocked(key)
+		maxLen = max(maxLen, len(srcs[i]))
+	}
+	res := make([]byte, maxLen)
+	for i := range res {
+		var b byte
+		for j, src := range srcs {
+			var c byte
+			if i < len(src) {
+				c = src[i]
+			}
+			switch {
+			case op == "NOT":
+				b = ^c
+			case j == 0:
+				b = c
+			case op == "AND":
+				b &= c
+			case op == "OR":
+				b |= c
+			case op == "XOR":
+				b ^= c
+			}
+		}
+		res[i] = b
+	}
+	if len(res) == 0 {
+		k.deleteLocked(dst)
+		return 0, nil
+	}
+	k.setLocked(dst, string(res))
+	return len(res), nil
+}
+
+// parseBitOffset parses a bit offset argument
+func parseBitOffset(s string) (int, error) {
+	offset, err := strconv.Atoi(s)
+	if err != nil || offset < 0 || offset > maxBitOffset {
+		return 0, errors.New("bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// Handlers for bitmap commands
+
+func setbit(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("SETBIT requires exactly three arguments")
+	}
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if args[2] != "0" && args[2] != "1" {
+		return nil, errors.New("bit is not an integer or out of range")
+	}
+	old, err := kv.SetBit(args[0], offset, int(args[2][0]-'0'))
+	if err != nil {
+		return nil, err
+	}
+	return integer(old), nil
+}
+
+func getbit(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("GETBIT requires exactly two arguments")
+	}
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return nil, err
+	}
+	bit, err := kv.GetBit(args[0], offset)
+	if err != nil {
+		return nil, err
+	}
+	return integer(bit), nil
+}
+
+func bitcount(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 && len(args) != 3 && len(args) != 4 {
+		return nil, errors.New("syntax error")
+	}
+	start, end, unit := 0, -1, "BYTE"
+	if len(args) > 1 {
+		var err1, err2 error
+		start, err1 = strconv.Atoi(args[1])
+		end, err2 = strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("value is not an integer or out of range")
+		}
+	}
+	if len(args) == 4 {
+		unit = strings.ToUpper(args[3])
+		if unit != "BYTE" && unit != "BIT" {
+			return nil, errors.New("syntax error")
+		}
+	}
+	n, err := kv.BitCount(args[0], start, end, unit)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func bitop(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("BITOP requires at least three arguments")
+	}
+	op := strings.ToUpper(args[0])
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(args) != 3 {
+			return nil, errors.New("BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return nil, errors.New("syntax error")
+	}
+	n, err := kv.BitOp(op, args[1], args[2:])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
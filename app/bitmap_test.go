@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+func TestSetBitGetBit(t *testing.T) {
+	kv := NewKv()
+	if old, err := kv.SetBit("b", 7, 1); err != nil || old != 0 {
+		t.Fatalf("SetBit = %d, %v; want 0", old, err)
+	}
+	if val, _, _ := kv.Get("b"); val != "\x01" {
+		t.Fatalf("b = %q, want \\x01", val)
+	}
+	// growing the string zero-pads it
+	kv.SetBit("b", 17, 1)
+	if val, _, _ := kv.Get("b"); val != "\x01\x00\x40" {
+		t.Fatalf("b = %q, want \\x01\\x00\\x40", val)
+	}
+	if old, _ := kv.SetBit("b", 7, 0); old != 1 {
+		t.Fatalf("SetBit returned old bit %d, want 1", old)
+	}
+	for offset, want := range map[int]int{7: 0, 17: 1, 16: 0, 1000: 0} {
+		if bit, _ := kv.GetBit("b", offset); bit != want {
+			t.Fatalf("GetBit(%d) = %d, want %d", offset, bit, want)
+		}
+	}
+	kv.Set("s", "a") // 0b01100001
+	if resp, _ := getbit([]string{"s", "1"}, kv); resp != integer(1) {
+		t.Fatalf("GETBIT s 1 = %v, want 1", resp)
+	}
+	for _, args := range [][]string{{"b", "-1", "1"}, {"b", "4294967296", "1"}, {"b", "0", "2"}} {
+		if _, err := setbit(args, kv); err == nil {
+			t.Fatalf("expected error for SETBIT %v", args)
+		}
+	}
+}
+
+func TestBitCount(t *testing.T) {
+	kv := NewKv()
+	kv.Set("k", "foobar")
+	tests := []struct {
+		args []string
+		want integer
+	}{
+		{[]string{"k"}, 26},
+		{[]string{"k", "0", "0"}, 4},
+		{[]string{"k", "1", "1"}, 6},
+		{[]string{"k", "-2", "-1", "BYTE"}, 7},
+		{[]string{"k", "5", "30", "BIT"}, 17},
+		{[]string{"k", "0", "-1", "bit"}, 26},
+		{[]string{"k", "3", "1"}, 0},
+		{[]string{"missing"}, 0},
+	}
+	for _, tt := range tests {
+		resp, err := bitcount(tt.args, kv)
+		if err != nil || resp != tt.want {
+			t.Fatalf("BITCOUNT %v = %v, %v; want %d", tt.args, resp, err, tt.want)
+		}
+	}
+	// counting is per byte of the UTF-8 encoding
+	kv.Set("utf8", "é") // 0xc3 0xa9
+	if n, _ := kv.BitCount("utf8", 0, -1, "BYTE"); n != 8 {
+		t.Fatalf("BitCount of UTF-8 string = %d, want 8", n)
+	}
+	if n, _ := kv.BitCount("utf8", 1, 1, "BYTE"); n != 4 {
+		t.Fatalf("BitCount of second byte = %d, want 4", n)
+	}
+	if _, err := bitcount([]string{"k", "0"}, kv); err == nil {
+		t.Fatalf("expected syntax error for a single range argument")
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	kv := NewKv()
+	kv.Set("a", "\xff\x0f\xaa")
+	kv.Set("b", "\x3c")
+	// the shorter key is zero-padded
+	if n, err := kv.BitOp("AND", "and", []string{"a", "b"}); err != nil || n != 3 {
+		t.Fatalf("BitOp AND = %d, %v; want 3", n, err)
+	}
+	if val, _, _ := kv.Get("and"); val != "\x3c\x00\x00" {
+		t.Fatalf("and = %q", val)
+	}
+	kv.BitOp("OR", "or", []string{"a", "b", "missing"})
+	if val, _, _ := kv.Get("or"); val != "\xff\x0f\xaa" {
+		t.Fatalf("or = %q", val)
+	}
+	kv.BitOp("XOR", "xor", []string{"a", "b"})
+	if val, _, _ := kv.Get("xor"); val != "\xc3\x0f\xaa" {
+		t.Fatalf("xor = %q", val)
+	}
+	kv.Set("bytes", "\x00\x81\xfe")
+	if resp, _ := bitop([]string{"NOT", "not", "bytes"}, kv); resp != integer(3) {
+		t.Fatalf("BITOP NOT = %v, want 3", resp)
+	}
+	if val, _, _ := kv.Get("not"); val != "\xff\x7e\x01" {
+		t.Fatalf("not = %q", val)
+	}
+	if _, err := bitop([]string{"NOT", "not", "a", "b"}, kv); err == nil {
+		t.Fatalf("expected error for NOT with two keys")
+	}
+	if n, _ := kv.BitOp("AND", "and", []string{"missing"}); n != 0 || kv.Exists([]string{"and"}) != 0 {
+		t.Fatalf("expected an empty result to delete the destination")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// waiter is a client blocked on one or more keys. Whenever one of its keys
+// receives new data, or stops existing, try is called with k.mu held; when
+// it can be satisfied, or returns an error the client must be failed with,
+// the reply is delivered on ch and the waiter is removed from all its keys.
+type waiter struct {
+	keys []string
+	try  func(key string) (RespValue, bool, error)
+	ch   chan blockedReply // buffered so serving never blocks the writer
+}
+
+// blockedReply is the outcome of a blocked command
+type blockedReply struct {
+	resp RespValue
+	err  error
+}
+
+// blockingCommands are the commands whose run time includes the time spent
+// blocked, which SLOWLOG and LATENCY do not count
+var blockingCommands = map[string]bool{
+	"BLPOP":      true,
+	"BRPOP":      true,
+	"BLMPOP":     true,
+	"BZMPOP":     true,
+	"WAIT":       true,
+	"XREAD":      true,
+	"XREADGROUP": true,
+}
+
+// wake serves the clients blocked on key in FIFO order for as long as they
+// can be satisfied. Callers must hold k.mu.
+func (k *Kv) wake(key string) {
+	for i := 0; i < len(k.waiters[key]); {
+		w := k.waiters[key][i]
+		resp, ok, err := w.try(key)
+		if !ok && err == nil {
+			i++
+			continue
+		}
+		k.removeWaiter(w)
+		w.ch <- blockedReply{resp, err}
+	}
+}
+
+// removeWaiter unregisters w from every key it is blocked on.
+// Callers must hold k.mu.
+func (k *Kv) removeWaiter(w *waiter) {
+	for _, key := range w.keys {
+		waiters := k.waiters[key]
+		for i, other := range waiters {
+			if other == w {
+				waiters = append(waiters[:i:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(k.waiters, key)
+		} else {
+			k.waiters[key] = waiters
+		}
+	}
+}
+
+// BlockedClients: count the clients blocked on keys of the database
+func (k *Kv) BlockedClients() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	blocked := map[*waiter]bool{}
+	for _, waiters := range k.waiters {
+		for _, w := range waiters {
+			blocked[w] = true
+		}
+	}
+	return len(blocked)
+}
+
+// block tries to serve keys (all expected to hold typ) with try, in order.
+// When none of them can be served it waits until one receives data, or try
+// fails, or the timeout elapses, in which case it returns nil. A zero
+// timeout blocks forever.
+func (k *Kv) block(keys []string, typ string, timeout time.Duration, try func(key string) (RespValue, bool, error)) (RespValue, error) {
+	k.mu.Lock()
+	for _, key := range keys {
+		if err := k.checkType(key, typ); err != nil {
+			k.mu.Unlock()
+			return nil, err
+		}
+	}
+	for _, key := range keys {
+		if resp, ok, err := try(key); ok || err != nil {
+			k.mu.Unlock()
+			return resp, err
+		}
+	}
+	w := &waiter{keys: keys, try: try, ch: make(chan blockedReply, 1)}
+	for _, key := range keys {
+		k.waiters[key] = append(k.waiters[key], w)
+	}
+	k.mu.Unlock()
+
+	if timeout == 0 {
+		r := <-w.ch
+		return r.resp, r.err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-w.ch:
+		return r.resp, r.err
+	case <-timer.C:
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// the waiter may have been served right as the timer fired
+	select {
+	case r := <-w.ch:
+		return r.resp, r.err
+	default:
+	}
+	k.removeWaiter(w)
+	return nil, nil
+}
+
+// parseTimeout parses a blocking command timeout given in seconds
+func parseTimeout(s string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.New("timeout is not a float or out of range")
+	}
+	if secs < 0 {
+		return 0, errors.New("timeout is negative")
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// waitBlocked waits until n clients are blocked on key.
+func waitBlocked(t *testing.T, kv *Kv, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		kv.mu.Lock()
+		got := len(kv.waiters[key])
+		kv.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d clients blocked on %q", n, key)
+}
+
+func TestBLPopImmediate(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("second", "x", "y")
+	resp, err := blpop([]string{"first", "second", "0"}, kv)
+	if err != nil {
+		t.Fatalf("BLPOP error: %v", err)
+	}
+	arr, ok := resp.(Array)
+	if !ok || len(arr) != 2 || arr[0] != BulkString("second") || arr[1] != BulkString("x") {
+		t.Fatalf("unexpected BLPOP reply %v", resp)
+	}
+	resp, _ = brpop([]string{"second", "0"}, kv)
+	if arr, ok := resp.(Array); !ok || arr[1] != BulkString("y") {
+		t.Fatalf("unexpected BRPOP reply %v", resp)
+	}
+}
+
+func TestBLPopBlocksUntilPush(t *testing.T) {
+	kv := NewKv()
+	done := make(chan RespValue, 2)
+	go func() {
+		resp, _ := blpop([]string{"a", "b", "0"}, kv)
+		done <- resp
+	}()
+	waitBlocked(t, kv, "b", 1)
+	go func() {
+		resp, _ := blpop([]string{"b", "0"}, kv)
+		done <- resp
+	}()
+	waitBlocked(t, kv, "b", 2)
+
+	if n := kv.RPush("b", "v1"); n != 1 {
+		t.Fatalf("expected RPUSH to report length 1, got %d", n)
+	}
+	// the longest-waiting client is served first
+	resp := <-done
+	arr, ok := resp.(Array)
+	if !ok || arr[0] != BulkString("b") || arr[1] != BulkString("v1") {
+		t.Fatalf("unexpected BLPOP reply %v", resp)
+	}
+	kv.mu.Lock()
+	remaining := len(kv.waiters["b"])
+	_, stillOnA := kv.waiters["a"]
+	kv.mu.Unlock()
+	if remaining != 1 || stillOnA {
+		t.Fatalf("served client should be removed from all keys")
+	}
+
+	kv.LPush("b", "v2")
+	if resp := <-done; resp.(Array)[1] != BulkString("v2") {
+		t.Fatalf("unexpected BLPOP reply %v", resp)
+	}
+}
+
+func TestBLPopTimeout(t *testing.T) {
+	kv := NewKv()
+	resp, err := brpop([]string{"empty", "0.05"}, kv)
+	if err != nil || resp != nil {
+		t.Fatalf("expected nil reply on timeout, got %v (%v)", resp, err)
+	}
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if len(kv.waiters) != 0 {
+		t.Fatalf("expected waiter to be removed after timeout")
+	}
+}
+
+func TestBLMPop(t *testing.T) {
+	kv := NewKv()
+	done := make(chan RespValue, 1)
+	go func() {
+		resp, _ := blmpop([]string{"0", "2", "a", "b", "LEFT", "COUNT", "2"}, kv)
+		done <- resp
+	}()
+	waitBlocked(t, kv, "b", 1)
+	kv.RPush("b", "x", "y", "z")
+	resp := (<-done).(Array)
+	vals := resp[1].(Array)
+	if resp[0] != BulkString("b") || len(vals) != 2 || vals[0] != BulkString("x") || vals[1] != BulkString("y") {
+		t.Fatalf("unexpected BLMPOP reply %v", resp)
+	}
+	if n, _ := kv.LLen("b"); n != 1 {
+		t.Fatalf("expected one element left, got %d", n)
+	}
+}
+
+func TestBZMPop(t *testing.T) {
+	kv := NewKv()
+	done := make(chan RespValue, 1)
+	go func() {
+		resp, _ := bzmpop([]string{"0", "1", "z", "MIN"}, kv)
+		done <- resp
+	}()
+	waitBlocked(t, kv, "z", 1)
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{2, "b"}, zsetEntry{1, "a"})
+	resp := (<-done).(Array)
+	pair := resp[1].(Array)[0].(Array)
+	if resp[0] != BulkString("z") || pair[0] != BulkString("a") {
+		t.Fatalf("unexpected BZMPOP reply %v", resp)
+	}
+	if n, _ := kv.ZCard("z"); n != 1 {
+		t.Fatalf("expected one member left, got %d", n)
+	}
+	if resp, _ := bzmpop([]string{"0.01", "1", "empty", "MAX"}, kv); resp != nil {
+		t.Fatalf("expected nil reply on timeout, got %v", resp)
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the server settings. The fields below mu can be changed at
+// runtime with CONFIG SET, so they are read and written with mu held.
+type Config struct {
+	mu sync.RWMutex
+	// users is the ACL table, keyed by user name. It always holds the
+	// default user, which AUTH with a single argument authenticates as.
+	users map[string]User
+	// file is the config file loaded at startup, which CONFIG REWRITE
+	// writes back to
+	file string
+
+	requirepass          string
+	maxmemory            int64
+	hz                   int
+	loglevel             string
+	notifyKeyspaceEvents string
+	// slowlogThreshold is the run time above which commands are added to
+	// the slow log, which is disabled when it is negative
+	slowlogThreshold time.Duration
+	slowlogMaxLen    int
+	// latencyMonitorThreshold is the latency from which events are sampled by
+	// the latency monitor, which is disabled when it is zero
+	latencyMonitorThreshold time.Duration
+}
+
+const defaultUser = "default"
+
+// constructor function for Config. The default user may run every command
+// and requires password, or no password at all when it is empty.
+func newConfig(password string) *Config {
+	return &Config{
+		users:            map[string]User{defaultUser: newDefaultUser(password)},
+		requirepass:      password,
+		hz:               10,
+		loglevel:         "notice",
+		slowlogThreshold: 10 * time.Millisecond,
+		slowlogMaxLen:    128,
+	}
+}
+
+// user looks up the user name in the ACL table
+func (cfg *Config) user(name string) (User, bool) {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	u, ok := cfg.users[name]
+	return u, ok
+}
+
+// expireInterval is the time between two runs of the expiry sweeper, hz
+// times a second
+func (cfg *Config) expireInterval() time.Duration {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return time.Second / time.Duration(cfg.hz)
+}
+
+// slowlogSettings returns the slow log threshold and maximum length
+func (cfg *Config) slowlogSettings() (time.Duration, int) {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.slowlogThreshold, cfg.slowlogMaxLen
+}
+
+// maxMemory returns the maxmemory in bytes, 0 meaning no limit
+func (cfg *Config) maxMemory() int64 {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.maxmemory
+}
+
+// latencyThreshold returns the latency-monitor-threshold
+func (cfg *Config) latencyThreshold() time.Duration {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.latencyMonitorThreshold
+}
+
+// configParam is a parameter of CONFIG GET and CONFIG SET. get and set are
+// called with the Config's mu held.
+type configParam struct {
+	name string
+	get  func(cfg *Config) string
+	set  func(cfg *Config, value string) error
+	// immutable parameters can only be set in the config file
+	immutable bool
+}
+
+var configParams = []configParam{
+	{
+		name: "requirepass",
+		get:  func(cfg *Config) string { return cfg.requirepass },
+		set: func(cfg *Config, value string) error {
+			cfg.requirepass = value
+			cfg.users[defaultUser] = newDefaultUser(value)
+			return nil
+		},
+	},
+	{
+		name: "maxmemory",
+		get:  func(cfg *Config) string { return strconv.FormatInt(cfg.maxmemory, 10) },
+		set: func(cfg *Config, value string) error {
+			n, err := parseMemory(value)
+			if err != nil {
+				return err
+			}
+			cfg.maxmemory = n
+			return nil
+		},
+	},
+	{
+		name: "hz",
+		get:  func(cfg *Config) string { return strconv.Itoa(cfg.hz) },
+		set: func(cfg *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			if n < 1 || n > 500 {
+				return errors.New("argument must be between 1 and 500 inclusive")
+			}
+			cfg.hz = n
+			return nil
+		},
+	},
+	{
+		name: "loglevel",
+		get:  func(cfg *Config) string { return cfg.loglevel },
+		set: func(cfg *Config, value string) error {
+			switch value = strings.ToLower(value); value {
+			case "debug", "verbose", "notice", "warning", "nothing":
+				cfg.loglevel = value
+				return nil
+			}
+			return errors.New("argument(s) must be one of the following: debug, verbose, notice, warning, nothing")
+		},
+	},
+	{
+		name: "databases",
+		get:  func(cfg *Config) string { return strconv.Itoa(numDBs) },
+		set: func(cfg *Config, value string) error {
+			if value != strconv.Itoa(numDBs) {
+				return fmt.Errorf("only %d databases are supported", numDBs)
+			}
+			return nil
+		},
+		immutable: true,
+	},
+	{
+		name: "slowlog-log-slower-than",
+		get:  func(cfg *Config) string { return strconv.FormatInt(cfg.slowlogThreshold.Microseconds(), 10) },
+		set: func(cfg *Config, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			cfg.slowlogThreshold = time.Duration(n) * time.Microsecond
+			return nil
+		},
+	},
+	{
+		name: "slowlog-max-len",
+		get:  func(cfg *Config) string { return strconv.Itoa(cfg.slowlogMaxLen) },
+		set: func(cfg *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			if n < 0 || n > math.MaxInt32 {
+				return errors.New("argument must be between 0 and 2147483647 inclusive")
+			}
+			cfg.slowlogMaxLen = n
+			return nil
+		},
+	},
+	{
+		name: "latency-monitor-threshold",
+		get:  func(cfg *Config) string { return strconv.FormatInt(cfg.latencyMonitorThreshold.Milliseconds(), 10) },
+		set: func(cfg *Config, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			if n < 0 {
+				return errors.New("argument must be between 0 and 9223372036854775807 inclusive")
+			}
+			cfg.latencyMonitorThreshold = time.Duration(n) * time.Millisecond
+			return nil
+		},
+	},
+	{
+		name: "notify-keyspace-events",
+		get:  func(cfg *Config) string { return cfg.notifyKeyspaceEvents },
+		set: func(cfg *Config, value string) error {
+			if strings.Trim(value, "KEg$lshzxetmdnA") != "" {
+				return errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+			}
+			cfg.notifyKeyspaceEvents = value
+			return nil
+		},
+	},
+}
+
+// lookupConfigParam finds the parameter name, case-insensitively
+func lookupConfigParam(name string) (*configParam, bool) {
+	name = strings.ToLower(name)
+	for i := range configParams {
+		if configParams[i].name == name {
+			return &configParams[i], true
+		}
+	}
+	return nil, false
+}
+
+// parseMemory parses a memory size, in bytes or with a k, kb, m, mb, g or
+// gb unit
+func parseMemory(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+	s = strings.ToLower(s)
+	mul := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mul = strings.TrimSuffix(s, u.suffix), u.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/mul {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * mul, nil
+}
+
+// Get: get the parameters matching any of the glob-style patterns, as
+// alternating names and values
+func (cfg *Config) Get(patterns []string) []string {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	var out []string
+	for _, p := range configParams {
+		for _, pattern := range patterns {
+			if globMatch(strings.ToLower(pattern), p.name) {
+				out = append(out, p.name, p.get(cfg))
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Set: set the parameters given as alternating names and values. Either
+// every parameter is set or, when one of them fails, none is.
+func (cfg *Config) Set(nameValues []string) error {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	params := make([]*configParam, 0, len(nameValues)/2)
+	seen := map[string]bool{}
+	for i := 0; i < len(nameValues); i += 2 {
+		p, ok := lookupConfigParam(nameValues[i])
+		if !ok {
+			return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", nameValues[i])
+		}
+		if seen[p.name] {
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - duplicate parameter", nameValues[i])
+		}
+		if p.immutable {
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", nameValues[i])
+		}
+		seen[p.name] = true
+		params = append(params, p)
+	}
+	old := make([]string, len(params))
+	for i, p := range params {
+		old[i] = p.get(cfg)
+		if err := p.set(cfg, nameValues[2*i+1]); err != nil {
+			// roll back the parameters already set
+			for j := i - 1; j >= 0; j-- {
+				params[j].set(cfg, old[j])
+			}
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %v", nameValues[2*i], err)
+		}
+	}
+	return nil
+}
+
+// parseConfigLine splits a config file line into its directive and value,
+// returning an empty name for blank lines and comments
+func parseConfigLine(line string) (name, value string, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", nil
+	}
+	name, value, _ = strings.Cut(line, " ")
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, `"`) {
+		if value, err = strconv.Unquote(value); err != nil {
+			return "", "", fmt.Errorf("invalid quoted value in %q", line)
+		}
+	}
+	return strings.ToLower(name), value, nil
+}
+
+// formatConfigLine formats a config file line setting name to value
+func formatConfigLine(name, value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"#") {
+		value = strconv.Quote(value)
+	}
+	return name + " " + value
+}
+
+// LoadFile: set the parameters of the config file path, and remember it for
+// CONFIG REWRITE
+func (cfg *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		name, value, err := parseConfigLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		if name == "" {
+			continue
+		}
+		p, ok := lookupConfigParam(name)
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown directive '%s'", path, n, name)
+		}
+		if err := p.set(cfg, value); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	cfg.file = path
+	return nil
+}
+
+// Rewrite: write the current parameters back to the config file. Lines
+// setting a parameter are updated in place, other lines are kept, and the
+// parameters missing from the file are appended.
+func (cfg *Config) Rewrite() error {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	if cfg.file == "" {
+		return errors.New("The server is running without a config file")
+	}
+	data, err := os.ReadFile(cfg.file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var lines []string
+	written := map[string]bool{}
+	var existing []string
+	if len(data) > 0 {
+		existing = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+	for _, line := range existing {
+		name, _, err := parseConfigLine(line)
+		p, ok := lookupConfigParam(name)
+		if err != nil || !ok {
+			lines = append(lines, line)
+			continue
+		}
+		// drop repeated directives, the last of which won when loading
+		if !written[p.name] {
+			lines = append(lines, formatConfigLine(p.name, p.get(cfg)))
+			written[p.name] = true
+		}
+	}
+	for _, p := range configParams {
+		if !written[p.name] {
+			lines = append(lines, formatConfigLine(p.name, p.get(cfg)))
+		}
+	}
+
+	// write to a temporary file first so a failed rewrite leaves the
+	// config file intact
+	tmp, err := os.CreateTemp(filepath.Dir(cfg.file), ".config-rewrite-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// temporary files are created private, keep the mode of the config file
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(cfg.file); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cfg.file)
+}
+
+var configHelp = []string{
+	"CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"GET <pattern>",
+	"    Return parameters matching the glob-like <pattern> and their values.",
+	"SET <directive> <value>",
+	"    Set the configuration <directive> to <value>.",
+	"RESETSTAT",
+	"    Reset statistics reported by the INFO command.",
+	"REWRITE",
+	"    Rewrite the configuration file.",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handlers for config commands
+
+func config(args []string, c *client) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("CONFIG requires a subcommand")
+	}
+	switch sub := strings.ToUpper(args[0]); sub {
+	case "HELP", "RESETSTAT", "REWRITE":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("CONFIG %s takes no arguments", sub)
+		}
+		switch sub {
+		case "HELP":
+			return bulkArray(configHelp), nil
+		case "RESETSTAT":
+			c.srv.ResetStats()
+		case "REWRITE":
+			if err := c.cfg.Rewrite(); err != nil {
+				return nil, err
+			}
+		}
+		return SimpleString("OK"), nil
+	case "GET":
+		if len(args) < 2 {
+			return nil, errors.New("wrong number of arguments for 'config|get' command")
+		}
+		return Map(bulkArray(c.cfg.Get(args[1:]))), nil
+	case "SET":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return nil, errors.New("wrong number of arguments for 'config|set' command")
+		}
+		if err := c.cfg.Set(args[1:]); err != nil {
+			return nil, err
+		}
+		return SimpleString("OK"), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try CONFIG HELP.", args[0])
+	}
+}
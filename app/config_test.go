@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigGet(t *testing.T) {
+	c := newClient(NewServer(newConfig("")))
+	resp, err := config([]string{"GET", "hz", "SLOWLOG-LOG-*"}, c)
+	if err != nil {
+		t.Fatalf("CONFIG GET: %v", err)
+	}
+	want := Map{BulkString("hz"), BulkString("10"), BulkString("slowlog-log-slower-than"), BulkString("10000")}
+	if got, ok := resp.(Map); !ok || len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Fatalf("CONFIG GET = %v, want %v", resp, want)
+	}
+	// a parameter matched by several patterns is returned once
+	if got := c.cfg.Get([]string{"*", "hz"}); len(got) != 2*len(configParams) {
+		t.Fatalf("Get(*) = %v, want every parameter", got)
+	}
+	if got := c.cfg.Get([]string{"nosuchparam"}); len(got) != 0 {
+		t.Fatalf("Get(nosuchparam) = %v, want none", got)
+	}
+	if _, err := config([]string{"GET"}, c); err == nil {
+		t.Fatalf("CONFIG GET without a pattern succeeded")
+	}
+}
+
+func TestConfigSet(t *testing.T) {
+	cfg := newConfig("")
+	c := newClient(NewServer(cfg))
+	if resp, err := config([]string{"SET", "maxmemory", "2mb", "LOGLEVEL", "Warning"}, c); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("CONFIG SET = %v, %v; want OK", resp, err)
+	}
+	if got := cfg.Get([]string{"maxmemory", "loglevel"}); !equalStrings(got, []string{"maxmemory", "2097152", "loglevel", "warning"}) {
+		t.Fatalf("after CONFIG SET: %v", got)
+	}
+
+	// a failing parameter leaves the others unchanged
+	for _, args := range [][]string{
+		{"hz", "100", "hz", "20"},
+		{"hz", "100", "maxmemory", "lots"},
+		{"hz", "100", "nosuchparam", "1"},
+		{"hz", "0"},
+		{"hz", "100", "databases", "16"},
+		{"notify-keyspace-events", "Kx!"},
+		{"slowlog-max-len", "2147483648"},
+		{"maxmemory", "9999999999gb"},
+	} {
+		if err := cfg.Set(args); err == nil {
+			t.Fatalf("CONFIG SET %v succeeded", args)
+		}
+	}
+	if got := cfg.Get([]string{"hz", "maxmemory", "notify-keyspace-events"}); !equalStrings(got, []string{"maxmemory", "2097152", "hz", "10", "notify-keyspace-events", ""}) {
+		t.Fatalf("after failed CONFIG SETs: %v", got)
+	}
+	if _, err := config([]string{"SET", "hz"}, c); err == nil {
+		t.Fatalf("CONFIG SET without a value succeeded")
+	}
+
+	// setting requirepass makes new connections authenticate
+	if err := cfg.Set([]string{"requirepass", "secret"}); err != nil {
+		t.Fatalf("CONFIG SET requirepass: %v", err)
+	}
+	other := newClient(c.srv)
+	if _, err := other.execute([]string{"PING"}); err != errNoAuth {
+		t.Fatalf("PING on a new connection: err = %v, want %v", err, errNoAuth)
+	}
+	if _, err := other.execute([]string{"AUTH", "secret"}); err != nil {
+		t.Fatalf("AUTH with the new password: %v", err)
+	}
+}
+
+func TestConfigResetStat(t *testing.T) {
+	c := newClient(NewServer(newConfig("")))
+	c.kv().Get("missing")
+	c.srv.stats.totalCommands.Add(3)
+	if resp, err := config([]string{"RESETSTAT"}, c); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("CONFIG RESETSTAT = %v, %v; want OK", resp, err)
+	}
+	fields := infoFields(c.srv.Info("stats"))
+	if fields["keyspace_misses"] != "0" || fields["total_commands_processed"] != "0" {
+		t.Fatalf("INFO stats after RESETSTAT: %v", fields)
+	}
+}
+
+func TestConfigRewrite(t *testing.T) {
+	c := newClient(NewServer(newConfig("")))
+	if _, err := config([]string{"REWRITE"}, c); err == nil {
+		t.Fatalf("CONFIG REWRITE without a config file succeeded")
+	}
+
+	path := filepath.Join(t.TempDir(), "redis.conf")
+	conf := "# test config\nhz 20\n\nloglevel verbose\nhz 30\nnotify-keyspace-events \"\"\n"
+	if err := os.WriteFile(path, []byte(conf), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.cfg.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if got := c.cfg.Get([]string{"hz", "loglevel"}); !equalStrings(got, []string{"hz", "30", "loglevel", "verbose"}) {
+		t.Fatalf("after LoadFile: %v", got)
+	}
+
+	c.cfg.Set([]string{"hz", "50", "requirepass", "two words"})
+	if resp, err := config([]string{"REWRITE"}, c); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("CONFIG REWRITE = %v, %v; want OK", resp, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	want := []string{"# test config", "hz 50", "", "loglevel verbose", `notify-keyspace-events ""`}
+	if !equalStrings(lines[:len(want)], want) {
+		t.Fatalf("rewritten config starts with %q, want %q", lines[:len(want)], want)
+	}
+	if !strings.Contains(string(data), "\nrequirepass \"two words\"\n") {
+		t.Fatalf("rewritten config has no requirepass line:\n%s", data)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o640 {
+		t.Fatalf("rewritten config mode = %v, want %v", mode, os.FileMode(0o640))
+	}
+
+	// the rewritten file loads back to the same parameters
+	loaded := newConfig("")
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile of rewritten config: %v", err)
+	}
+	if got, want := loaded.Get([]string{"*"}), c.cfg.Get([]string{"*"}); !equalStrings(got, want) {
+		t.Fatalf("reloaded config = %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("nosuchdirective 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newConfig("").LoadFile(path); err == nil {
+		t.Fatalf("LoadFile with an unknown directive succeeded")
+	}
+}
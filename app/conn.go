@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// newDefaultUser returns the default user with password, which may run
+// every command
+func newDefaultUser(password string) User {
+	u := newUser(defaultUser, password)
+	u.nopass = password == ""
+	return u
+}
+
+// newUser returns the user name, allowed to run commands, or every command
+// when none are given
+func newUser(name, password string, commands ...string) User {
+	u := User{name: name, passwordHash: sha256.Sum256([]byte(password))}
+	if len(commands) > 0 {
+		u.commands = map[string]bool{}
+		for _, cmd := range commands {
+			u.commands[strings.ToUpper(cmd)] = true
+		}
+	}
+	return u
+}
+
+// addUser adds the user name to the ACL table, allowed to run commands,
+// or every command when none are given
+func (cfg *Config) addUser(name, password string, commands ...string) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.users[name] = newUser(name, password, commands...)
+}
+
+// parseUser adds a user given as name:password[:cmd,cmd...]
+func (cfg *Config) parseUser(s string) error {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return errors.New("user must be name:password[:cmd,cmd...]")
+	}
+	var commands []string
+	if len(parts) == 3 && parts[2] != "" {
+		commands = strings.Split(parts[2], ",")
+	}
+	cfg.addUser(parts[0], parts[1], commands...)
+	return nil
+}
+
+// User is an entry of the ACL table
+type User struct {
+	name         string
+	passwordHash [sha256.Size]byte
+	// nopass users authenticate with any password, and connections start
+	// out authenticated when the default user is nopass
+	nopass bool
+	// commands the user may run, nil means all of them
+	commands map[string]bool
+}
+
+// checkPassword reports whether password is the user's password
+func (u *User) checkPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	hash := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(hash[:], u.passwordHash[:]) == 1
+}
+
+// allowed reports whether the user may run cmd
+func (u *User) allowed(cmd string) bool {
+	return u.commands == nil || u.commands[cmd]
+}
+
+// client holds the state of a client connection
+type client struct {
+	id  int64
+	srv *Server
+	cfg *Config
+	// addr is the address the client connected from
+	addr string
+	// db is the index of the SELECTed database
+	db int
+	// user is the authenticated user, nil until AUTH succeeds
+	user *User
+	// name is set with HELLO SETNAME
+	name string
+	// respVersion is the protocol version negotiated with HELLO
+	respVersion int
+}
+
+// lastClientID is the id of the most recently connected client
+var lastClientID atomic.Int64
+
+// constructor function for client
+func newClient(srv *Server) *client {
+	cfg := srv.cfg
+	c := &client{
+		id:          lastClientID.Add(1),
+		srv:         srv,
+		cfg:         cfg,
+		respVersion: 2,
+	}
+	if u, _ := cfg.user(defaultUser); u.nopass {
+		c.user = &u
+	}
+	return c
+}
+
+// kv returns the SELECTed database
+func (c *client) kv() *Kv {
+	return c.srv.dbs[c.db]
+}
+
+// ConnHandler is a handler for commands that act on the connection itself,
+// or on other databases than the SELECTed one
+type ConnHandler func(args []string, c *client) (RespValue, error)
+
+var connHandlers = map[string]ConnHandler{
+	"AUTH":     auth,
+	"HELLO":    hello,
+	"QUIT":     quit,
+	"SELECT":   selectCmd,
+	"CONFIG":   config,
+	"COPY":     copyCmd,
+	"MOVE":     move,
+	"FLUSHALL": flushall,
+	"INFO":     info,
+	"SLOWLOG":  slowlog,
+	"LATENCY":  latency,
+	"MEMORY":   memory,
+}
+
+// commands that clients may run before authenticating
+var noAuthCommands = map[string]bool{
+	"AUTH":  true,
+	"HELLO": true,
+	"QUIT":  true,
+}
+
+var (
+	errNoAuth    = respErr("NOAUTH Authentication required")
+	errNoPerm    = respErr("NOPERM")
+	errWrongPass = respErr("WRONGPASS")
+)
+
+// errQuit is returned along with the reply by commands after which the
+// connection must be closed
+var errQuit = errors.New("quit")
+
+// execute runs the command args on behalf of c
+func (c *client) execute(args []string) (RespValue, error) {
+	cmd := strings.ToUpper(args[0])
+	if !noAuthCommands[cmd] {
+		if c.user == nil {
+			return nil, errNoAuth
+		}
+		if !c.user.allowed(cmd) {
+			return nil, errNoPerm
+		}
+	}
+	if handler, ok := connHandlers[cmd]; ok {
+		return handler(args[1:], c)
+	}
+	handler, ok := handlers[cmd]
+	if !ok {
+		return nil, errors.New("unknown command")
+	}
+	return handler(args[1:], c.kv())
+}
+
+// Handlers for connection commands
+
+func auth(args []string, c *client) (RespValue, error) {
+	switch len(args) {
+	case 1:
+		if u, _ := c.cfg.user(defaultUser); u.nopass {
+			return nil, errors.New("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		}
+		return c.authenticate(defaultUser, args[0])
+	case 2:
+		return c.authenticate(args[0], args[1])
+	default:
+		return nil, errors.New("AUTH requires one or two arguments")
+	}
+}
+
+// authenticate logs c in as the user name
+func (c *client) authenticate(name, password string) (RespValue, error) {
+	u, ok := c.cfg.user(name)
+	if !ok || !u.checkPassword(password) {
+		return nil, errWrongPass
+	}
+	c.user = &u
+	return SimpleString("OK"), nil
+}
+
+const (
+	serverName    = "redis"
+	serverVersion = "7.2.0"
+)
+
+func hello(args []string, c *client) (RespValue, error) {
+	proto := c.respVersion
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, errors.New("Protocol version is not an integer or out of range")
+		}
+		if v != 2 && v != 3 {
+			return nil, respErr("NOPROTO unsupported protocol version")
+		}
+		proto = v
+	}
+	var user, password, name string
+	var auth, setName bool
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "AUTH" && i+2 < len(args):
+			user, password, auth = args[i+1], args[i+2], true
+			i += 2
+		case opt == "SETNAME" && i+1 < len(args):
+			name, setName = args[i+1], true
+			i++
+		default:
+			return nil, fmt.Errorf("Syntax error in HELLO option '%s'", args[i])
+		}
+	}
+	if setName && strings.ContainsAny(name, " \n") {
+		return nil, errors.New("Client names cannot contain spaces, newlines or special characters.")
+	}
+
+	if auth {
+		if _, err := c.authenticate(user, password); err != nil {
+			return nil, err
+		}
+	}
+	if c.user == nil {
+		return nil, respErr("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	if setName {
+		c.name = name
+	}
+	c.respVersion = proto
+	return Map{
+		BulkString("server"), BulkString(serverName),
+		BulkString("version"), BulkString(serverVersion),
+		BulkString("proto"), integer(proto),
+		BulkString("id"), integer(c.id),
+		BulkString("mode"), BulkString("standalone"),
+		BulkString("role"), BulkString("master"),
+		BulkString("modules"), Array{},
+	}, nil
+}
+
+func quit(args []string, c *client) (RespValue, error) {
+	return SimpleString("OK"), errQuit
+}
+
+func selectCmd(args []string, c *client) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("SELECT requires exactly one argument")
+	}
+	db, err := parseDB(args[0])
+	if err != nil {
+		return nil, err
+	}
+	c.db = db
+	return SimpleString("OK"), nil
+}
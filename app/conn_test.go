@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthRequired(t *testing.T) {
+	c := newClient(NewServer(newConfig("secret")))
+	for _, args := range [][]string{{"PING"}, {"SET", "k", "v"}, {"get", "k"}} {
+		if _, err := c.execute(args); err != errNoAuth {
+			t.Fatalf("%v before AUTH: err = %v, want %v", args, err, errNoAuth)
+		}
+	}
+	if _, ok, _ := c.kv().Get("k"); ok {
+		t.Fatalf("SET ran before AUTH")
+	}
+
+	_, err := c.execute([]string{"AUTH", "wrong"})
+	var re respErr
+	if !errors.As(err, &re) || re != "WRONGPASS" {
+		t.Fatalf("AUTH wrong = %v, want WRONGPASS", err)
+	}
+	if c.user != nil {
+		t.Fatalf("authenticated after wrong password")
+	}
+
+	resp, err := c.execute([]string{"auth", "secret"})
+	if err != nil || resp != SimpleString("OK") {
+		t.Fatalf("AUTH = %v, %v, want OK", resp, err)
+	}
+	if _, err := c.execute([]string{"SET", "k", "v"}); err != nil {
+		t.Fatalf("SET after AUTH: %v", err)
+	}
+	resp, err = c.execute([]string{"GET", "k"})
+	if err != nil || resp != BulkString("v") {
+		t.Fatalf("GET after AUTH = %v, %v, want v", resp, err)
+	}
+}
+
+func TestAuthNoPassword(t *testing.T) {
+	c := newClient(NewServer(newConfig("")))
+	if resp, err := c.execute([]string{"PING"}); err != nil || resp != SimpleString("PONG") {
+		t.Fatalf("PING = %v, %v, want PONG", resp, err)
+	}
+	if _, err := c.execute([]string{"AUTH", "secret"}); err == nil {
+		t.Fatalf("AUTH without a configured password succeeded")
+	}
+	if _, err := c.execute([]string{"AUTH"}); err == nil {
+		t.Fatalf("AUTH without arguments succeeded")
+	}
+}
+
+func TestHandleClientAuth(t *testing.T) {
+	server, conn := net.Pipe()
+	defer conn.Close()
+	go handleClient(server, NewServer(newConfig("secret")))
+	r := bufio.NewReader(conn)
+
+	send := func(cmd, want string) {
+		t.Helper()
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatalf("write %q: %v", cmd, err)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read reply to %q: %v", cmd, err)
+		}
+		if line != want {
+			t.Fatalf("reply to %q = %q, want %q", cmd, line, want)
+		}
+	}
+	send("*1\r\n$4\r\nPING\r\n", "-NOAUTH Authentication required\r\n")
+	send("*2\r\n$4\r\nAUTH\r\n$3\r\nbad\r\n", "-WRONGPASS\r\n")
+	send("*2\r\n$4\r\nAUTH\r\n$6\r\nsecret\r\n", "+OK\r\n")
+	send("*1\r\n$4\r\nPING\r\n", "+PONG\r\n")
+}
+
+func TestRedactArgs(t *testing.T) {
+	for _, tc := range []struct{ args, want []string }{
+		{[]string{"SET", "k", "v"}, []string{"SET", "k", "v"}},
+		{[]string{"auth", "secret"}, []string{"auth", "(redacted)"}},
+		{[]string{"AUTH", "bob", "builder"}, []string{"AUTH", "(redacted)", "(redacted)"}},
+		{[]string{"HELLO", "3", "SETNAME", "w", "auth", "bob", "builder"}, []string{"HELLO", "3", "SETNAME", "w", "auth", "(redacted)", "(redacted)"}},
+		{[]string{"HELLO", "3", "AUTH", "bob"}, []string{"HELLO", "3", "AUTH", "(redacted)"}},
+	} {
+		if got := redactArgs(tc.args); !equalStrings(got, tc.want) {
+			t.Fatalf("redactArgs(%q) = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	// the command itself is left untouched
+	args := []string{"AUTH", "secret"}
+	redactArgs(args)
+	if args[1] != "secret" {
+		t.Fatalf("redactArgs modified its argument")
+	}
+}
+
+func TestAuthACL(t *testing.T) {
+	cfg := newConfig("secret")
+	cfg.addUser("alice", "wonderland", "get", "ping")
+	if err := cfg.parseUser("bob:builder:SET,GET"); err != nil {
+		t.Fatalf("parseUser: %v", err)
+	}
+	if err := cfg.parseUser("nobody"); err == nil {
+		t.Fatalf("parseUser without password succeeded")
+	}
+	srv := NewServer(cfg)
+
+	bob := newClient(srv)
+	for _, args := range [][]string{{"AUTH", "bob", "wrong"}, {"AUTH", "carol", "builder"}, {"AUTH", "builder"}} {
+		if _, err := bob.execute(args); err != errWrongPass {
+			t.Fatalf("%v: err = %v, want %v", args, err, errWrongPass)
+		}
+	}
+	if resp, err := bob.execute([]string{"AUTH", "bob", "builder"}); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("AUTH bob = %v, %v, want OK", resp, err)
+	}
+	if _, err := bob.execute([]string{"SET", "k", "v"}); err != nil {
+		t.Fatalf("SET as bob: %v", err)
+	}
+	if _, err := bob.execute([]string{"PING"}); err != errNoPerm {
+		t.Fatalf("PING as bob: err = %v, want %v", err, errNoPerm)
+	}
+
+	alice := newClient(srv)
+	if _, err := alice.execute([]string{"AUTH", "alice", "wonderland"}); err != nil {
+		t.Fatalf("AUTH alice: %v", err)
+	}
+	if resp, err := alice.execute([]string{"GET", "k"}); err != nil || resp != BulkString("v") {
+		t.Fatalf("GET as alice = %v, %v, want v", resp, err)
+	}
+	if _, err := alice.execute([]string{"SET", "k", "w"}); err != errNoPerm {
+		t.Fatalf("SET as alice: err = %v, want %v", err, errNoPerm)
+	}
+
+	// switching back to the default user lifts the restrictions
+	if _, err := alice.execute([]string{"AUTH", "default", "secret"}); err != nil {
+		t.Fatalf("AUTH default: %v", err)
+	}
+	if _, err := alice.execute([]string{"SET", "k", "w"}); err != nil {
+		t.Fatalf("SET as default: %v", err)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	server, conn := net.Pipe()
+	defer conn.Close()
+	done := make(chan struct{})
+	go func() {
+		handleClient(server, NewServer(newConfig("secret")))
+		close(done)
+	}()
+
+	// QUIT works without authenticating
+	if _, err := conn.Write([]byte("*1\r\n$4\r\nQUIT\r\n")); err != nil {
+		t.Fatalf("write QUIT: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || line != "+OK\r\n" {
+		t.Fatalf("reply to QUIT = %q, %v, want +OK", line, err)
+	}
+	if _, err := r.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Fatalf("read after QUIT: err = %v, want EOF", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("handleClient did not return after QUIT")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	c := newClient(srv)
+	if _, err := c.execute([]string{"SET", "k", "zero"}); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	if resp, err := c.execute([]string{"SELECT", "1"}); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("SELECT 1 = %v, %v; want OK", resp, err)
+	}
+	if resp, _ := c.execute([]string{"GET", "k"}); resp != nil {
+		t.Fatalf("GET in DB 1 = %v, want nil", resp)
+	}
+	c.execute([]string{"SET", "k", "one"})
+
+	// other connections start out in DB 0
+	other := newClient(srv)
+	if resp, _ := other.execute([]string{"GET", "k"}); resp != BulkString("zero") {
+		t.Fatalf("GET in DB 0 = %v, want zero", resp)
+	}
+	c.execute([]string{"SELECT", "0"})
+	if resp, _ := c.execute([]string{"GET", "k"}); resp != BulkString("zero") {
+		t.Fatalf("GET after SELECT 0 = %v, want zero", resp)
+	}
+
+	for _, arg := range []string{"16", "-1"} {
+		if _, err := c.execute([]string{"SELECT", arg}); err != errDBRange {
+			t.Fatalf("SELECT %s: err = %v, want %v", arg, err, errDBRange)
+		}
+	}
+	if _, err := c.execute([]string{"SELECT", "x"}); err == nil {
+		t.Fatalf("SELECT x succeeded")
+	}
+	if c.db != 0 {
+		t.Fatalf("db = %d after failed SELECTs, want 0", c.db)
+	}
+}
+
+func TestWriteRespVersions(t *testing.T) {
+	tests := []struct {
+		val          RespValue
+		resp2, resp3 string
+	}{
+		{nil, "$-1\r\n", "_\r\n"},
+		{Map{BulkString("a"), integer(1)}, "*2\r\n$1\r\na\r\n:1\r\n", "%1\r\n$1\r\na\r\n:1\r\n"},
+		{Boolean(true), ":1\r\n", "#t\r\n"},
+		{Boolean(false), ":0\r\n", "#f\r\n"},
+		{Double(3.14), "$4\r\n3.14\r\n", ",3.14\r\n"},
+		{Double(math.Inf(-1)), "$4\r\n-inf\r\n", ",-inf\r\n"},
+		{Array{Double(1.5), nil}, "*2\r\n$3\r\n1.5\r\n$-1\r\n", "*2\r\n,1.5\r\n_\r\n"},
+	}
+	for _, tt := range tests {
+		for proto, want := range map[int]string{2: tt.resp2, 3: tt.resp3} {
+			var sb strings.Builder
+			w := bufio.NewWriter(&sb)
+			if err := writeResp(w, tt.val, proto); err != nil {
+				t.Fatalf("writeResp(%v, %d): %v", tt.val, proto, err)
+			}
+			w.Flush()
+			if sb.String() != want {
+				t.Fatalf("writeResp(%v, %d) = %q, want %q", tt.val, proto, sb.String(), want)
+			}
+		}
+	}
+}
+
+func TestHello(t *testing.T) {
+	cfg := newConfig("secret")
+	c := newClient(NewServer(cfg))
+
+	if _, err := c.execute([]string{"HELLO", "3"}); err == nil || !strings.HasPrefix(err.Error(), "NOAUTH") {
+		t.Fatalf("HELLO 3 before AUTH: err = %v, want NOAUTH", err)
+	}
+	if _, err := c.execute([]string{"HELLO", "3", "AUTH", "default", "wrong"}); err != errWrongPass {
+		t.Fatalf("HELLO AUTH wrong: err = %v, want %v", err, errWrongPass)
+	}
+	if c.respVersion != 2 {
+		t.Fatalf("respVersion = %d after failed HELLO, want 2", c.respVersion)
+	}
+	if _, err := c.execute([]string{"HELLO", "4"}); err != respErr("NOPROTO unsupported protocol version") {
+		t.Fatalf("HELLO 4: err = %v, want NOPROTO", err)
+	}
+
+	resp, err := c.execute([]string{"HELLO", "3", "AUTH", "default", "secret", "SETNAME", "conn1"})
+	if err != nil {
+		t.Fatalf("HELLO 3 AUTH: %v", err)
+	}
+	info, ok := resp.(Map)
+	if !ok {
+		t.Fatalf("HELLO reply = %T, want Map", resp)
+	}
+	fields := map[string]RespValue{}
+	for i := 0; i+1 < len(info); i += 2 {
+		fields[string(info[i].(BulkString))] = info[i+1]
+	}
+	if fields["proto"] != integer(3) || fields["id"] != integer(c.id) || fields["server"] != BulkString("redis") {
+		t.Fatalf("HELLO reply = %v", info)
+	}
+	if c.respVersion != 3 || c.name != "conn1" || c.user == nil {
+		t.Fatalf("after HELLO: respVersion %d, name %q, user %v", c.respVersion, c.name, c.user)
+	}
+
+	// without arguments HELLO keeps the negotiated version
+	resp, _ = c.execute([]string{"HELLO"})
+	if info := resp.(Map); info[5] != integer(3) {
+		t.Fatalf("HELLO proto = %v, want 3", info[5])
+	}
+	if _, err := c.execute([]string{"HELLO", "2", "SETNAME"}); err == nil {
+		t.Fatalf("HELLO with SETNAME and no name succeeded")
+	}
+}
+
+func TestHandleClientResp3(t *testing.T) {
+	server, conn := net.Pipe()
+	defer conn.Close()
+	go handleClient(server, NewServer(newConfig("")))
+	r := bufio.NewReader(conn)
+
+	send := func(cmd string, want ...string) {
+		t.Helper()
+		if _, err := conn.Write([]byte(cmd)); err != nil {
+			t.Fatalf("write %q: %v", cmd, err)
+		}
+		for _, w := range want {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read reply to %q: %v", cmd, err)
+			}
+			if line != w {
+				t.Fatalf("reply to %q = %q, want %q", cmd, line, w)
+			}
+		}
+	}
+	send("*4\r\n$4\r\nHSET\r\n$1\r\nh\r\n$1\r\nf\r\n$1\r\nv\r\n", ":1\r\n")
+	send("*2\r\n$7\r\nHGETALL\r\n$1\r\nh\r\n", "*2\r\n", "$1\r\n", "f\r\n", "$1\r\n", "v\r\n")
+	send("*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n", "%7\r\n")
+	// skip the server info up to the empty modules array that ends it
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read HELLO reply: %v", err)
+		}
+		if line == "*0\r\n" {
+			break
+		}
+	}
+	send("*2\r\n$7\r\nHGETALL\r\n$1\r\nh\r\n", "%1\r\n", "$1\r\n", "f\r\n", "$1\r\n", "v\r\n")
+	send("*4\r\n$4\r\nZADD\r\n$1\r\nz\r\n$3\r\n1.5\r\n$1\r\nm\r\n", ":1\r\n")
+	send("*3\r\n$6\r\nZSCORE\r\n$1\r\nz\r\n$1\r\nm\r\n", ",1.5\r\n")
+	send("*2\r\n$3\r\nGET\r\n$1\r\nx\r\n", "_\r\n")
+}
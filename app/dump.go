@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DUMP payloads are laid out like Redis ones: a type tag, the encoded value,
+// a 2-byte format version and a CRC64 of everything before it, all little
+// endian. Strings are prefixed by their varint-encoded length.
+
+// value type tags, matching the RDB object types
+const (
+	dumpString byte = 0
+	dumpList   byte = 1
+	dumpSet    byte = 2
+	dumpZset   byte = 3
+	dumpHash   byte = 4
+	dumpStream byte = 15
+)
+
+// dumpVersion is the payload format version
+const dumpVersion uint16 = 1
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+var errBadPayload = errors.New("DUMP payload version or checksum are wrong")
+
+// errBadData is returned for a payload with a valid checksum holding a value
+// that cannot be restored
+var errBadData = errors.New("Bad data format")
+
+// dumpEncoder accumulates an encoded value
+type dumpEncoder struct {
+	bytes.Buffer
+}
+
+func (e *dumpEncoder) uvarint(n uint64) {
+	e.Write(binary.AppendUvarint(nil, n))
+}
+
+func (e *dumpEncoder) str(s string) {
+	e.uvarint(uint64(len(s)))
+	e.WriteString(s)
+}
+
+func (e *dumpEncoder) streamID(id StreamID) {
+	e.uvarint(id.ms)
+	e.uvarint(id.seq)
+}
+
+// time encodes t as a Unix time in milliseconds, 0 for the zero time
+func (e *dumpEncoder) time(t time.Time) {
+	if t.IsZero() {
+		e.uvarint(0)
+		return
+	}
+	e.uvarint(uint64(t.UnixMilli()))
+}
+
+// groups encodes the consumer groups of a stream along with their PELs
+func (e *dumpEncoder) groups(groups map[string]*ConsumerGroup) {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.uvarint(uint64(len(names)))
+	for _, name := range names {
+		g := groups[name]
+		e.str(name)
+		e.streamID(g.lastID)
+		// shifted so that -1, unknown, fits
+		e.uvarint(uint64(g.entriesRead + 1))
+		e.uvarint(uint64(len(g.pending)))
+		for _, id := range pendingIDs(g.pending) {
+			p := g.pending[id]
+			e.streamID(id)
+			e.str(p.consumer)
+			e.time(p.lastDelivered)
+			e.uvarint(uint64(p.deliveries))
+		}
+		e.uvarint(uint64(len(g.consumers)))
+		for _, c := range g.consumerInfos(false, 0) {
+			e.str(c.Name)
+			e.time(c.SeenTime)
+			e.time(c.ActiveTime)
+		}
+	}
+}
+
+// dumpDecoder reads an encoded value, remembering the first error
+type dumpDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *dumpDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = errBadPayload
+	}
+	return n
+}
+
+func (d *dumpDecoder) str() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(d.r.Len()) {
+		d.err = errBadPayload
+		return ""
+	}
+	buf := make([]byte, n)
+	d.r.Read(buf)
+	return string(buf)
+}
+
+func (d *dumpDecoder) streamID() StreamID {
+	ms := d.uvarint()
+	return StreamID{ms, d.uvarint()}
+}
+
+func (d *dumpDecoder) time() time.Time {
+	if ms := d.uvarint(); ms > 0 {
+		return time.UnixMilli(int64(ms))
+	}
+	return time.Time{}
+}
+
+// groups decodes the consumer groups encoded by dumpEncoder.groups, adding
+// each pending entry to the PEL of its consumer
+func (d *dumpDecoder) groups() map[string]*ConsumerGroup {
+	groups := make(map[string]*ConsumerGroup)
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		name := d.str()
+		lastID := d.streamID()
+		g := NewConsumerGroup(lastID, int64(d.uvarint())-1)
+		for m := d.uvarint(); m > 0 && d.err == nil; m-- {
+			id := d.streamID()
+			p := &pendingEntry{consumer: d.str(), lastDelivered: d.time()}
+			p.deliveries = int(d.uvarint())
+			g.pending[id] = p
+		}
+		for m := d.uvarint(); m > 0 && d.err == nil; m-- {
+			c := &consumer{pending: make(map[StreamID]struct{})}
+			cname := d.str()
+			c.seenTime = d.time()
+			c.activeTime = d.time()
+			g.consumers[cname] = c
+		}
+		for id, p := range g.pending {
+			c, ok := g.consumers[p.consumer]
+			if !ok {
+				d.err = errBadPayload
+				break
+			}
+			c.pending[id] = struct{}{}
+		}
+		groups[name] = g
+	}
+	return groups
+}
+
+func (d *dumpDecoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	var bits uint64
+	if err := binary.Read(d.r, binary.LittleEndian, &bits); err != nil {
+		d.err = errBadPayload
+	}
+	return math.Float64frombits(bits)
+}
+
+// Dump: serialize the value stored at key, returning nil when the key does
+// not exist
+func (k *Kv) Dump(key string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var e dumpEncoder
+	switch k.typeOf(key) {
+	case "none":
+		return nil, nil
+	case "string":
+		e.WriteByte(dumpString)
+		e.str(k.data[key])
+	case "list":
+		e.WriteByte(dumpList)
+		e.uvarint(uint64(len(k.lists[key])))
+		for _, v := range k.lists[key] {
+			e.str(v)
+		}
+	case "set":
+		e.WriteByte(dumpSet)
+		e.uvarint(uint64(len(k.sets[key])))
+		for _, m := range sortedMembers(k.sets[key]) {
+			e.str(m)
+		}
+	case "zset":
+		z := k.zsets[key]
+		e.WriteByte(dumpZset)
+		e.uvarint(uint64(z.Len()))
+		for _, entry := range z.index {
+			e.str(entry.member)
+			binary.Write(&e, binary.LittleEndian, math.Float64bits(entry.score))
+		}
+	case "hash":
+		h := k.hashes[key]
+		e.WriteByte(dumpHash)
+		e.uvarint(uint64(len(h)))
+		for _, f := range sortedFields(h) {
+			e.str(f)
+			e.str(h[f])
+		}
+	case "stream":
+		s := k.streams[key]
+		e.WriteByte(dumpStream)
+		e.streamID(s.lastID)
+		e.uvarint(uint64(s.entriesAdded))
+		e.streamID(s.maxDeletedID)
+		e.uvarint(uint64(s.Len()))
+		for _, entry := range s.entries {
+			e.streamID(entry.ID)
+			e.uvarint(uint64(len(entry.Fields)))
+			for _, f := range entry.Fields {
+				e.str(f)
+			}
+		}
+		e.groups(s.groups)
+	}
+	binary.Write(&e, binary.LittleEndian, dumpVersion)
+	binary.Write(&e, binary.LittleEndian, crc64.Checksum(e.Bytes(), crcTable))
+	return e.Bytes(), nil
+}
+
+// Restore: create key from a payload produced by Dump, expiring after ttl
+// unless it is 0. Unless replace is set the key must not exist.
+func (k *Kv) Restore(key string, ttl time.Duration, payload []byte, replace bool) error {
+	if len(payload) < 10 {
+		return errBadPayload
+	}
+	body, footer := payload[:len(payload)-8], payload[len(payload)-8:]
+	if crc64.Checksum(body, crcTable) != binary.LittleEndian.Uint64(footer) ||
+		binary.LittleEndian.Uint16(body[len(body)-2:]) != dumpVersion {
+		return errBadPayload
+	}
+	d := &dumpDecoder{r: bytes.NewReader(body[:len(body)-2])}
+	tag, _ := d.r.ReadByte()
+
+	// decode before taking the lock so a bad payload changes nothing
+	var (
+		str  string
+		list []string
+		set  map[string]struct{}
+		z    *SortedSet
+		hash map[string]string
+		st   *Stream
+	)
+	switch tag {
+	case dumpString:
+		str = d.str()
+	case dumpList:
+		for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+			list = append(list, d.str())
+		}
+	case dumpSet:
+		set = make(map[string]struct{})
+		for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+			set[d.str()] = struct{}{}
+		}
+	case dumpZset:
+		z = NewSortedSet()
+		for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+			member := d.str()
+			score := d.float()
+			if math.IsNaN(score) {
+				// NaN is unordered and would corrupt the score index
+				d.err = errBadData
+				break
+			}
+			z.Add(member, score)
+		}
+	case dumpHash:
+		hash = make(map[string]string)
+		for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+			f := d.str()
+			hash[f] = d.str()
+		}
+	case dumpStream:
+		st = NewStream()
+		st.lastID = d.streamID()
+		st.entriesAdded = int64(d.uvarint())
+		st.maxDeletedID = d.streamID()
+		for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+			entry := StreamEntry{ID: d.streamID()}
+			for m := d.uvarint(); m > 0 && d.err == nil; m-- {
+				entry.Fields = append(entry.Fields, d.str())
+			}
+			st.entries = append(st.entries, entry)
+		}
+		st.groups = d.groups()
+	default:
+		return errBadPayload
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if d.r.Len() != 0 {
+		return errBadPayload
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.typeOf(key) != "none" {
+		if !replace {
+			return respErr("BUSYKEY Target key name already exists.")
+		}
+		k.deleteLocked(key)
+	}
+	switch tag {
+	case dumpString:
+		k.data[key] = str
+	case dumpList:
+		k.lists[key] = list
+	case dumpSet:
+		k.sets[key] = set
+	case dumpZset:
+		k.zsets[key] = z
+	case dumpHash:
+		k.hashes[key] = hash
+	case dumpStream:
+		k.streams[key] = st
+	}
+	if ttl > 0 {
+		k.exp[key] = time.Now().Add(ttl)
+	}
+	k.wake(key)
+	return nil
+}
+
+// Handlers for serialization commands
+
+func dump(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("DUMP requires exactly one argument")
+	}
+	payload, err := kv.Dump(args[0])
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	return BulkString(payload), nil
+}
+
+func restore(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("RESTORE requires at least three arguments")
+	}
+	ms, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	if ms < 0 || ms > math.MaxInt64/int64(time.Millisecond) {
+		return nil, errors.New("Invalid TTL value, must be >= 0")
+	}
+	replace := false
+	for _, arg := range args[3:] {
+		if !strings.EqualFold(arg, "REPLACE") {
+			return nil, errors.New("syntax error")
+		}
+		replace = true
+	}
+	if err := kv.Restore(args[0], time.Duration(ms)*time.Millisecond, []byte(args[2]), replace); err != nil {
+		return nil, err
+	}
+	return SimpleString("OK"), nil
+}
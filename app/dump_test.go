@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDumpRestore(t *testing.T) {
+	kv := NewKv()
+	kv.Set("str", "hello\r\nworld")
+	kv.RPush("list", "a", "b", "c")
+	kv.SAdd("set", "x", "y")
+	kv.ZAdd("zset", ZAddOpts{}, zsetEntry{1.5, "m"}, zsetEntry{-2, "n"})
+	kv.HSet("hash", "f", "v", "g", "w")
+	kv.XAdd("stream", StreamID{1, 1}, XAddOpts{}, []string{"f", "v"})
+	for _, key := range []string{"str", "list", "set", "zset", "hash", "stream"} {
+		payload, err := kv.Dump(key)
+		if err != nil || payload == nil {
+			t.Fatalf("Dump(%q) = %v, %v", key, payload, err)
+		}
+		if err := kv.Restore(key+":copy", 0, payload, false); err != nil {
+			t.Fatalf("Restore(%q) error: %v", key, err)
+		}
+		if typ := kv.Type(key + ":copy"); typ != kv.Type(key) {
+			t.Fatalf("restored %q has type %s", key, typ)
+		}
+	}
+	if val, _, _ := kv.Get("str:copy"); val != "hello\r\nworld" {
+		t.Fatalf("restored string = %q", val)
+	}
+	if got, _ := kv.LRange("list:copy", 0, -1); !equalStrings(got, []string{"a", "b", "c"}) {
+		t.Fatalf("restored list = %v", got)
+	}
+	if got, _ := kv.SMembers("set:copy"); !equalStrings(got, []string{"x", "y"}) {
+		t.Fatalf("restored set = %v", got)
+	}
+	if got, _ := kv.ZRange("zset:copy", 0, -1); len(got) != 2 || got[0] != (zsetEntry{-2, "n"}) || got[1] != (zsetEntry{1.5, "m"}) {
+		t.Fatalf("restored zset = %v", got)
+	}
+	if got, _ := kv.HGetAll("hash:copy"); !equalStrings(got, []string{"f", "v", "g", "w"}) {
+		t.Fatalf("restored hash = %v", got)
+	}
+	if s := kv.streams["stream:copy"]; s.Len() != 1 || s.lastID != (StreamID{1, 1}) || !equalStrings(s.entries[0].Fields, []string{"f", "v"}) {
+		t.Fatalf("restored stream = %v", s)
+	}
+	if payload, _ := kv.Dump("missing"); payload != nil {
+		t.Fatalf("expected nil payload for missing key")
+	}
+}
+
+func TestRestoreOptions(t *testing.T) {
+	kv := NewKv()
+	kv.Set("k", "v")
+	payload, _ := kv.Dump("k")
+	var busy respErr
+	if err := kv.Restore("k", 0, payload, false); !errors.As(err, &busy) {
+		t.Fatalf("Restore onto existing key err = %v, want BUSYKEY", err)
+	}
+	kv.RPush("l", "x")
+	if resp, err := restore([]string{"l", "5000", string(payload), "REPLACE"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("RESTORE REPLACE = %v, %v; want OK", resp, err)
+	}
+	if ttl := kv.TTL("l"); ttl <= 4*time.Second || ttl > 5*time.Second {
+		t.Fatalf("restored TTL = %v, want about 5s", ttl)
+	}
+
+	corrupt := append([]byte(nil), payload...)
+	corrupt[1] ^= 0xff
+	if err := kv.Restore("bad", 0, corrupt, false); err == nil {
+		t.Fatalf("expected checksum error for corrupted payload")
+	}
+	if err := kv.Restore("bad", 0, []byte("short"), false); err == nil {
+		t.Fatalf("expected error for truncated payload")
+	}
+	if _, err := restore([]string{"k", "-1", string(payload)}, kv); err == nil {
+		t.Fatalf("expected error for negative TTL")
+	}
+
+	// a NaN score with a valid checksum is rejected
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1, "m"})
+	payload, _ = kv.Dump("z")
+	body := payload[:len(payload)-8]
+	score := body[len(body)-10 : len(body)-2]
+	binary.LittleEndian.PutUint64(score, math.Float64bits(math.NaN()))
+	nan := binary.LittleEndian.AppendUint64(append([]byte(nil), body...), crc64.Checksum(body, crcTable))
+	if err := kv.Restore("nan", 0, nan, false); err != errBadData {
+		t.Fatalf("Restore with a NaN score = %v, want %v", err, errBadData)
+	}
+}
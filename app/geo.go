@@ -0,0 +1,614 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// geo indexes are sorted sets whose scores are 52-bit geohashes, built the
+// way Redis does: the longitude and latitude are each quantized to 26 bits
+// and their bits interleaved, the longitude taking the odd (higher) bits.
+
+const (
+	geoStep   = 26 // bits per coordinate
+	geoLonMin = -180.0
+	geoLonMax = 180.0
+	// the latitude range is limited to what Web Mercator can project
+	geoLatMin = -85.05112878
+	geoLatMax = 85.05112878
+)
+
+// earthRadius is the radius in meters used for distances, matching Redis
+const earthRadius = 6372797.560856
+
+// geoUnits maps distance units to their length in meters
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.34,
+	"ft": 0.3048,
+}
+
+// parseGeoUnit returns the length in meters of unit
+func parseGeoUnit(unit string) (float64, error) {
+	factor, ok := geoUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, errors.New("unsupported unit provided. please use M, KM, FT, MI")
+	}
+	return factor, nil
+}
+
+// GeoPoint is a position on Earth along with its 52-bit geohash, which is
+// the score of its member in the sorted set backing a geo index
+type GeoPoint struct {
+	Lon, Lat float64
+	Hash     uint64
+}
+
+// NewGeoPoint returns the point at lon, lat, which must be in range
+func NewGeoPoint(lon, lat float64) GeoPoint {
+	return GeoPoint{Lon: lon, Lat: lat, Hash: geohashEncode(lon, lat, geoLatMin, geoLatMax)}
+}
+
+// Distance returns the great-circle distance in meters between p and q,
+// using the Haversine formula
+func (p GeoPoint) Distance(q GeoPoint) float64 {
+	lat1, lat2 := p.Lat*math.Pi/180, q.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (q.Lon - p.Lon) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// geoPointFromHash decodes a geohash to the center of its cell
+func geoPointFromHash(hash uint64) GeoPoint {
+	lonBits, latBits := deinterleave(hash)
+	cell := float64(uint64(1) << geoStep)
+	lon := geoLonMin + (float64(lonBits)+0.5)/cell*(geoLonMax-geoLonMin)
+	lat := geoLatMin + (float64(latBits)+0.5)/cell*(geoLatMax-geoLatMin)
+	lon = min(max(lon, geoLonMin), geoLonMax)
+	lat = min(max(lat, geoLatMin), geoLatMax)
+	return GeoPoint{Lon: lon, Lat: lat, Hash: hash}
+}
+
+// geohashEncode quantizes lon and lat (the latter over latMin..latMax) and
+// interleaves their bits
+func geohashEncode(lon, lat, latMin, latMax float64) uint64 {
+	cell := float64(uint64(1) << geoStep)
+	lonBits := uint64((lon - geoLonMin) / (geoLonMax - geoLonMin) * cell)
+	latBits := uint64((lat - latMin) / (latMax - latMin) * cell)
+	// the upper bounds fall in the last cell
+	lonBits = min(lonBits, uint64(cell)-1)
+	latBits = min(latBits, uint64(cell)-1)
+	return interleave(lonBits, latBits)
+}
+
+// interleave spreads the 26 bits of lon over the odd bits of the result and
+// those of lat over the even ones
+func interleave(lon, lat uint64) uint64 {
+	var h uint64
+	for i := geoStep - 1; i >= 0; i-- {
+		h = h<<2 | (lon>>i&1)<<1 | lat>>i&1
+	}
+	return h
+}
+
+// deinterleave is the inverse of interleave
+func deinterleave(h uint64) (lon, lat uint64) {
+	for i := geoStep - 1; i >= 0; i-- {
+		lon = lon<<1 | h>>(2*i+1)&1
+		lat = lat<<1 | h>>(2*i)&1
+	}
+	return lon, lat
+}
+
+// parseGeoPoint parses a longitude, latitude pair
+func parseGeoPoint(lonArg, latArg string) (GeoPoint, error) {
+	lon, err1 := strconv.ParseFloat(lonArg, 64)
+	lat, err2 := strconv.ParseFloat(latArg, 64)
+	if err1 != nil || err2 != nil {
+		return GeoPoint{}, errors.New("value is not a valid float")
+	}
+	if lon < geoLonMin || lon > geoLonMax || lat < geoLatMin || lat > geoLatMax {
+		return GeoPoint{}, fmt.Errorf("invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return NewGeoPoint(lon, lat), nil
+}
+
+// GeoPos: get the positions of members of the geo index at key, nil for
+// missing members
+func (k *Kv) GeoPos(key string, members []string) ([]*GeoPoint, error) {
+	scores, err := k.ZMScore(key, members)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]*GeoPoint, len(scores))
+	for i, score := range scores {
+		if score != nil {
+			p := geoPointFromHash(uint64(*score))
+			points[i] = &p
+		}
+	}
+	return points, nil
+}
+
+// GeoDist: get the distance in unit between two members of the geo index
+// at key. Returns false if either member is missing.
+func (k *Kv) GeoDist(key, m1, m2 string, unit string) (float64, bool, error) {
+	factor, err := parseGeoUnit(unit)
+	if err != nil {
+		return 0, false, err
+	}
+	points, err := k.GeoPos(key, []string{m1, m2})
+	if err != nil {
+		return 0, false, err
+	}
+	if points[0] == nil || points[1] == nil {
+		return 0, false, nil
+	}
+	return points[0].Distance(*points[1]) / factor, true, nil
+}
+
+// geohashAlphabet is the base32 alphabet of standard geohash strings
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeoHash: get the standard 11 character geohash strings of members of the
+// geo index at key, nil for missing members
+func (k *Kv) GeoHash(key string, members []string) ([]*string, error) {
+	points, err := k.GeoPos(key, members)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]*string, len(points))
+	for i, p := range points {
+		if p == nil {
+			continue
+		}
+		// standard geohashes cover latitudes up to the poles, so the
+		// position is encoded again over that range
+		bits := geohashEncode(p.Lon, p.Lat, -90, 90)
+		buf := make([]byte, 11)
+		for j := range buf {
+			var idx uint64
+			// the 52 bits fill ten characters, the last one is padding
+			if j < 10 {
+				idx = bits >> (52 - (j+1)*5) & 0x1f
+			}
+			buf[j] = geohashAlphabet[idx]
+		}
+		hash := string(buf)
+		hashes[i] = &hash
+	}
+	return hashes, nil
+}
+
+// GeoSearchOpts describes a GEOSEARCH query. The center is the position of
+// Member when FromMember is set and Lon, Lat otherwise. The area is a box of
+// Width by Height when ByBox is set, and a circle of Radius otherwise; all
+// lengths are in meters.
+type GeoSearchOpts struct {
+	FromMember    bool
+	Member        string
+	Lon, Lat      float64
+	ByBox         bool
+	Radius        float64
+	Width, Height float64
+	Unit          float64 // length in meters of the unit results are given in
+	Sort          string  // "ASC", "DESC", or "" for geohash order
+	Count         int     // 0 for no limit
+	Any           bool    // stop at the first Count matches rather than the nearest
+}
+
+// GeoSearchResult is a member found by GeoSearch, with its distance to the
+// center in the search unit
+type GeoSearchResult struct {
+	Member string
+	Dist   float64
+	Point  GeoPoint
+}
+
+// GeoSearch: find the members of the geo index at key within the area
+// described by opts
+func (k *Kv) GeoSearch(key string, opts GeoSearchOpts) ([]GeoSearchResult, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.geoSearchLocked(key, opts)
+}
+
+// geoSearchLocked implements GeoSearch. Callers must hold k.mu.
+func (k *Kv) geoSearchLocked(key string, opts GeoSearchOpts) ([]GeoSearchResult, error) {
+	if err := k.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return nil, nil
+	}
+	center := GeoPoint{Lon: opts.Lon, Lat: opts.Lat}
+	if opts.FromMember {
+		score, ok := z.members[opts.Member]
+		if !ok {
+			return nil, errors.New("could not decode requested zset member")
+		}
+		center = geoPointFromHash(uint64(score))
+	}
+	unit := opts.Unit
+	if unit == 0 {
+		unit = 1
+	}
+	var results []GeoSearchResult
+	for _, e := range z.index {
+		p := geoPointFromHash(uint64(e.score))
+		dist, ok := geoWithin(center, p, opts)
+		if !ok {
+			continue
+		}
+		results = append(results, GeoSearchResult{Member: e.member, Dist: dist / unit, Point: p})
+		if opts.Any && len(results) == opts.Count {
+			break
+		}
+	}
+	order := opts.Sort
+	if order == "" && opts.Count > 0 && !opts.Any {
+		// the nearest members are returned when the count is limited
+		order = "ASC"
+	}
+	switch order {
+	case "ASC":
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Dist < results[j].Dist })
+	case "DESC":
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Dist > results[j].Dist })
+	}
+	if opts.Count > 0 && len(results) > opts.Count {
+		results = results[:opts.Count]
+	}
+	return results, nil
+}
+
+// GeoSearchStore: replace dst with a sorted set holding the members of the
+// src geo index found by GeoSearch, scored by geohash or, with storeDist, by
+// distance to the center. Returns the number of stored members.
+func (k *Kv) GeoSearchStore(dst, src string, opts GeoSearchOpts, storeDist bool) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	results, err := k.geoSearchLocked(src, opts)
+	if err != nil {
+		return 0, err
+	}
+	scores := make(map[string]float64, len(results))
+	for _, r := range results {
+		if storeDist {
+			scores[r.Member] = r.Dist
+		} else {
+			scores[r.Member] = float64(r.Point.Hash)
+		}
+	}
+	return k.storeZsetLocked(dst, scores), nil
+}
+
+// geoWithin reports whether p lies in the search area around center, and
+// its distance in meters
+func geoWithin(center, p GeoPoint, opts GeoSearchOpts) (float64, bool) {
+	if !opts.ByBox {
+		dist := center.Distance(p)
+		return dist, dist <= opts.Radius
+	}
+	// measure the north-south offset along the center's meridian, and the
+	// east-west one along the point's parallel
+	if center.Distance(GeoPoint{Lon: center.Lon, Lat: p.Lat}) > opts.Height/2 {
+		return 0, false
+	}
+	if p.Distance(GeoPoint{Lon: center.Lon, Lat: p.Lat}) > opts.Width/2 {
+		return 0, false
+	}
+	return center.Distance(p), true
+}
+
+// formatGeoFloat formats distances and coordinates with the four decimals
+// Redis replies with
+func formatGeoFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+// geoReplyOpts holds the WITHDIST, WITHHASH and WITHCOORD flags of a search
+type geoReplyOpts struct {
+	dist, hash, coord bool
+}
+
+// parseGeoSearchArgs parses the arguments of GEOSEARCH following the key.
+// When store is set the reply flags are rejected and STOREDIST is accepted
+// instead.
+func parseGeoSearchArgs(args []string, store bool) (opts GeoSearchOpts, with geoReplyOpts, storeDist bool, err error) {
+	var from, by int
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "FROMMEMBER" && remaining >= 1:
+			opts.FromMember, opts.Member = true, args[i+1]
+			from++
+			i++
+		case opt == "FROMLONLAT" && remaining >= 2:
+			p, err := parseGeoPoint(args[i+1], args[i+2])
+			if err != nil {
+				return opts, with, false, err
+			}
+			opts.Lon, opts.Lat = p.Lon, p.Lat
+			from++
+			i += 2
+		case opt == "BYRADIUS" && remaining >= 2:
+			radius, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil {
+				return opts, with, false, errors.New("need numeric radius")
+			}
+			if radius < 0 {
+				return opts, with, false, errors.New("radius cannot be negative")
+			}
+			if opts.Unit, err = parseGeoUnit(args[i+2]); err != nil {
+				return opts, with, false, err
+			}
+			opts.Radius = radius * opts.Unit
+			by++
+			i += 2
+		case opt == "BYBOX" && remaining >= 3:
+			width, err1 := strconv.ParseFloat(args[i+1], 64)
+			height, err2 := strconv.ParseFloat(args[i+2], 64)
+			if err1 != nil || err2 != nil {
+				return opts, with, false, errors.New("need numeric width and height")
+			}
+			if width < 0 || height < 0 {
+				return opts, with, false, errors.New("height or width cannot be negative")
+			}
+			if opts.Unit, err = parseGeoUnit(args[i+3]); err != nil {
+				return opts, with, false, err
+			}
+			opts.ByBox = true
+			opts.Width, opts.Height = width*opts.Unit, height*opts.Unit
+			by++
+			i += 3
+		case opt == "ASC" || opt == "DESC":
+			opts.Sort = opt
+		case opt == "COUNT" && remaining >= 1:
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return opts, with, false, errors.New("value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return opts, with, false, errors.New("COUNT must be > 0")
+			}
+			opts.Count = count
+			i++
+			if i+1 < len(args) && strings.ToUpper(args[i+1]) == "ANY" {
+				opts.Any = true
+				i++
+			}
+		case opt == "ANY":
+			return opts, with, false, errors.New("the ANY argument requires COUNT argument")
+		case opt == "WITHDIST" && !store:
+			with.dist = true
+		case opt == "WITHHASH" && !store:
+			with.hash = true
+		case opt == "WITHCOORD" && !store:
+			with.coord = true
+		case opt == "STOREDIST" && store:
+			storeDist = true
+		default:
+			return opts, with, false, errors.New("syntax error")
+		}
+	}
+	if from != 1 {
+		return opts, with, false, errors.New("exactly one of FROMMEMBER or FROMLONLAT can be specified")
+	}
+	if by != 1 {
+		return opts, with, false, errors.New("exactly one of BYRADIUS and BYBOX can be specified")
+	}
+	return opts, with, storeDist, nil
+}
+
+// geoSearchReply formats search results, each being a bare member unless
+// reply flags are set
+func geoSearchReply(results []GeoSearchResult, with geoReplyOpts) Array {
+	respArray := make(Array, len(results))
+	for i, r := range results {
+		if !with.dist && !with.hash && !with.coord {
+			respArray[i] = BulkString(r.Member)
+			continue
+		}
+		item := Array{BulkString(r.Member)}
+		if with.dist {
+			item = append(item, BulkString(formatGeoFloat(r.Dist)))
+		}
+		if with.hash {
+			item = append(item, integer(r.Point.Hash))
+		}
+		if with.coord {
+			item = append(item, Array{BulkString(formatFloat(r.Point.Lon)), BulkString(formatFloat(r.Point.Lat))})
+		}
+		respArray[i] = item
+	}
+	return respArray
+}
+
+// Handlers for geo commands
+
+func geoadd(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 4 {
+		return nil, errors.New("GEOADD requires at least four arguments")
+	}
+	var opts ZAddOpts
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "CH":
+			opts.CH = true
+		default:
+			break flags
+		}
+	}
+	if opts.NX && opts.XX {
+		return nil, errors.New("XX and NX options at the same time are not compatible")
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return nil, errors.New("syntax error")
+	}
+	entries := make([]zsetEntry, 0, len(triples)/3)
+	for j := 0; j < len(triples); j += 3 {
+		p, err := parseGeoPoint(triples[j], triples[j+1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, zsetEntry{score: float64(p.Hash), member: triples[j+2]})
+	}
+	n, err := kv.ZAdd(args[0], opts, entries...)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func geopos(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("GEOPOS requires at least one argument")
+	}
+	points, err := kv.GeoPos(args[0], args[1:])
+	if err != nil {
+		return nil, err
+	}
+	respArray := make(Array, len(points))
+	for i, p := range points {
+		if p != nil {
+			respArray[i] = Array{BulkString(formatFloat(p.Lon)), BulkString(formatFloat(p.Lat))}
+		}
+	}
+	return respArray, nil
+}
+
+func geodist(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, errors.New("syntax error")
+	}
+	unit := "m"
+	if len(args) == 4 {
+		unit = args[3]
+	}
+	dist, ok, err := kv.GeoDist(args[0], args[1], args[2], unit)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return BulkString(formatGeoFloat(dist)), nil
+}
+
+func geohash(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("GEOHASH requires at least one argument")
+	}
+	hashes, err := kv.GeoHash(args[0], args[1:])
+	if err != nil {
+		return nil, err
+	}
+	respArray := make(Array, len(hashes))
+	for i, h := range hashes {
+		if h != nil {
+			respArray[i] = BulkString(*h)
+		}
+	}
+	return respArray, nil
+}
+
+func geosearch(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("GEOSEARCH requires at least one argument")
+	}
+	opts, with, _, err := parseGeoSearchArgs(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	results, err := kv.GeoSearch(args[0], opts)
+	if err != nil {
+		return nil, err
+	}
+	return geoSearchReply(results, with), nil
+}
+
+func geosearchstore(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("GEOSEARCHSTORE requires at least two arguments")
+	}
+	opts, _, storeDist, err := parseGeoSearchArgs(args[2:], true)
+	if err != nil {
+		return nil, err
+	}
+	n, err := kv.GeoSearchStore(args[0], args[1], opts, storeDist)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+// GEORADIUS and GEORADIUSBYMEMBER were deprecated in favor of GEOSEARCH and
+// GEOSEARCHSTORE; they are kept for older clients and rewritten into the
+// equivalent GEOSEARCH arguments.
+
+func georadius(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 5 {
+		return nil, errors.New("GEORADIUS requires at least five arguments")
+	}
+	search := append([]string{"FROMLONLAT", args[1], args[2], "BYRADIUS"}, args[3:]...)
+	return georadiusCmd(args[0], search, kv)
+}
+
+func georadiusbymember(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 4 {
+		return nil, errors.New("GEORADIUSBYMEMBER requires at least four arguments")
+	}
+	search := append([]string{"FROMMEMBER", args[1], "BYRADIUS"}, args[2:]...)
+	return georadiusCmd(args[0], search, kv)
+}
+
+// georadiusCmd runs a GEOSEARCH of key with search, storing the results
+// when the STORE or STOREDIST options are given
+func georadiusCmd(key string, search []string, kv *Kv) (RespValue, error) {
+	var dst string
+	var storeDist bool
+	args := make([]string, 0, len(search))
+	for i := 0; i < len(search); i++ {
+		opt := strings.ToUpper(search[i])
+		if (opt == "STORE" || opt == "STOREDIST") && i+1 < len(search) {
+			dst, storeDist = search[i+1], opt == "STOREDIST"
+			i++
+			continue
+		}
+		args = append(args, search[i])
+	}
+	opts, with, _, err := parseGeoSearchArgs(args, false)
+	if err != nil {
+		return nil, err
+	}
+	if dst == "" {
+		results, err := kv.GeoSearch(key, opts)
+		if err != nil {
+			return nil, err
+		}
+		return geoSearchReply(results, with), nil
+	}
+	if with.dist || with.hash || with.coord {
+		return nil, errors.New("STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	n, err := kv.GeoSearchStore(dst, key, opts, storeDist)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestGeohashRoundTrip(t *testing.T) {
+	// Palermo as used in the Redis docs
+	p := NewGeoPoint(13.361389, 38.115556)
+	if p.Hash != 3479099956230698 {
+		t.Fatalf("geohash of Palermo = %d, want 3479099956230698", p.Hash)
+	}
+	d := geoPointFromHash(p.Hash)
+	if math.Abs(d.Lon-13.361389) > 1e-5 || math.Abs(d.Lat-38.115556) > 1e-5 {
+		t.Fatalf("decoded Palermo = %v, %v", d.Lon, d.Lat)
+	}
+	for _, c := range [][2]float64{{-180, -85.05112878}, {180, 85.05112878}, {0, 0}} {
+		d := geoPointFromHash(NewGeoPoint(c[0], c[1]).Hash)
+		if math.Abs(d.Lon-c[0]) > 1e-4 || math.Abs(d.Lat-c[1]) > 1e-4 {
+			t.Fatalf("round trip of %v = %v, %v", c, d.Lon, d.Lat)
+		}
+	}
+}
+
+func TestGeoAddGeoPos(t *testing.T) {
+	kv := NewKv()
+	resp, err := geoadd([]string{"Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, kv)
+	if err != nil || resp != integer(2) {
+		t.Fatalf("GEOADD = %v, %v; want 2", resp, err)
+	}
+	// geo indexes are sorted sets scored by geohash
+	if typ := kv.Type("Sicily"); typ != "zset" {
+		t.Fatalf("type of geo index = %q, want zset", typ)
+	}
+	if score, _, _ := kv.ZScore("Sicily", "Palermo"); score != 3479099956230698 {
+		t.Fatalf("Palermo score = %v", score)
+	}
+	if resp, _ := geoadd([]string{"Sicily", "XX", "CH", "13.5", "38.1", "Palermo", "14", "37", "Nowhere"}, kv); resp != integer(1) {
+		t.Fatalf("GEOADD XX CH = %v, want 1", resp)
+	}
+	resp, _ = geopos([]string{"Sicily", "Catania", "Nowhere"}, kv)
+	arr := resp.(Array)
+	if arr[1] != nil {
+		t.Fatalf("GEOPOS of missing member = %v, want nil", arr[1])
+	}
+	pos := arr[0].(Array)
+	lon, _ := strconv.ParseFloat(string(pos[0].(BulkString)), 64)
+	lat, _ := strconv.ParseFloat(string(pos[1].(BulkString)), 64)
+	if math.Abs(lon-15.087269) > 1e-5 || math.Abs(lat-37.502669) > 1e-5 {
+		t.Fatalf("GEOPOS Catania = %v, %v", lon, lat)
+	}
+	for _, args := range [][]string{
+		{"Sicily", "181", "0", "x"},
+		{"Sicily", "0", "86", "x"},
+		{"Sicily", "0", "0"},
+		{"Sicily", "NX", "XX", "0", "0", "x"},
+	} {
+		if _, err := geoadd(args, kv); err == nil {
+			t.Fatalf("expected error for GEOADD %v", args)
+		}
+	}
+}
+
+func TestGeoDist(t *testing.T) {
+	kv := NewKv()
+	geoadd([]string{"Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, kv)
+	geoadd([]string{"cities", "2.3522", "48.8566", "Paris", "-0.1276", "51.5072", "London"}, kv)
+	for _, c := range []struct {
+		key, m1, m2, unit string
+		want              float64
+	}{
+		{"Sicily", "Palermo", "Catania", "m", 166274.15},
+		{"Sicily", "Palermo", "Catania", "KM", 166.27415},
+		{"Sicily", "Palermo", "Catania", "mi", 103.3182},
+		{"cities", "Paris", "London", "km", 343.5},
+		{"cities", "London", "Paris", "ft", 1127000},
+	} {
+		got, ok, err := kv.GeoDist(c.key, c.m1, c.m2, c.unit)
+		if err != nil || !ok || math.Abs(got-c.want) > c.want*0.005 {
+			t.Fatalf("GeoDist(%s, %s, %s) = %v, %v, %v; want %v", c.m1, c.m2, c.unit, got, ok, err, c.want)
+		}
+	}
+	if resp, _ := geodist([]string{"Sicily", "Palermo", "Catania"}, kv); resp != BulkString("166274.1516") {
+		t.Fatalf("GEODIST = %v, want 166274.1516", resp)
+	}
+	if resp, err := geodist([]string{"Sicily", "Palermo", "Rome"}, kv); resp != nil || err != nil {
+		t.Fatalf("GEODIST with missing member = %v, %v; want nil", resp, err)
+	}
+	if _, err := geodist([]string{"Sicily", "Palermo", "Catania", "yd"}, kv); err == nil {
+		t.Fatalf("expected error for unsupported unit")
+	}
+}
+
+// geoMembers returns the members of a GEOSEARCH reply without reply flags
+func geoMembers(resp RespValue) []string {
+	var members []string
+	for _, item := range resp.(Array) {
+		members = append(members, string(item.(BulkString)))
+	}
+	return members
+}
+
+func TestGeoSearch(t *testing.T) {
+	kv := NewKv()
+	geoadd([]string{"Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, kv)
+	geoadd([]string{"Sicily", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2"}, kv)
+
+	resp, _ := geosearch([]string{"Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC"}, kv)
+	if got := geoMembers(resp); !equalStrings(got, []string{"Catania", "Palermo"}) {
+		t.Fatalf("GEOSEARCH BYRADIUS = %v, want [Catania Palermo]", got)
+	}
+	resp, _ = geosearch([]string{"Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "DESC", "WITHDIST", "WITHHASH", "WITHCOORD"}, kv)
+	arr := resp.(Array)
+	if len(arr) != 4 {
+		t.Fatalf("GEOSEARCH BYBOX returned %d members, want 4", len(arr))
+	}
+	first, last := arr[0].(Array), arr[3].(Array)
+	if first[0] != BulkString("edge1") || first[1] != BulkString("279.7405") {
+		t.Fatalf("farthest member = %v, want edge1 at 279.7405", first)
+	}
+	if last[0] != BulkString("Catania") || last[1] != BulkString("56.4413") || last[2] != integer(3479447370796909) {
+		t.Fatalf("nearest member = %v, want Catania at 56.4413", last)
+	}
+	if coord := last[3].(Array); len(coord) != 2 {
+		t.Fatalf("WITHCOORD = %v", coord)
+	}
+
+	// COUNT without an order returns the nearest members
+	resp, _ = geosearch([]string{"Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "500", "km", "COUNT", "2"}, kv)
+	if got := geoMembers(resp); !equalStrings(got, []string{"Palermo", "edge1"}) {
+		t.Fatalf("GEOSEARCH COUNT = %v, want [Palermo edge1]", got)
+	}
+	resp, _ = geosearch([]string{"Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "500", "km", "COUNT", "3", "ANY"}, kv)
+	if got := geoMembers(resp); len(got) != 3 {
+		t.Fatalf("GEOSEARCH COUNT ANY = %v, want 3 members", got)
+	}
+	if resp, err := geosearch([]string{"nosuchkey", "FROMMEMBER", "x", "BYRADIUS", "1", "m"}, kv); err != nil || len(resp.(Array)) != 0 {
+		t.Fatalf("GEOSEARCH on missing key = %v, %v; want empty", resp, err)
+	}
+
+	for _, args := range [][]string{
+		{"Sicily", "FROMMEMBER", "Rome", "BYRADIUS", "1", "km"},
+		{"Sicily", "BYRADIUS", "1", "km"},
+		{"Sicily", "FROMLONLAT", "15", "37"},
+		{"Sicily", "FROMLONLAT", "15", "37", "FROMMEMBER", "Palermo", "BYRADIUS", "1", "km"},
+		{"Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "-1", "km"},
+		{"Sicily", "FROMLONLAT", "15", "37", "BYBOX", "1", "1", "yd"},
+		{"Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "ANY"},
+		{"Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "COUNT", "0"},
+		{"Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "STOREDIST"},
+	} {
+		if _, err := geosearch(args, kv); err == nil {
+			t.Fatalf("expected error for GEOSEARCH %v", args)
+		}
+	}
+}
+
+func TestGeoSearchStore(t *testing.T) {
+	kv := NewKv()
+	geoadd([]string{"Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, kv)
+	geoadd([]string{"Sicily", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2"}, kv)
+
+	resp, err := geosearchstore([]string{"near", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km"}, kv)
+	if err != nil || resp != integer(2) {
+		t.Fatalf("GEOSEARCHSTORE = %v, %v; want 2", resp, err)
+	}
+	// the destination is a geo index in its own right
+	if resp, _ := geopos([]string{"near", "Palermo"}, kv); resp.(Array)[0] == nil {
+		t.Fatalf("stored member has no position")
+	}
+	if score, _, _ := kv.ZScore("near", "Catania"); score != 3479447370796909 {
+		t.Fatalf("stored Catania score = %v, want its geohash", score)
+	}
+
+	kv.SetWithTTL("dists", "overwritten", 0)
+	resp, _ = geosearchstore([]string{"dists", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "COUNT", "1", "STOREDIST"}, kv)
+	if resp != integer(1) {
+		t.Fatalf("GEOSEARCHSTORE STOREDIST = %v, want 1", resp)
+	}
+	if score, ok, _ := kv.ZScore("dists", "Catania"); !ok || math.Abs(score-56.4413) > 1e-4 {
+		t.Fatalf("stored distance = %v, want 56.4413", score)
+	}
+
+	// an empty result deletes the destination
+	resp, _ = geosearchstore([]string{"near", "Sicily", "FROMLONLAT", "0", "0", "BYRADIUS", "1", "km"}, kv)
+	if resp != integer(0) || kv.Exists([]string{"near"}) != 0 {
+		t.Fatalf("empty GEOSEARCHSTORE = %v, destination kept", resp)
+	}
+	if _, err := geosearchstore([]string{"near", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "WITHDIST"}, kv); err == nil {
+		t.Fatalf("expected error for GEOSEARCHSTORE WITHDIST")
+	}
+}
+
+func TestGeoHash(t *testing.T) {
+	kv := NewKv()
+	geoadd([]string{"Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, kv)
+	resp, err := geohash([]string{"Sicily", "Palermo", "Catania", "Rome"}, kv)
+	if err != nil {
+		t.Fatalf("GEOHASH error: %v", err)
+	}
+	arr := resp.(Array)
+	if arr[0] != BulkString("sqc8b49rny0") || arr[1] != BulkString("sqdtr74hyu0") || arr[2] != nil {
+		t.Fatalf("GEOHASH = %v, want [sqc8b49rny0 sqdtr74hyu0 <nil>]", arr)
+	}
+	if hashes, _ := kv.GeoHash("nosuchkey", []string{"x"}); len(hashes) != 1 || hashes[0] != nil {
+		t.Fatalf("GeoHash on missing key = %v, want [nil]", hashes)
+	}
+}
+
+func TestGeoRadius(t *testing.T) {
+	kv := NewKv()
+	geoadd([]string{"Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, kv)
+
+	resp, err := georadius([]string{"Sicily", "15", "37", "200", "km", "WITHDIST", "ASC"}, kv)
+	if err != nil {
+		t.Fatalf("GEORADIUS error: %v", err)
+	}
+	arr := resp.(Array)
+	if len(arr) != 2 || arr[0].(Array)[1] != BulkString("56.4413") || arr[1].(Array)[1] != BulkString("190.4424") {
+		t.Fatalf("GEORADIUS WITHDIST = %v", arr)
+	}
+	resp, _ = georadiusbymember([]string{"Sicily", "Palermo", "100", "km"}, kv)
+	if got := geoMembers(resp); !equalStrings(got, []string{"Palermo"}) {
+		t.Fatalf("GEORADIUSBYMEMBER = %v, want [Palermo]", got)
+	}
+
+	if resp, _ := georadius([]string{"Sicily", "15", "37", "200", "km", "STORE", "near"}, kv); resp != integer(2) {
+		t.Fatalf("GEORADIUS STORE = %v, want 2", resp)
+	}
+	if score, _, _ := kv.ZScore("near", "Palermo"); score != 3479099956230698 {
+		t.Fatalf("stored Palermo score = %v, want its geohash", score)
+	}
+	if resp, _ := georadiusbymember([]string{"Sicily", "Palermo", "200", "km", "STOREDIST", "dists"}, kv); resp != integer(2) {
+		t.Fatalf("GEORADIUSBYMEMBER STOREDIST = %v, want 2", resp)
+	}
+	if score, _, _ := kv.ZScore("dists", "Catania"); math.Abs(score-166.2742) > 1e-4 {
+		t.Fatalf("stored distance = %v, want 166.2742", score)
+	}
+	if _, err := georadius([]string{"Sicily", "15", "37", "200", "km", "WITHCOORD", "STORE", "near"}, kv); err == nil {
+		t.Fatalf("expected error for STORE with WITHCOORD")
+	}
+}
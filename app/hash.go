@@ -0,0 +1,445 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// hash operations:
+// HSet: set the given field-value pairs in the hash stored at key.
+// Returns the number of fields that were newly added.
+func (k *Kv) HSet(key string, fieldValues ...string) (int, error) {
+	if len(fieldValues)%2 != 0 {
+		return 0, errors.New("field-value pairs are unbalanced")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return 0, err
+	}
+	h, ok := k.hashes[key]
+	if !ok {
+		h = make(map[string]string)
+		k.hashes[key] = h
+	}
+	added := 0
+	for i := 0; i < len(fieldValues); i += 2 {
+		if _, exists := h[fieldValues[i]]; !exists {
+			added++
+		}
+		h[fieldValues[i]] = fieldValues[i+1]
+	}
+	return added, nil
+}
+
+// HGet: get the value of field in the hash stored at key
+func (k *Kv) HGet(key, field string) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return "", false, err
+	}
+	h, exists := k.hashes[key]
+	k.recordLookup(exists)
+	val, ok := h[field]
+	return val, ok, nil
+}
+
+// HExists: report whether field exists in the hash stored at key
+func (k *Kv) HExists(key, field string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return false, err
+	}
+	_, ok := k.hashes[key][field]
+	return ok, nil
+}
+
+// HDel: remove fields from the hash stored at key, deleting the key once the
+// hash is empty. Returns the number of removed fields.
+func (k *Kv) HDel(key string, fields ...string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return 0, err
+	}
+	h, ok := k.hashes[key]
+	if !ok {
+		return 0, nil
+	}
+	removed := 0
+	for _, f := range fields {
+		if _, exists := h[f]; exists {
+			delete(h, f)
+			removed++
+		}
+	}
+	if len(h) == 0 {
+		k.deleteLocked(key)
+	}
+	return removed, nil
+}
+
+// sortedFields returns the field names of h in sorted order
+func sortedFields(h map[string]string) []string {
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// HGetAll: get all fields and values of the hash stored at key as a flat
+// field, value, field, value... slice ordered by field name
+func (k *Kv) HGetAll(key string) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return nil, err
+	}
+	h := k.hashes[key]
+	out := make([]string, 0, 2*len(h))
+	for _, f := range sortedFields(h) {
+		out = append(out, f, h[f])
+	}
+	return out, nil
+}
+
+// HKeys: get all field names of the hash stored at key
+func (k *Kv) HKeys(key string) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return nil, err
+	}
+	return sortedFields(k.hashes[key]), nil
+}
+
+// HVals: get all values of the hash stored at key, in field order
+func (k *Kv) HVals(key string) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return nil, err
+	}
+	h := k.hashes[key]
+	vals := make([]string, 0, len(h))
+	for _, f := range sortedFields(h) {
+		vals = append(vals, h[f])
+	}
+	return vals, nil
+}
+
+// HLen: get the number of fields in the hash stored at key
+func (k *Kv) HLen(key string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return 0, err
+	}
+	return len(k.hashes[key]), nil
+}
+
+// HMGet: get the values of several fields of the hash stored at key. Each
+// element is the field value as a string, or nil when the field is missing.
+func (k *Kv) HMGet(key string, fields []string) ([]interface{}, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return nil, err
+	}
+	h := k.hashes[key]
+	vals := make([]interface{}, len(fields))
+	for i, f := range fields {
+		if v, ok := h[f]; ok {
+			vals[i] = v
+		}
+	}
+	return vals, nil
+}
+
+// HIncrBy: increment the integer stored in field by delta, creating the
+// field with value 0 first if needed. Returns the new value.
+func (k *Kv) HIncrBy(key, field string, delta int64) (int64, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return 0, err
+	}
+	h := k.hashes[key]
+	var cur int64
+	if v, ok := h[field]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, errors.New("hash value is not an integer")
+		}
+		cur = n
+	}
+	if (delta > 0 && cur > math.MaxInt64-delta) || (delta < 0 && cur < math.MinInt64-delta) {
+		return 0, errors.New("increment or decrement would overflow")
+	}
+	cur += delta
+	if h == nil {
+		h = make(map[string]string)
+		k.hashes[key] = h
+	}
+	h[field] = strconv.FormatInt(cur, 10)
+	return cur, nil
+}
+
+// HIncrByFloat: increment the float stored in field by delta, creating the
+// field with value 0 first if needed. Returns the new value.
+func (k *Kv) HIncrByFloat(key, field string, delta float64) (float64, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return 0, err
+	}
+	h := k.hashes[key]
+	var cur float64
+	if v, ok := h[field]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, errors.New("hash value is not a float")
+		}
+		cur = f
+	}
+	cur += delta
+	if math.IsNaN(cur) || math.IsInf(cur, 0) {
+		return 0, errors.New("increment would produce NaN or Infinity")
+	}
+	if h == nil {
+		h = make(map[string]string)
+		k.hashes[key] = h
+	}
+	h[field] = formatFloat(cur)
+	return cur, nil
+}
+
+// HSetNX: set field only if it does not exist yet. Reports whether the
+// field was set.
+func (k *Kv) HSetNX(key, field, value string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return false, err
+	}
+	h, ok := k.hashes[key]
+	if !ok {
+		h = make(map[string]string)
+		k.hashes[key] = h
+	}
+	if _, exists := h[field]; exists {
+		return false, nil
+	}
+	h[field] = value
+	return true, nil
+}
+
+// HScan: iterate the hash stored at key. Fields are visited in sorted order
+// and cursor is the offset of the first field of the page, which keeps the
+// cursor stable across calls. Returns the next cursor (0 when done) and a
+// flat field, value... slice of the fields matching match (if not empty).
+func (k *Kv) HScan(key string, cursor int, match string, count int) (int, []string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "hash"); err != nil {
+		return 0, nil, err
+	}
+	h := k.hashes[key]
+	fields := sortedFields(h)
+	next, lo, hi := scanBounds(len(fields), cursor, count)
+	out := make([]string, 0, 2*(hi-lo))
+	for _, f := range fields[lo:hi] {
+		if match == "" || globMatch(match, f) {
+			out = append(out, f, h[f])
+		}
+	}
+	return next, out, nil
+}
+
+// Handlers for hash commands
+
+func hset(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, errors.New("HSET requires a key and field-value pairs")
+	}
+	added, err := kv.HSet(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return integer(added), nil
+}
+
+func hget(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("HGET requires exactly two arguments")
+	}
+	val, ok, err := kv.HGet(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return BulkString(val), nil
+}
+
+func hexists(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("HEXISTS requires exactly two arguments")
+	}
+	ok, err := kv.HExists(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return integer(1), nil
+	}
+	return integer(0), nil
+}
+
+func hdel(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("HDEL requires at least two arguments")
+	}
+	removed, err := kv.HDel(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return integer(removed), nil
+}
+
+func hgetall(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("HGETALL requires exactly one argument")
+	}
+	vals, err := kv.HGetAll(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return Map(bulkArray(vals)), nil
+}
+
+func hkeys(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("HKEYS requires exactly one argument")
+	}
+	fields, err := kv.HKeys(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(fields), nil
+}
+
+func hvals(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("HVALS requires exactly one argument")
+	}
+	vals, err := kv.HVals(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(vals), nil
+}
+
+func hlen(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("HLEN requires exactly one argument")
+	}
+	n, err := kv.HLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func hmget(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("HMGET requires at least two arguments")
+	}
+	vals, err := kv.HMGet(args[0], args[1:])
+	if err != nil {
+		return nil, err
+	}
+	respArray := make(Array, len(vals))
+	for i, v := range vals {
+		if v != nil {
+			respArray[i] = BulkString(v.(string))
+		}
+	}
+	return respArray, nil
+}
+
+func hincrby(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("HINCRBY requires exactly three arguments")
+	}
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	n, err := kv.HIncrBy(args[0], args[1], delta)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func hincrbyfloat(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("HINCRBYFLOAT requires exactly three arguments")
+	}
+	delta, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return nil, errors.New("value is not a valid float")
+	}
+	f, err := kv.HIncrByFloat(args[0], args[1], delta)
+	if err != nil {
+		return nil, err
+	}
+	return BulkString(formatFloat(f)), nil
+}
+
+func hsetnx(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("HSETNX requires exactly three arguments")
+	}
+	ok, err := kv.HSetNX(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return integer(1), nil
+	}
+	return integer(0), nil
+}
+
+func hscan(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("HSCAN requires at least two arguments")
+	}
+	opts, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if opts.typ != "" {
+		return nil, errors.New("syntax error")
+	}
+	next, pairs, err := kv.HScan(args[0], opts.cursor, opts.match, opts.count)
+	if err != nil {
+		return nil, err
+	}
+	if opts.noValues {
+		fields := make([]string, 0, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			fields = append(fields, pairs[i])
+		}
+		pairs = fields
+	}
+	return scanReply(next, pairs), nil
+}
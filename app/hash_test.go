@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHSetHGet(t *testing.T) {
+	kv := NewKv()
+	n, err := kv.HSet("user", "name", "ada", "lang", "go")
+	if err != nil || n != 2 {
+		t.Fatalf("HSet = %d, %v; want 2", n, err)
+	}
+	// overwriting an existing field does not count as added
+	if n, _ := kv.HSet("user", "name", "grace", "age", "36"); n != 1 {
+		t.Fatalf("expected 1 new field, got %d", n)
+	}
+	if val, ok, _ := kv.HGet("user", "name"); !ok || val != "grace" {
+		t.Fatalf("HGet name = %q, %v; want grace", val, ok)
+	}
+	if _, ok, _ := kv.HGet("user", "missing"); ok {
+		t.Fatalf("expected missing field to be absent")
+	}
+	if ok, _ := kv.HExists("user", "lang"); !ok {
+		t.Fatalf("expected lang to exist")
+	}
+	if ok, _ := kv.HExists("nohash", "lang"); ok {
+		t.Fatalf("expected field of missing key to not exist")
+	}
+}
+
+func TestHDel(t *testing.T) {
+	kv := NewKv()
+	kv.HSet("h", "a", "1", "b", "2")
+	if n, _ := kv.HDel("h", "a", "zz"); n != 1 {
+		t.Fatalf("expected 1 removed field, got %d", n)
+	}
+	if n, _ := kv.HDel("h", "b"); n != 1 {
+		t.Fatalf("expected 1 removed field, got %d", n)
+	}
+	if _, ok := kv.hashes["h"]; ok {
+		t.Fatalf("expected empty hash to be deleted")
+	}
+}
+
+func TestHashWrongType(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("list", "a")
+	if _, err := kv.HSet("list", "f", "v"); !errors.Is(err, errWrongType) {
+		t.Fatalf("expected WRONGTYPE, got %v", err)
+	}
+}
+
+func TestHGetAllKeysVals(t *testing.T) {
+	kv := NewKv()
+	kv.HSet("h", "b", "2", "a", "1", "c", "3")
+	all, _ := kv.HGetAll("h")
+	wantAll := []string{"a", "1", "b", "2", "c", "3"}
+	if len(all) != len(wantAll) {
+		t.Fatalf("HGetAll = %v, want %v", all, wantAll)
+	}
+	for i := range wantAll {
+		if all[i] != wantAll[i] {
+			t.Fatalf("HGetAll = %v, want %v", all, wantAll)
+		}
+	}
+	keys, _ := kv.HKeys("h")
+	vals, _ := kv.HVals("h")
+	for i := range keys {
+		if keys[i] != wantAll[2*i] || vals[i] != wantAll[2*i+1] {
+			t.Fatalf("HKeys/HVals = %v %v, want pairs of %v", keys, vals, wantAll)
+		}
+	}
+	if n, _ := kv.HLen("h"); n != 3 {
+		t.Fatalf("expected HLen 3, got %d", n)
+	}
+
+	if all, _ := kv.HGetAll("missing"); len(all) != 0 {
+		t.Fatalf("expected empty result for missing key, got %v", all)
+	}
+	if n, _ := kv.HLen("missing"); n != 0 {
+		t.Fatalf("expected HLen 0 for missing key, got %d", n)
+	}
+}
+
+func TestHMGet(t *testing.T) {
+	kv := NewKv()
+	kv.HSet("h", "a", "1", "c", "3")
+	vals, err := kv.HMGet("h", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("HMGet error: %v", err)
+	}
+	if len(vals) != 3 || vals[0] != "1" || vals[1] != nil || vals[2] != "3" {
+		t.Fatalf("HMGet = %v, want [1 <nil> 3]", vals)
+	}
+	resp, _ := hmget([]string{"missing", "a"}, kv)
+	if arr := resp.(Array); len(arr) != 1 || arr[0] != nil {
+		t.Fatalf("expected a single nil for missing key, got %v", resp)
+	}
+}
+
+func TestHIncrBy(t *testing.T) {
+	kv := NewKv()
+	if n, err := kv.HIncrBy("h", "views", 5); err != nil || n != 5 {
+		t.Fatalf("HIncrBy = %d, %v; want 5", n, err)
+	}
+	if n, _ := kv.HIncrBy("h", "views", -7); n != -2 {
+		t.Fatalf("expected -2, got %d", n)
+	}
+	if v, _, _ := kv.HGet("h", "views"); v != "-2" {
+		t.Fatalf("expected stored value -2, got %q", v)
+	}
+	kv.HSet("h", "name", "ada")
+	if _, err := kv.HIncrBy("h", "name", 1); err == nil {
+		t.Fatalf("expected error incrementing a non-integer field")
+	}
+	kv.HSet("h", "big", "9223372036854775807")
+	if _, err := kv.HIncrBy("h", "big", 1); err == nil {
+		t.Fatalf("expected overflow error")
+	}
+}
+
+func TestHIncrByFloat(t *testing.T) {
+	kv := NewKv()
+	kv.HSet("h", "price", "10.50")
+	f, err := kv.HIncrByFloat("h", "price", 0.1)
+	if err != nil {
+		t.Fatalf("HIncrByFloat error: %v", err)
+	}
+	if v, _, _ := kv.HGet("h", "price"); v != "10.6" || formatFloat(f) != "10.6" {
+		t.Fatalf("expected 10.6, got stored %q returned %v", v, f)
+	}
+	kv.HSet("h", "n", "5.0e3")
+	kv.HIncrByFloat("h", "n", 200)
+	if v, _, _ := kv.HGet("h", "n"); v != "5200" {
+		t.Fatalf("expected 5200 without trailing zeros, got %q", v)
+	}
+	kv.HSet("h", "name", "ada")
+	if _, err := kv.HIncrByFloat("h", "name", 1); err == nil {
+		t.Fatalf("expected error incrementing a non-float field")
+	}
+}
+
+func TestHSetNXConcurrent(t *testing.T) {
+	kv := NewKv()
+	const goroutines = 20
+	var wins int32
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func(id int) {
+			defer wg.Done()
+			ok, err := kv.HSetNX("h", "owner", strconv.Itoa(id))
+			if err != nil {
+				t.Errorf("HSetNX error: %v", err)
+			}
+			if ok {
+				atomic.AddInt32(&wins, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if wins != 1 {
+		t.Fatalf("expected exactly one winner, got %d", wins)
+	}
+	if ok, _ := kv.HSetNX("h", "owner", "late"); ok {
+		t.Fatalf("expected HSetNX on existing field to fail")
+	}
+}
+
+func TestHScanFullIteration(t *testing.T) {
+	kv := NewKv()
+	for i := 0; i < 25; i++ {
+		kv.HSet("h", "field"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	seen := make(map[string]int)
+	cursor := 0
+	for {
+		next, pairs, err := kv.HScan("h", cursor, "", 4)
+		if err != nil {
+			t.Fatalf("HScan error: %v", err)
+		}
+		for i := 0; i < len(pairs); i += 2 {
+			seen[pairs[i]]++
+			if pairs[i] != "field"+pairs[i+1] {
+				t.Fatalf("field %q paired with wrong value %q", pairs[i], pairs[i+1])
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 25 {
+		t.Fatalf("expected 25 distinct fields, got %d", len(seen))
+	}
+	for f, n := range seen {
+		if n != 1 {
+			t.Fatalf("field %q returned %d times", f, n)
+		}
+	}
+}
+
+func TestHScanMatchNoValues(t *testing.T) {
+	kv := NewKv()
+	kv.HSet("h", "name", "ada", "nick", "a", "age", "36")
+	resp, err := hscan([]string{"h", "0", "MATCH", "n*", "NOVALUES"}, kv)
+	if err != nil {
+		t.Fatalf("HSCAN error: %v", err)
+	}
+	arr := resp.(Array)
+	fields := arr[1].(Array)
+	if arr[0] != BulkString("0") || len(fields) != 2 || fields[0] != BulkString("name") || fields[1] != BulkString("nick") {
+		t.Fatalf("unexpected HSCAN reply %v", resp)
+	}
+}
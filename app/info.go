@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ServerStats holds the counters reported by INFO
+type ServerStats struct {
+	startTime        time.Time
+	connectedClients atomic.Int64
+	totalConnections atomic.Int64
+	totalCommands    atomic.Int64
+}
+
+// keyspaceStats counts the key lookups of GET and HGET that found, or did
+// not find, the key
+type keyspaceStats struct {
+	hits, misses atomic.Int64
+}
+
+// recordLookup counts a key lookup in the keyspace hits or misses
+func (k *Kv) recordLookup(found bool) {
+	if found {
+		k.stats.hits.Add(1)
+	} else {
+		k.stats.misses.Add(1)
+	}
+}
+
+// ExpiresInfo: get the number of keys with a TTL and their average TTL
+func (k *Kv) ExpiresInfo() (int, time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now()
+	var total time.Duration
+	for _, exp := range k.exp {
+		if d := exp.Sub(now); d > 0 {
+			total += d
+		}
+	}
+	if len(k.exp) == 0 {
+		return 0, 0
+	}
+	return len(k.exp), total / time.Duration(len(k.exp))
+}
+
+// ResetStats: zero the counters of INFO stats
+func (s *Server) ResetStats() {
+	s.stats.totalConnections.Store(0)
+	s.stats.totalCommands.Store(0)
+	for _, kv := range s.dbs {
+		kv.stats.hits.Store(0)
+		kv.stats.misses.Store(0)
+	}
+}
+
+// infoSections lists the INFO sections in the order they are reported
+var infoSections = []string{"server", "clients", "memory", "stats", "keyspace"}
+
+// Info: get the INFO report of the given sections. No sections, "default",
+// "all" and "everything" report every section, unknown sections are skipped.
+func (s *Server) Info(sections ...string) string {
+	want := map[string]bool{}
+	for _, section := range sections {
+		section = strings.ToLower(section)
+		if section == "default" || section == "all" || section == "everything" {
+			want = map[string]bool{}
+			break
+		}
+		want[section] = true
+	}
+	var parts []string
+	for _, section := range infoSections {
+		if len(want) > 0 && !want[section] {
+			continue
+		}
+		parts = append(parts, s.infoSection(section))
+	}
+	return strings.Join(parts, "\r\n")
+}
+
+// infoSection formats one section of the INFO report
+func (s *Server) infoSection(section string) string {
+	var b strings.Builder
+	field := func(name string, value any) {
+		fmt.Fprintf(&b, "%s:%v\r\n", name, value)
+	}
+	b.WriteString("# " + strings.ToUpper(section[:1]) + section[1:] + "\r\n")
+	switch section {
+	case "server":
+		uptime := time.Since(s.stats.startTime)
+		field("redis_version", serverVersion)
+		field("redis_mode", "standalone")
+		field("os", runtime.GOOS+" "+runtime.GOARCH)
+		field("go_version", runtime.Version())
+		field("process_id", os.Getpid())
+		field("tcp_port", 6379)
+		field("uptime_in_seconds", int64(uptime/time.Second))
+		field("uptime_in_days", int64(uptime/(24*time.Hour)))
+	case "clients":
+		blocked := 0
+		for _, kv := range s.dbs {
+			blocked += kv.BlockedClients()
+		}
+		field("connected_clients", s.stats.connectedClients.Load())
+		field("blocked_clients", blocked)
+	case "memory":
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		field("used_memory", m.HeapAlloc)
+		field("used_memory_rss", m.Sys)
+	case "stats":
+		var hits, misses int64
+		for _, kv := range s.dbs {
+			hits += kv.stats.hits.Load()
+			misses += kv.stats.misses.Load()
+		}
+		field("total_connections_received", s.stats.totalConnections.Load())
+		field("total_commands_processed", s.stats.totalCommands.Load())
+		field("keyspace_hits", hits)
+		field("keyspace_misses", misses)
+	case "keyspace":
+		for i, kv := range s.dbs {
+			keys := kv.DBSize()
+			if keys == 0 {
+				continue
+			}
+			expires, avgTTL := kv.ExpiresInfo()
+			field(fmt.Sprintf("db%d", i), fmt.Sprintf("keys=%d,expires=%d,avg_ttl=%d", keys, expires, avgTTL.Milliseconds()))
+		}
+	}
+	return b.String()
+}
+
+// Handlers for server commands
+
+func info(args []string, c *client) (RespValue, error) {
+	return BulkString(c.srv.Info(args...)), nil
+}
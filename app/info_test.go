@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// infoFields parses an INFO report into its fields, keyed by name
+func infoFields(report string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(report, "\r\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+func TestInfoSections(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	report := srv.Info()
+	for _, header := range []string{"# Server", "# Clients", "# Memory", "# Stats", "# Keyspace"} {
+		if !strings.Contains(report, header+"\r\n") {
+			t.Fatalf("INFO has no %q section:\n%s", header, report)
+		}
+	}
+	if all := srv.Info("everything"); strings.Count(all, "# ") != 5 {
+		t.Fatalf("INFO everything = %q, want every section", all)
+	}
+	fields := infoFields(report)
+	for _, name := range []string{"redis_version", "os", "uptime_in_seconds", "connected_clients", "blocked_clients", "used_memory", "used_memory_rss", "total_commands_processed", "keyspace_hits", "keyspace_misses"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("INFO has no %s field:\n%s", name, report)
+		}
+	}
+
+	memory := srv.Info("MEMORY")
+	if !strings.HasPrefix(memory, "# Memory\r\n") || strings.Contains(memory, "# Server") {
+		t.Fatalf("INFO memory = %q", memory)
+	}
+	if two := srv.Info("server", "clients"); strings.Count(two, "# ") != 2 {
+		t.Fatalf("INFO server clients = %q, want two sections", two)
+	}
+	if got := srv.Info("nosuchsection"); got != "" {
+		t.Fatalf("INFO nosuchsection = %q, want empty", got)
+	}
+}
+
+func TestInfoKeyspace(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	srv.dbs[0].Set("a", "1")
+	srv.dbs[0].SetWithTTL("b", "2", time.Hour)
+	srv.dbs[0].RPush("list", "x")
+	srv.dbs[5].HSet("h", "f", "v")
+	fields := infoFields(srv.Info("keyspace"))
+	if len(fields) != 2 {
+		t.Fatalf("keyspace fields = %v, want db0 and db5", fields)
+	}
+	if !strings.HasPrefix(fields["db0"], "keys=3,expires=1,avg_ttl=") {
+		t.Fatalf("db0 = %q, want keys=3,expires=1", fields["db0"])
+	}
+	if fields["db5"] != "keys=1,expires=0,avg_ttl=0" {
+		t.Fatalf("db5 = %q, want keys=1,expires=0,avg_ttl=0", fields["db5"])
+	}
+}
+
+func TestInfoStats(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	kv := srv.dbs[0]
+	kv.Set("k", "v")
+	kv.HSet("h", "f", "v")
+	kv.Get("k")
+	kv.Get("missing")
+	kv.HGet("h", "other")
+	srv.dbs[1].Get("missing")
+	fields := infoFields(srv.Info("stats"))
+	if fields["keyspace_hits"] != "2" || fields["keyspace_misses"] != "2" {
+		t.Fatalf("hits = %s, misses = %s; want 2 and 2", fields["keyspace_hits"], fields["keyspace_misses"])
+	}
+
+	go blpop([]string{"list1", "list2", "0"}, kv)
+	waitBlocked(t, kv, "list2", 1)
+	if got := infoFields(srv.Info("clients"))["blocked_clients"]; got != "1" {
+		t.Fatalf("blocked_clients = %s, want 1", got)
+	}
+	kv.RPush("list1", "x")
+}
+
+func TestInfoClientCounters(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	server, conn := net.Pipe()
+	defer conn.Close()
+	go handleClient(server, srv)
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+		r.ReadString('\n')
+	}
+	fields := infoFields(srv.Info())
+	if fields["connected_clients"] != "1" || fields["total_connections_received"] != "1" {
+		t.Fatalf("connected_clients = %s, total_connections_received = %s; want 1 and 1", fields["connected_clients"], fields["total_connections_received"])
+	}
+	if fields["total_commands_processed"] != "2" {
+		t.Fatalf("total_commands_processed = %s, want 2", fields["total_commands_processed"])
+	}
+
+	conn.Write([]byte("*1\r\n$4\r\nINFO\r\n"))
+	if line, _ := r.ReadString('\n'); !strings.HasPrefix(line, "$") {
+		t.Fatalf("INFO reply = %q, want a bulk string", line)
+	}
+}
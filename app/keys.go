@@ -0,0 +1,585 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// generic key operations, valid whatever the type of the value
+
+// Del: delete keys, returning the number of keys that existed
+func (k *Kv) Del(keys []string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	n := 0
+	for _, key := range keys {
+		if k.typeOf(key) != "none" {
+			n++
+		}
+		k.deleteLocked(key)
+	}
+	return n
+}
+
+// Exists: count the keys that exist, a key given several times counting
+// each time
+func (k *Kv) Exists(keys []string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	n := 0
+	for _, key := range keys {
+		if k.typeOf(key) != "none" {
+			n++
+		}
+	}
+	return n
+}
+
+// ExpireOption holds the conditions of EXPIRE and its variants. A key
+// without an expiry counts as having an infinite TTL for GT and LT.
+type ExpireOption struct {
+	NX bool // only when the key has no expiry
+	XX bool // only when the key already has an expiry
+	GT bool // only when the new expiry is later than the current one
+	LT bool // only when the new expiry is earlier than the current one
+}
+
+// Expire: set the TTL of key to d if the key exists and the conditions of opt
+// hold, reporting whether it did. A TTL that is not positive deletes the key
+// right away.
+func (k *Kv) Expire(key string, d time.Duration, opt ExpireOption) bool {
+	return k.ExpireAt(key, time.Now().Add(d), opt)
+}
+
+// ExpireAt: make key expire at t if the key exists and the conditions of opt
+// hold, reporting whether it did. A time that has already passed deletes the
+// key right away.
+func (k *Kv) ExpireAt(key string, t time.Time, opt ExpireOption) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.typeOf(key) == "none" {
+		return false
+	}
+	cur, hasTTL := k.exp[key]
+	switch {
+	case opt.NX && hasTTL,
+		opt.XX && !hasTTL,
+		opt.GT && (!hasTTL || !t.After(cur)),
+		opt.LT && hasTTL && !t.Before(cur):
+		return false
+	}
+	if !t.After(time.Now()) {
+		k.deleteLocked(key)
+		return true
+	}
+	k.exp[key] = t
+	return true
+}
+
+// Persist: remove the expiry of key, reporting whether it had one
+func (k *Kv) Persist(key string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.typeOf(key) == "none" {
+		return false
+	}
+	if _, ok := k.exp[key]; !ok {
+		return false
+	}
+	delete(k.exp, key)
+	return true
+}
+
+// sentinels returned by TTL
+const (
+	ttlNone    time.Duration = -1 // the key has no expiry
+	ttlMissing time.Duration = -2 // the key does not exist
+)
+
+// TTL: get the remaining time to live of key, or ttlNone / ttlMissing
+func (k *Kv) TTL(key string) time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.typeOf(key) == "none" {
+		return ttlMissing
+	}
+	expTime, ok := k.exp[key]
+	if !ok {
+		return ttlNone
+	}
+	return time.Until(expTime)
+}
+
+// Type: get the type name of the value stored at key, or "none"
+func (k *Kv) Type(key string) string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.typeOf(key)
+}
+
+// keysLocked returns every live key in the store, sorted. Expired keys are
+// deleted along the way. Callers must hold k.mu.
+func (k *Kv) keysLocked() []string {
+	var keys []string
+	seen := func(key string) {
+		if !k.expireLocked(key) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range k.data {
+		seen(key)
+	}
+	for key := range k.lists {
+		seen(key)
+	}
+	for key := range k.hashes {
+		seen(key)
+	}
+	for key := range k.sets {
+		seen(key)
+	}
+	for key := range k.zsets {
+		seen(key)
+	}
+	for key := range k.streams {
+		seen(key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Keys: get the keys matching the glob-style pattern, sorted. This walks the
+// whole keyspace while holding the lock, so it blocks every other client
+// for O(N); SCAN is the incremental alternative.
+func (k *Kv) Keys(pattern string) []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := []string{}
+	for _, key := range k.keysLocked() {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Scan: iterate over the keyspace in key order, examining count keys from
+// the cursor on and keeping those matching match and holding a value of type
+// typeFilter (either may be empty to keep all). Returns the cursor of the
+// next call (0 once done) and the kept keys.
+func (k *Kv) Scan(cursor int, match string, count int, typeFilter string) (int, []string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := k.keysLocked()
+	next, lo, hi := scanBounds(len(keys), cursor, count)
+	out := make([]string, 0, hi-lo)
+	for _, key := range keys[lo:hi] {
+		if match != "" && !globMatch(match, key) {
+			continue
+		}
+		if typeFilter != "" && k.typeOf(key) != typeFilter {
+			continue
+		}
+		out = append(out, key)
+	}
+	return next, out
+}
+
+// RandomKey: get a random key from the keyspace, if it is not empty
+func (k *Kv) RandomKey() (string, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := k.keysLocked()
+	if len(keys) == 0 {
+		return "", false
+	}
+	return keys[rand.Intn(len(keys))], true
+}
+
+// DBSize: get the number of keys in the database. Every key lives in the
+// map of its type only, so the sizes add up without double counting.
+func (k *Kv) DBSize() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.data) + len(k.lists) + len(k.hashes) + len(k.sets) + len(k.zsets) + len(k.streams)
+}
+
+// FlushDB: delete every key in the database. Clients blocked on a key keep
+// waiting for it. Only empty maps are swapped in under the lock, so this is
+// O(1) whatever the size of the database: the old maps are reclaimed by the
+// garbage collector in the background.
+func (k *Kv) FlushDB() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.data = make(map[string]string)
+	k.exp = make(map[string]time.Time)
+	k.lists = make(map[string][]string)
+	k.hashes = make(map[string]map[string]string)
+	k.sets = make(map[string]map[string]struct{})
+	k.zsets = make(map[string]*SortedSet)
+	k.streams = make(map[string]*Stream)
+	k.accessed = make(map[string]time.Time)
+	for key := range k.waiters {
+		k.wake(key)
+	}
+}
+
+// Copy: copy the value stored at src, along with its TTL, to dst. Unless
+// replace is set nothing is copied when dst already exists. Reports whether
+// the value was copied.
+func (k *Kv) Copy(src, dst string, replace bool) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return copyLocked(k, src, k, dst, replace)
+}
+
+// copyLocked copies src in from to dst in to. Callers must hold both locks.
+func copyLocked(from *Kv, src string, to *Kv, dst string, replace bool) bool {
+	typ := from.typeOf(src)
+	if typ == "none" {
+		return false
+	}
+	if to.typeOf(dst) != "none" {
+		if !replace {
+			return false
+		}
+		to.deleteLocked(dst)
+	}
+	switch typ {
+	case "string":
+		to.data[dst] = from.data[src]
+	case "list":
+		to.lists[dst] = append([]string(nil), from.lists[src]...)
+	case "hash":
+		h := make(map[string]string, len(from.hashes[src]))
+		for f, v := range from.hashes[src] {
+			h[f] = v
+		}
+		to.hashes[dst] = h
+	case "set":
+		set := make(map[string]struct{}, len(from.sets[src]))
+		for m := range from.sets[src] {
+			set[m] = struct{}{}
+		}
+		to.sets[dst] = set
+	case "zset":
+		to.zsets[dst] = from.zsets[src].Clone()
+	case "stream":
+		to.streams[dst] = from.streams[src].Clone()
+	}
+	if expTime, ok := from.exp[src]; ok {
+		to.exp[dst] = expTime
+	}
+	to.wake(dst)
+	return true
+}
+
+// IdleTime: get the time since key was last read or written. Keys created
+// or replaced without a recorded access count as just accessed, and their
+// idle time runs from then.
+func (k *Kv) IdleTime(key string) (time.Duration, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.typeOf(key) == "none" {
+		return 0, false
+	}
+	at, ok := k.accessed[key]
+	if !ok {
+		k.accessed[key] = time.Now()
+		return 0, true
+	}
+	return time.Since(at), true
+}
+
+// Handlers for generic key commands
+
+func del(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("DEL requires at least one argument")
+	}
+	return integer(kv.Del(args)), nil
+}
+
+func exists(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("EXISTS requires at least one argument")
+	}
+	return integer(kv.Exists(args)), nil
+}
+
+func expire(args []string, kv *Kv) (RespValue, error) {
+	return expireCmd(args, kv, "expire", func(n int64) (time.Time, bool) {
+		if n > math.MaxInt64/int64(time.Second) || n < math.MinInt64/int64(time.Second) {
+			return time.Time{}, false
+		}
+		return time.Now().Add(time.Duration(n) * time.Second), true
+	})
+}
+
+func pexpire(args []string, kv *Kv) (RespValue, error) {
+	return expireCmd(args, kv, "pexpire", func(n int64) (time.Time, bool) {
+		if n > math.MaxInt64/int64(time.Millisecond) || n < math.MinInt64/int64(time.Millisecond) {
+			return time.Time{}, false
+		}
+		return time.Now().Add(time.Duration(n) * time.Millisecond), true
+	})
+}
+
+func expireat(args []string, kv *Kv) (RespValue, error) {
+	return expireCmd(args, kv, "expireat", func(n int64) (time.Time, bool) {
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return time.Time{}, false
+		}
+		return time.Unix(n, 0), true
+	})
+}
+
+func pexpireat(args []string, kv *Kv) (RespValue, error) {
+	return expireCmd(args, kv, "pexpireat", func(n int64) (time.Time, bool) {
+		return time.UnixMilli(n), true
+	})
+}
+
+// expireCmd implements EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT:
+// key time [NX | XX] [GT | LT], with toTime converting the time argument to
+// an absolute expiry time and reporting whether it is in range
+func expireCmd(args []string, kv *Kv, cmd string, toTime func(int64) (time.Time, bool)) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("%s requires at least two arguments", strings.ToUpper(cmd))
+	}
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	var opt ExpireOption
+	for _, arg := range args[2:] {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			opt.NX = true
+		case "XX":
+			opt.XX = true
+		case "GT":
+			opt.GT = true
+		case "LT":
+			opt.LT = true
+		default:
+			return nil, fmt.Errorf("Unsupported option %s", arg)
+		}
+	}
+	if opt.NX && (opt.XX || opt.GT || opt.LT) {
+		return nil, errors.New("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if opt.GT && opt.LT {
+		return nil, errors.New("GT and LT options at the same time are not compatible")
+	}
+	t, ok := toTime(n)
+	if !ok {
+		return nil, fmt.Errorf("invalid expire time in '%s' command", cmd)
+	}
+	return boolInt(kv.ExpireAt(args[0], t, opt)), nil
+}
+
+func ttl(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("TTL requires exactly one argument")
+	}
+	return ttlCmd(args[0], kv, time.Second), nil
+}
+
+func pttl(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("PTTL requires exactly one argument")
+	}
+	return ttlCmd(args[0], kv, time.Millisecond), nil
+}
+
+// ttlCmd implements TTL and PTTL, rounding the remaining time to unit
+func ttlCmd(key string, kv *Kv, unit time.Duration) RespValue {
+	d := kv.TTL(key)
+	if d == ttlNone || d == ttlMissing {
+		return integer(d)
+	}
+	return integer((d + unit/2) / unit)
+}
+
+func persist(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("PERSIST requires exactly one argument")
+	}
+	return boolInt(kv.Persist(args[0])), nil
+}
+
+func typeCmd(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("TYPE requires exactly one argument")
+	}
+	return SimpleString(kv.Type(args[0])), nil
+}
+
+func keysCmd(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("KEYS requires exactly one argument")
+	}
+	return bulkArray(kv.Keys(args[0])), nil
+}
+
+func scan(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("SCAN requires at least one argument")
+	}
+	opts, err := parseScanArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if opts.noValues {
+		return nil, errors.New("syntax error")
+	}
+	next, keys := kv.Scan(opts.cursor, opts.match, opts.count, opts.typ)
+	return scanReply(next, keys), nil
+}
+
+func randomkey(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 0 {
+		return nil, errors.New("RANDOMKEY takes no arguments")
+	}
+	key, ok := kv.RandomKey()
+	if !ok {
+		return nil, nil
+	}
+	return BulkString(key), nil
+}
+
+func dbsize(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 0 {
+		return nil, errors.New("DBSIZE takes no arguments")
+	}
+	return integer(kv.DBSize()), nil
+}
+
+// parseFlushMode checks the ASYNC|SYNC option of FLUSHDB and FLUSHALL
+func parseFlushMode(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if len(args) > 1 || !strings.EqualFold(args[0], "ASYNC") && !strings.EqualFold(args[0], "SYNC") {
+		return errors.New("syntax error")
+	}
+	return nil
+}
+
+func flushdb(args []string, kv *Kv) (RespValue, error) {
+	// the flush is O(1) and the memory is freed in the background, so
+	// ASYNC only has to be accepted. Replying before the flush would let it
+	// wipe the client's next writes.
+	if err := parseFlushMode(args); err != nil {
+		return nil, err
+	}
+	kv.FlushDB()
+	return SimpleString("OK"), nil
+}
+
+func flushall(args []string, c *client) (RespValue, error) {
+	// flushed synchronously, as FLUSHDB ASYNC
+	if err := parseFlushMode(args); err != nil {
+		return nil, err
+	}
+	c.srv.FlushAll()
+	return SimpleString("OK"), nil
+}
+
+func copyCmd(args []string, c *client) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("COPY requires at least two arguments")
+	}
+	replace := false
+	db := c.db
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return nil, errors.New("syntax error")
+			}
+			var err error
+			if db, err = parseDB(args[i+1]); err != nil {
+				return nil, err
+			}
+			i++
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	if db == c.db && args[0] == args[1] {
+		return nil, errors.New("source and destination objects are the same")
+	}
+	return boolInt(c.srv.Copy(c.db, db, args[0], args[1], replace)), nil
+}
+
+func move(args []string, c *client) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("MOVE requires exactly two arguments")
+	}
+	db, err := parseDB(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if db == c.db {
+		return nil, errors.New("source and destination objects are the same")
+	}
+	return boolInt(c.srv.Move(c.db, db, args[0])), nil
+}
+
+var objectHelp = []string{
+	"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"FREQ <key>",
+	"    Return the access frequency index of the key. The returned integer is",
+	"    proportional to the logarithm of the recent access frequency of the key.",
+	"IDLETIME <key>",
+	"    Return the idle time of the key, that is the approximated number of",
+	"    seconds elapsed since the last access to the key.",
+	"REFCOUNT <key>",
+	"    Return the number of references of the value associated with the specified",
+	"    key.",
+	"HELP",
+	"    Print this help.",
+}
+
+func object(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("OBJECT requires a subcommand")
+	}
+	sub := strings.ToUpper(args[0])
+	if sub == "HELP" {
+		if len(args) != 1 {
+			return nil, errors.New("OBJECT HELP takes no arguments")
+		}
+		return bulkArray(objectHelp), nil
+	}
+	if sub != "FREQ" && sub != "IDLETIME" && sub != "REFCOUNT" {
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try OBJECT HELP.", args[0])
+	}
+	if len(args) != 2 {
+		return nil, fmt.Errorf("OBJECT %s requires exactly one argument", sub)
+	}
+	idle, ok := kv.IdleTime(args[1])
+	if !ok {
+		return nil, nil
+	}
+	switch sub {
+	case "IDLETIME":
+		return integer(idle / time.Second), nil
+	case "REFCOUNT":
+		// values are never shared between keys
+		return integer(1), nil
+	default:
+		// no LFU eviction policy, so access frequencies are not tracked
+		return integer(0), nil
+	}
+}
@@ -0,0 +1,653 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDel(t *testing.T) {
+	kv := NewKv()
+	kv.Set("str", "v")
+	kv.RPush("list", "a")
+	kv.HSet("hash", "f", "v")
+	kv.SAdd("set", "m")
+	kv.ZAdd("zset", ZAddOpts{}, zsetEntry{1, "m"})
+	kv.SetWithTTL("expired", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	keys := []string{"str", "list", "hash", "set", "zset", "missing", "expired"}
+	if n := kv.Del(keys); n != 5 {
+		t.Fatalf("Del = %d, want 5", n)
+	}
+	for _, key := range keys {
+		if typ := kv.typeOf(key); typ != "none" {
+			t.Fatalf("expected %q to be deleted, found %s", key, typ)
+		}
+	}
+	if _, ok := kv.exp["expired"]; ok {
+		t.Fatalf("expected expiry of deleted key to be removed")
+	}
+	if resp, _ := del([]string{"str"}, kv); resp != integer(0) {
+		t.Fatalf("DEL of deleted key = %v, want 0", resp)
+	}
+}
+
+func TestExists(t *testing.T) {
+	kv := NewKv()
+	kv.Set("a", "1")
+	kv.SAdd("s", "m")
+	kv.SetWithTTL("expired", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if n := kv.Exists([]string{"a", "a", "s", "missing", "expired"}); n != 3 {
+		t.Fatalf("Exists with repeated key = %d, want 3", n)
+	}
+	if resp, _ := exists([]string{"x", "y", "expired"}, kv); resp != integer(0) {
+		t.Fatalf("EXISTS of absent keys = %v, want 0", resp)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	kv := NewKv()
+	if resp, _ := expire([]string{"missing", "10"}, kv); resp != integer(0) {
+		t.Fatalf("EXPIRE on missing key = %v, want 0", resp)
+	}
+	kv.Set("k", "v")
+	if resp, _ := pexpire([]string{"k", "30"}, kv); resp != integer(1) {
+		t.Fatalf("PEXPIRE = %v, want 1", resp)
+	}
+	if _, ok, _ := kv.Get("k"); !ok {
+		t.Fatalf("expected k to exist before its expiry")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok, _ := kv.Get("k"); ok {
+		t.Fatalf("expected k to have expired")
+	}
+
+	// the TTL applies to keys of any type
+	kv.RPush("list", "a")
+	kv.Expire("list", 10*time.Millisecond, ExpireOption{})
+	time.Sleep(20 * time.Millisecond)
+	if n, _ := kv.LLen("list"); n != 0 {
+		t.Fatalf("expected list to have expired, LLEN = %d", n)
+	}
+	if _, ok := kv.exp["list"]; ok {
+		t.Fatalf("expected expiry of expired list to be removed")
+	}
+
+	kv.Set("k", "v")
+	expire([]string{"k", "100"}, kv)
+	if ttl := time.Until(kv.exp["k"]); ttl <= 99*time.Second || ttl > 100*time.Second {
+		t.Fatalf("EXPIRE ttl = %v, want about 100s", ttl)
+	}
+	// a negative TTL deletes the key
+	if resp, _ := expire([]string{"k", "-1"}, kv); resp != integer(1) {
+		t.Fatalf("EXPIRE with negative ttl = %v, want 1", resp)
+	}
+	if n := kv.Exists([]string{"k"}); n != 0 {
+		t.Fatalf("expected k to be deleted")
+	}
+	if _, err := expire([]string{"k", "soon"}, kv); err == nil {
+		t.Fatalf("expected error for non-integer ttl")
+	}
+}
+
+func TestExpireAt(t *testing.T) {
+	kv := NewKv()
+	kv.Set("past", "v")
+	past := strconv.FormatInt(time.Now().Add(-2*time.Second).Unix(), 10)
+	if resp, _ := expireat([]string{"past", past}, kv); resp != integer(1) {
+		t.Fatalf("EXPIREAT in the past = %v, want 1", resp)
+	}
+	if _, ok, _ := kv.Get("past"); ok {
+		t.Fatalf("expected key with past expiry to be gone")
+	}
+
+	kv.Set("future", "v")
+	at := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	if resp, _ := pexpireat([]string{"future", strconv.FormatInt(at.UnixMilli(), 10)}, kv); resp != integer(1) {
+		t.Fatalf("PEXPIREAT = %v, want 1", resp)
+	}
+	if !kv.exp["future"].Equal(at) {
+		t.Fatalf("PEXPIREAT expiry = %v, want %v", kv.exp["future"], at)
+	}
+	if _, ok, _ := kv.Get("future"); !ok {
+		t.Fatalf("expected key with future expiry to be accessible")
+	}
+	if kv.ExpireAt("missing", at, ExpireOption{}) {
+		t.Fatalf("expected ExpireAt on missing key to fail")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	kv := NewKv()
+	if resp, _ := ttl([]string{"missing"}, kv); resp != integer(-2) {
+		t.Fatalf("TTL of missing key = %v, want -2", resp)
+	}
+	kv.Set("k", "v")
+	if resp, _ := pttl([]string{"k"}, kv); resp != integer(-1) {
+		t.Fatalf("PTTL of key without expiry = %v, want -1", resp)
+	}
+	kv.Expire("k", 100*time.Second, ExpireOption{})
+	if resp, _ := ttl([]string{"k"}, kv); resp != integer(100) {
+		t.Fatalf("TTL = %v, want 100", resp)
+	}
+	if resp := ttlCmd("k", kv, time.Millisecond).(integer); resp <= 99000 || resp > 100000 {
+		t.Fatalf("PTTL = %v, want about 100000", resp)
+	}
+
+	kv.SetWithTTL("gone", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if d := kv.TTL("gone"); d != ttlMissing {
+		t.Fatalf("TTL of expired key = %v, want ttlMissing", d)
+	}
+	if _, ok := kv.data["gone"]; ok {
+		t.Fatalf("expected TTL to delete the expired key")
+	}
+}
+
+func TestPersist(t *testing.T) {
+	kv := NewKv()
+	kv.SetWithTTL("k", "v", 100*time.Millisecond)
+	if resp, _ := persist([]string{"k"}, kv); resp != integer(1) {
+		t.Fatalf("PERSIST = %v, want 1", resp)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if _, ok, _ := kv.Get("k"); !ok {
+		t.Fatalf("expected persisted key to survive its old TTL")
+	}
+	if kv.Persist("k") {
+		t.Fatalf("expected Persist on key without expiry to fail")
+	}
+	if kv.Persist("missing") {
+		t.Fatalf("expected Persist on missing key to fail")
+	}
+}
+
+func TestExpireOptions(t *testing.T) {
+	kv := NewKv()
+	kv.Set("k", "v")
+	if resp, _ := expire([]string{"k", "100", "XX"}, kv); resp != integer(0) {
+		t.Fatalf("EXPIRE XX without expiry = %v, want 0", resp)
+	}
+	// no expiry counts as an infinite TTL
+	if resp, _ := expire([]string{"k", "100", "GT"}, kv); resp != integer(0) {
+		t.Fatalf("EXPIRE GT without expiry = %v, want 0", resp)
+	}
+	if resp, _ := expire([]string{"k", "100", "NX"}, kv); resp != integer(1) {
+		t.Fatalf("EXPIRE NX without expiry = %v, want 1", resp)
+	}
+	if resp, _ := expire([]string{"k", "200", "NX"}, kv); resp != integer(0) {
+		t.Fatalf("EXPIRE NX with expiry = %v, want 0", resp)
+	}
+	if resp, _ := expire([]string{"k", "50", "GT"}, kv); resp != integer(0) {
+		t.Fatalf("EXPIRE GT with a shorter TTL = %v, want 0", resp)
+	}
+	if resp, _ := expire([]string{"k", "200", "gt"}, kv); resp != integer(1) {
+		t.Fatalf("EXPIRE GT with a longer TTL = %v, want 1", resp)
+	}
+	if resp, _ := pexpire([]string{"k", "300000", "LT"}, kv); resp != integer(0) {
+		t.Fatalf("PEXPIRE LT with a longer TTL = %v, want 0", resp)
+	}
+	if resp, _ := expire([]string{"k", "50", "XX", "LT"}, kv); resp != integer(1) {
+		t.Fatalf("EXPIRE XX LT with a shorter TTL = %v, want 1", resp)
+	}
+	if d := kv.TTL("k"); d > 50*time.Second || d < 49*time.Second {
+		t.Fatalf("TTL = %v, want about 50s", d)
+	}
+
+	kv.Set("persistent", "v")
+	at := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	if resp, _ := expireat([]string{"persistent", at, "LT"}, kv); resp != integer(1) {
+		t.Fatalf("EXPIREAT LT without expiry = %v, want 1", resp)
+	}
+
+	for _, args := range [][]string{{"k", "10", "NX", "XX"}, {"k", "10", "GT", "LT"}, {"k", "10", "NX", "GT"}, {"k", "10", "SOON"}} {
+		if _, err := expire(args, kv); err == nil {
+			t.Fatalf("expected error for EXPIRE %v", args)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	kv := NewKv()
+	kv.Set("str", "v")
+	kv.RPush("list", "a")
+	kv.HSet("hash", "f", "v")
+	kv.SAdd("set", "m")
+	kv.ZAdd("zset", ZAddOpts{}, zsetEntry{1, "m"})
+	for key, want := range map[string]string{
+		"str": "string", "list": "list", "hash": "hash", "set": "set", "zset": "zset", "missing": "none",
+	} {
+		if got := kv.Type(key); got != want {
+			t.Fatalf("Type(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if resp, _ := typeCmd([]string{"zset"}, kv); resp != SimpleString("zset") {
+		t.Fatalf("TYPE reply = %v, want zset", resp)
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("list", "a")
+	kv.Set("str", "v")
+	if _, err := get([]string{"list"}, kv); !errors.Is(err, errWrongType) {
+		t.Fatalf("GET on list err = %v, want WRONGTYPE", err)
+	}
+	if _, err := lrange([]string{"str", "0", "-1"}, kv); !errors.Is(err, errWrongType) {
+		t.Fatalf("LRANGE on string err = %v, want WRONGTYPE", err)
+	}
+	if _, err := lpop([]string{"str"}, kv); !errors.Is(err, errWrongType) {
+		t.Fatalf("LPOP on string err = %v, want WRONGTYPE", err)
+	}
+	// SET replaces a value of any type
+	if resp, err := set([]string{"list", "v"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("SET over list = %v, %v; want OK", resp, err)
+	}
+	if typ := kv.Type("list"); typ != "string" {
+		t.Fatalf("type after SET = %q, want string", typ)
+	}
+	if _, ok := kv.lists["list"]; ok {
+		t.Fatalf("expected SET to remove the old list")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	kv := NewKv()
+	kv.Set("hello", "1")
+	kv.Set("hallo", "2")
+	kv.RPush("hxllo", "3")
+	kv.SAdd("hllo", "4")
+	kv.HSet("heeello", "f", "5")
+	kv.SetWithTTL("hexpired", "6", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*", []string{"hallo", "heeello", "hello", "hllo", "hxllo"}},
+		{"h?llo", []string{"hallo", "hello", "hxllo"}},
+		{"h*llo", []string{"hallo", "heeello", "hello", "hllo", "hxllo"}},
+		{"h[ae]llo", []string{"hallo", "hello"}},
+		{"h[^e]llo", []string{"hallo", "hxllo"}},
+		{"h[a-b]llo", []string{"hallo"}},
+		{"nomatch*", []string{}},
+	}
+	for _, tt := range tests {
+		if got := kv.Keys(tt.pattern); !equalStrings(got, tt.want) {
+			t.Fatalf("Keys(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestScanFullIteration(t *testing.T) {
+	kv := NewKv()
+	for i := 0; i < 23; i++ {
+		kv.Set("key:"+strconv.Itoa(i), "v")
+	}
+	kv.RPush("list", "a")
+	kv.SAdd("set", "m")
+	seen := make(map[string]int)
+	cursor, calls := 0, 0
+	for {
+		resp, err := scan([]string{strconv.Itoa(cursor), "COUNT", "3"}, kv)
+		if err != nil {
+			t.Fatalf("SCAN error: %v", err)
+		}
+		arr := resp.(Array)
+		for _, key := range arr[1].(Array) {
+			seen[string(key.(BulkString))]++
+		}
+		calls++
+		next, _ := strconv.Atoi(string(arr[0].(BulkString)))
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 25 || calls != 9 {
+		t.Fatalf("expected 25 keys over 9 calls, got %d over %d", len(seen), calls)
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Fatalf("key %q returned %d times", key, n)
+		}
+	}
+}
+
+func TestScanMatch(t *testing.T) {
+	kv := NewKv()
+	kv.Set("user:1", "a")
+	kv.Set("user:2", "b")
+	kv.Set("order:1", "c")
+	next, keys := kv.Scan(0, "user:*", 10, "")
+	if next != 0 || !equalStrings(keys, []string{"user:1", "user:2"}) {
+		t.Fatalf("Scan MATCH = %d, %v; want 0, [user:1 user:2]", next, keys)
+	}
+	if _, err := scan([]string{"0", "NOVALUES"}, kv); err == nil {
+		t.Fatalf("expected syntax error for NOVALUES")
+	}
+	// a huge COUNT must not overflow the end of the page
+	resp, err := scan([]string{"1", "COUNT", "9223372036854775807"}, kv)
+	if err != nil || resp.(Array)[0] != BulkString("0") || len(resp.(Array)[1].(Array)) != 2 {
+		t.Fatalf("SCAN 1 COUNT MaxInt64 = %v, %v; want the last two keys", resp, err)
+	}
+}
+
+func TestScanType(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("list:1", "a")
+	kv.RPush("list:2", "b")
+	kv.RPush("other", "c")
+	kv.Set("list:str", "v")
+	kv.HSet("list:hash", "f", "v")
+	if _, keys := kv.Scan(0, "", 100, "list"); !equalStrings(keys, []string{"list:1", "list:2", "other"}) {
+		t.Fatalf("Scan TYPE list = %v", keys)
+	}
+	resp, err := scan([]string{"0", "MATCH", "list:*", "TYPE", "LIST"}, kv)
+	if err != nil {
+		t.Fatalf("SCAN error: %v", err)
+	}
+	if keys := resp.(Array)[1].(Array); len(keys) != 2 || keys[0] != BulkString("list:1") || keys[1] != BulkString("list:2") {
+		t.Fatalf("SCAN MATCH TYPE = %v", keys)
+	}
+	if _, err := hscan([]string{"list:hash", "0", "TYPE", "hash"}, kv); err == nil {
+		t.Fatalf("expected HSCAN to reject TYPE")
+	}
+}
+
+func TestRandomKey(t *testing.T) {
+	kv := NewKv()
+	if resp, err := randomkey(nil, kv); resp != nil || err != nil {
+		t.Fatalf("RANDOMKEY on empty store = %v, %v; want nil", resp, err)
+	}
+	kv.Set("a", "1")
+	kv.RPush("b", "x")
+	kv.SAdd("c", "m")
+	kv.HSet("d", "f", "v")
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key, ok := kv.RandomKey()
+		if !ok {
+			t.Fatalf("expected a key from a populated store")
+		}
+		seen[key] = true
+	}
+	if len(seen) != 4 {
+		t.Fatalf("expected all 4 keys to be returned over 1000 calls, got %v", seen)
+	}
+}
+
+func TestDBSize(t *testing.T) {
+	kv := NewKv()
+	if resp, _ := dbsize(nil, kv); resp != integer(0) {
+		t.Fatalf("DBSIZE of empty store = %v, want 0", resp)
+	}
+	kv.Set("str", "v")
+	kv.RPush("list", "a", "b")
+	kv.HSet("hash", "f", "v", "g", "w")
+	kv.SAdd("set", "m", "n")
+	kv.ZAdd("zset", ZAddOpts{}, zsetEntry{1, "m"}, zsetEntry{2, "n"})
+	kv.XAdd("stream", StreamID{}, XAddOpts{AutoID: true}, []string{"f", "v"})
+	// overwriting a key of another type keeps it counted once
+	kv.Set("list", "v")
+	if resp, _ := dbsize(nil, kv); resp != integer(6) {
+		t.Fatalf("DBSIZE = %v, want 6", resp)
+	}
+	kv.Del([]string{"hash", "set"})
+	if n := kv.DBSize(); n != 4 {
+		t.Fatalf("DBSize = %d after DEL, want 4", n)
+	}
+	if _, err := dbsize([]string{"x"}, kv); err == nil {
+		t.Fatalf("DBSIZE with an argument succeeded")
+	}
+}
+
+// fillAllTypes stores a key of every type in kv
+func fillAllTypes(kv *Kv) {
+	kv.SetWithTTL("str", "v", time.Hour)
+	kv.RPush("list", "a", "b")
+	kv.HSet("hash", "f", "v")
+	kv.SAdd("set", "m")
+	kv.ZAdd("zset", ZAddOpts{}, zsetEntry{1, "m"})
+	kv.XAdd("stream", StreamID{}, XAddOpts{AutoID: true}, []string{"f", "v"})
+}
+
+func TestFlushDB(t *testing.T) {
+	kv := NewKv()
+	fillAllTypes(kv)
+	if resp, err := flushdb([]string{"sync"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("FLUSHDB SYNC = %v, %v; want OK", resp, err)
+	}
+	if n := kv.DBSize(); n != 0 {
+		t.Fatalf("DBSize = %d after FLUSHDB, want 0", n)
+	}
+	for _, key := range []string{"str", "list", "hash", "set", "zset", "stream"} {
+		if typ := kv.Type(key); typ != "none" {
+			t.Fatalf("TYPE %s = %s after FLUSHDB, want none", key, typ)
+		}
+	}
+	if len(kv.exp) != 0 {
+		t.Fatalf("expiry of flushed keys kept: %v", kv.exp)
+	}
+
+	// the store is usable after a flush
+	kv.RPush("list", "x")
+	if got, _ := kv.LRange("list", 0, -1); !equalStrings(got, []string{"x"}) {
+		t.Fatalf("list = %v after flush and RPUSH, want [x]", got)
+	}
+	for _, args := range [][]string{{"LAZY"}, {"ASYNC", "SYNC"}} {
+		if _, err := flushdb(args, kv); err == nil {
+			t.Fatalf("FLUSHDB %v succeeded", args)
+		}
+	}
+}
+
+func TestFlushDBAsync(t *testing.T) {
+	kv := NewKv()
+	fillAllTypes(kv)
+	if resp, err := flushdb([]string{"ASYNC"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("FLUSHDB ASYNC = %v, %v; want OK", resp, err)
+	}
+	// the database is empty once the reply is sent, and writes made after
+	// it are kept
+	if n := kv.DBSize(); n != 0 {
+		t.Fatalf("DBSize = %d after FLUSHDB ASYNC, want 0", n)
+	}
+	kv.Set("after", "v")
+	time.Sleep(10 * time.Millisecond)
+	if _, ok, _ := kv.Get("after"); !ok {
+		t.Fatalf("key written after FLUSHDB ASYNC was flushed")
+	}
+}
+
+func TestFlushAll(t *testing.T) {
+	c := newClient(NewServer(newConfig("")))
+	for _, db := range []int{0, 3, 15} {
+		fillAllTypes(c.srv.dbs[db])
+	}
+	// FLUSHDB only flushes the selected database
+	c.db = 3
+	flushdb(nil, c.kv())
+	if n := c.srv.dbs[3].DBSize(); n != 0 {
+		t.Fatalf("DBSize of DB 3 = %d after FLUSHDB, want 0", n)
+	}
+	if n := c.srv.dbs[0].DBSize(); n != 6 {
+		t.Fatalf("DBSize of DB 0 = %d after FLUSHDB in DB 3, want 6", n)
+	}
+
+	if resp, err := flushall(nil, c); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("FLUSHALL = %v, %v; want OK", resp, err)
+	}
+	for db, kv := range c.srv.dbs {
+		if n := kv.DBSize(); n != 0 {
+			t.Fatalf("DBSize of DB %d = %d after FLUSHALL, want 0", db, n)
+		}
+	}
+
+	fillAllTypes(c.srv.dbs[15])
+	if resp, err := flushall([]string{"async"}, c); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("FLUSHALL ASYNC = %v, %v; want OK", resp, err)
+	}
+	if n := c.srv.dbs[15].DBSize(); n != 0 {
+		t.Fatalf("DBSize of DB 15 = %d after FLUSHALL ASYNC, want 0", n)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	c := newClient(NewServer(newConfig("")))
+	kv := c.kv()
+	kv.RPush("list", "a", "b")
+	kv.Expire("list", time.Hour, ExpireOption{})
+	if resp, err := copyCmd([]string{"list", "copy"}, c); err != nil || resp != integer(1) {
+		t.Fatalf("COPY = %v, %v; want 1", resp, err)
+	}
+	if !kv.exp["copy"].Equal(kv.exp["list"]) {
+		t.Fatalf("expected the TTL to be copied")
+	}
+	// the copy does not share storage with the original
+	kv.LSet("copy", 0, "changed")
+	kv.RPush("copy", "c")
+	if got, _ := kv.LRange("list", 0, -1); !equalStrings(got, []string{"a", "b"}) {
+		t.Fatalf("original list = %v, want [a b]", got)
+	}
+
+	kv.SAdd("set", "m")
+	kv.HSet("hash", "f", "v")
+	kv.ZAdd("zset", ZAddOpts{}, zsetEntry{1, "m"})
+	for _, src := range []string{"set", "hash", "zset"} {
+		if !kv.Copy(src, src+":copy", false) {
+			t.Fatalf("Copy(%q) failed", src)
+		}
+	}
+	kv.SAdd("set:copy", "n")
+	kv.HSet("hash:copy", "g", "w")
+	kv.ZAdd("zset:copy", ZAddOpts{}, zsetEntry{5, "m"})
+	if n, _ := kv.SCard("set"); n != 1 {
+		t.Fatalf("original set changed, SCARD = %d", n)
+	}
+	if n, _ := kv.HLen("hash"); n != 1 {
+		t.Fatalf("original hash changed, HLEN = %d", n)
+	}
+	if score, _, _ := kv.ZScore("zset", "m"); score != 1 {
+		t.Fatalf("original zset changed, score = %v", score)
+	}
+
+	kv.Set("str", "v")
+	if resp, _ := copyCmd([]string{"str", "set"}, c); resp != integer(0) {
+		t.Fatalf("COPY onto existing key = %v, want 0", resp)
+	}
+	if resp, _ := copyCmd([]string{"str", "set", "REPLACE"}, c); resp != integer(1) {
+		t.Fatalf("COPY REPLACE = %v, want 1", resp)
+	}
+	if val, _, _ := kv.Get("set"); val != "v" {
+		t.Fatalf("set = %q after COPY REPLACE, want v", val)
+	}
+	if resp, _ := copyCmd([]string{"missing", "x"}, c); resp != integer(0) {
+		t.Fatalf("COPY of missing key = %v, want 0", resp)
+	}
+	if resp, err := copyCmd([]string{"str", "str", "DB", "1"}, c); err != nil || resp != integer(1) {
+		t.Fatalf("COPY DB 1 = %v, %v; want 1", resp, err)
+	}
+	if val, _, _ := c.srv.dbs[1].Get("str"); val != "v" {
+		t.Fatalf("str = %q in DB 1, want v", val)
+	}
+	if _, err := copyCmd([]string{"str", "str"}, c); err == nil {
+		t.Fatalf("expected error copying a key onto itself")
+	}
+	if _, err := copyCmd([]string{"str", "x", "DB", "16"}, c); err != errDBRange {
+		t.Fatalf("COPY DB 16: err = %v, want %v", err, errDBRange)
+	}
+}
+
+func TestMove(t *testing.T) {
+	c := newClient(NewServer(newConfig("")))
+	src, dst := c.kv(), c.srv.dbs[2]
+	src.ZAdd("z", ZAddOpts{}, zsetEntry{1, "m"})
+	src.Expire("z", time.Hour, ExpireOption{})
+	src.accessed["z"] = time.Now().Add(-5 * time.Second)
+	if resp, err := move([]string{"z", "2"}, c); err != nil || resp != integer(1) {
+		t.Fatalf("MOVE = %v, %v; want 1", resp, err)
+	}
+	if src.typeOf("z") != "none" {
+		t.Fatalf("z still in the source database")
+	}
+	if idle, _ := dst.IdleTime("z"); idle < 5*time.Second {
+		t.Fatalf("IdleTime in DB 2 = %v, want the idle time from DB 0", idle)
+	}
+	if score, ok, _ := dst.ZScore("z", "m"); !ok || score != 1 {
+		t.Fatalf("ZSCORE in DB 2 = %v, %v; want 1", score, ok)
+	}
+	if _, ok := dst.exp["z"]; !ok {
+		t.Fatalf("expected the TTL to be moved")
+	}
+
+	// keys already in the destination are not overwritten
+	src.Set("k", "new")
+	dst.Set("k", "old")
+	if resp, _ := move([]string{"k", "2"}, c); resp != integer(0) {
+		t.Fatalf("MOVE onto existing key = %v, want 0", resp)
+	}
+	if val, _, _ := src.Get("k"); val != "new" {
+		t.Fatalf("k = %q in source, want new", val)
+	}
+	if resp, _ := move([]string{"missing", "2"}, c); resp != integer(0) {
+		t.Fatalf("MOVE of missing key = %v, want 0", resp)
+	}
+	if _, err := move([]string{"k", "0"}, c); err == nil {
+		t.Fatalf("expected error moving to the same database")
+	}
+	if _, err := move([]string{"k", "-1"}, c); err != errDBRange {
+		t.Fatalf("MOVE -1: err = %v, want %v", err, errDBRange)
+	}
+}
+
+func TestObject(t *testing.T) {
+	kv := NewKv()
+	kv.Set("k", "v")
+	kv.RPush("l", "a")
+	kv.mu.Lock()
+	kv.accessed["k"] = time.Now().Add(-5 * time.Second)
+	kv.accessed["l"] = time.Now().Add(-5 * time.Second)
+	kv.mu.Unlock()
+	if resp, _ := object([]string{"IDLETIME", "k"}, kv); resp != integer(5) {
+		t.Fatalf("OBJECT IDLETIME = %v, want 5", resp)
+	}
+	// reads and writes reset the idle time
+	kv.Get("k")
+	rpush([]string{"l", "b"}, kv)
+	if resp, _ := object([]string{"idletime", "k"}, kv); resp != integer(0) {
+		t.Fatalf("OBJECT IDLETIME after GET = %v, want 0", resp)
+	}
+	if resp, _ := object([]string{"IDLETIME", "l"}, kv); resp != integer(0) {
+		t.Fatalf("OBJECT IDLETIME after RPUSH = %v, want 0", resp)
+	}
+	// lookups of missing keys record nothing, and deleting a key drops its
+	// entry
+	kv.Get("missing")
+	kv.LLen("missing")
+	kv.Del([]string{"l"})
+	kv.mu.Lock()
+	_, missing := kv.accessed["missing"]
+	_, deleted := kv.accessed["l"]
+	kv.mu.Unlock()
+	if missing || deleted {
+		t.Fatalf("access recorded for keys that do not exist: %v", kv.accessed)
+	}
+	if resp, _ := object([]string{"REFCOUNT", "k"}, kv); resp != integer(1) {
+		t.Fatalf("OBJECT REFCOUNT = %v, want 1", resp)
+	}
+	if resp, _ := object([]string{"FREQ", "k"}, kv); resp != integer(0) {
+		t.Fatalf("OBJECT FREQ = %v, want 0", resp)
+	}
+	if resp, err := object([]string{"IDLETIME", "missing"}, kv); resp != nil || err != nil {
+		t.Fatalf("OBJECT IDLETIME of missing key = %v, %v; want nil", resp, err)
+	}
+	if resp, _ := object([]string{"HELP"}, kv); len(resp.(Array)) == 0 {
+		t.Fatalf("expected OBJECT HELP to list the subcommands")
+	}
+	if _, err := object([]string{"ENCODING2", "k"}, kv); err == nil {
+		t.Fatalf("expected error for unknown subcommand")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyHistoryLen is the number of samples kept per event
+const latencyHistoryLen = 180
+
+// LatencySample is the highest latency of an event within one second
+type LatencySample struct {
+	Time    time.Time
+	Latency time.Duration
+}
+
+// latencyEvent holds the samples of an event, oldest first
+type latencyEvent struct {
+	samples []LatencySample
+	max     time.Duration
+}
+
+// LatencyMonitor records the latency spikes of named events, like
+// "command" for commands or "expire-cycle" for the expiry sweeper
+type LatencyMonitor struct {
+	mu     sync.Mutex
+	events map[string]*latencyEvent
+}
+
+// record adds a sample of event taking d at now. Samples within the same
+// second are merged, keeping the highest latency.
+func (m *LatencyMonitor) record(event string, d time.Duration, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.events == nil {
+		m.events = map[string]*latencyEvent{}
+	}
+	e, ok := m.events[event]
+	if !ok {
+		e = &latencyEvent{}
+		m.events[event] = e
+	}
+	e.max = max(e.max, d)
+	if n := len(e.samples); n > 0 && e.samples[n-1].Time.Unix() == now.Unix() {
+		e.samples[n-1].Latency = max(e.samples[n-1].Latency, d)
+		return
+	}
+	if len(e.samples) == latencyHistoryLen {
+		copy(e.samples, e.samples[1:])
+		e.samples = e.samples[:latencyHistoryLen-1]
+	}
+	e.samples = append(e.samples, LatencySample{Time: now, Latency: d})
+}
+
+// History: get the samples of event, oldest first
+func (m *LatencyMonitor) History(event string) []LatencySample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.events[event]
+	if !ok {
+		return nil
+	}
+	return append([]LatencySample(nil), e.samples...)
+}
+
+// LatestInfo is the reply of LATENCY LATEST for one event
+type LatestInfo struct {
+	Event  string
+	Latest LatencySample
+	Max    time.Duration
+}
+
+// Latest: get the latest sample and the all time highest latency of every
+// event, sorted by event name
+func (m *LatencyMonitor) Latest() []LatestInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]LatestInfo, 0, len(m.events))
+	for name, e := range m.events {
+		out = append(out, LatestInfo{Event: name, Latest: e.samples[len(e.samples)-1], Max: e.max})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Event < out[j].Event })
+	return out
+}
+
+// Reset: delete the samples of events, or of every event when none are
+// given, returning the number of events deleted
+func (m *LatencyMonitor) Reset(events []string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(events) == 0 {
+		n := len(m.events)
+		m.events = nil
+		return n
+	}
+	n := 0
+	for _, event := range events {
+		if _, ok := m.events[event]; ok {
+			delete(m.events, event)
+			n++
+		}
+	}
+	return n
+}
+
+// recordLatency adds a sample of event taking d, if it is at least the
+// latency-monitor-threshold. A zero threshold disables the monitor.
+func (s *Server) recordLatency(event string, d time.Duration) {
+	threshold := s.cfg.latencyThreshold()
+	if threshold == 0 || d < threshold {
+		return
+	}
+	s.latency.record(event, d, time.Now())
+}
+
+var latencyHelp = []string{
+	"LATENCY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"HISTORY <event>",
+	"    Return time-latency samples for the <event> class.",
+	"LATEST",
+	"    Return the latest latency samples for all events.",
+	"RESET [<event> ...]",
+	"    Reset latency data of one or more <event> classes.",
+	"    (default: reset all data for all event classes)",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handlers for latency commands
+
+func latency(args []string, c *client) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("LATENCY requires a subcommand")
+	}
+	m := &c.srv.latency
+	switch sub := strings.ToUpper(args[0]); sub {
+	case "HISTORY":
+		if len(args) != 2 {
+			return nil, errors.New("wrong number of arguments for 'latency|history' command")
+		}
+		samples := m.History(args[1])
+		reply := make(Array, len(samples))
+		for i, s := range samples {
+			reply[i] = Array{integer(s.Time.Unix()), integer(s.Latency.Milliseconds())}
+		}
+		return reply, nil
+	case "LATEST":
+		if len(args) != 1 {
+			return nil, errors.New("wrong number of arguments for 'latency|latest' command")
+		}
+		latest := m.Latest()
+		reply := make(Array, len(latest))
+		for i, l := range latest {
+			reply[i] = Array{
+				BulkString(l.Event),
+				integer(l.Latest.Time.Unix()),
+				integer(l.Latest.Latency.Milliseconds()),
+				integer(l.Max.Milliseconds()),
+			}
+		}
+		return reply, nil
+	case "RESET":
+		return integer(m.Reset(args[1:])), nil
+	case "HELP":
+		if len(args) != 1 {
+			return nil, errors.New("LATENCY HELP takes no arguments")
+		}
+		return bulkArray(latencyHelp), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try LATENCY HELP.", args[0])
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLatencyMonitor(t *testing.T) {
+	var m LatencyMonitor
+	start := time.Unix(1700000000, 0)
+	m.record("command", 5*time.Millisecond, start)
+	// samples of the same second are merged
+	m.record("command", 20*time.Millisecond, start.Add(100*time.Millisecond))
+	m.record("command", 3*time.Millisecond, start.Add(200*time.Millisecond))
+	m.record("command", 7*time.Millisecond, start.Add(time.Second))
+	m.record("expire-cycle", 2*time.Millisecond, start)
+
+	got := m.History("command")
+	want := []LatencySample{{start, 20 * time.Millisecond}, {start.Add(time.Second), 7 * time.Millisecond}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("History(command) = %v, want %v", got, want)
+	}
+	latest := m.Latest()
+	if len(latest) != 2 || latest[0].Event != "command" || latest[0].Latest != want[1] || latest[0].Max != 20*time.Millisecond || latest[1].Event != "expire-cycle" {
+		t.Fatalf("Latest = %v", latest)
+	}
+
+	// the history is capped, dropping the oldest samples
+	for i := 0; i < 200; i++ {
+		m.record("command", time.Millisecond, start.Add(time.Duration(i+2)*time.Second))
+	}
+	if got := m.History("command"); len(got) != latencyHistoryLen || !got[0].Time.Equal(start.Add(22*time.Second)) {
+		t.Fatalf("History(command) has %d samples from %v, want %d from %v", len(got), got[0].Time, latencyHistoryLen, start.Add(22*time.Second))
+	}
+
+	if n := m.Reset([]string{"command", "nosuchevent"}); n != 1 {
+		t.Fatalf("Reset(command) = %d, want 1", n)
+	}
+	if got := m.History("command"); got != nil {
+		t.Fatalf("History(command) after Reset = %v, want none", got)
+	}
+	if n := m.Reset(nil); n != 1 {
+		t.Fatalf("Reset() = %d, want 1", n)
+	}
+	if latest := m.Latest(); len(latest) != 0 {
+		t.Fatalf("Latest after Reset = %v, want none", latest)
+	}
+}
+
+func TestLatencyCommands(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	c := newClient(srv)
+
+	// the monitor is disabled with the default zero threshold
+	srv.recordLatency("command", time.Second)
+	if resp := mustLatency(t, c, "LATEST"); len(resp.(Array)) != 0 {
+		t.Fatalf("LATENCY LATEST with the monitor disabled = %v, want empty", resp)
+	}
+
+	srv.cfg.Set([]string{"latency-monitor-threshold", "100"})
+	srv.recordLatency("command", 50*time.Millisecond)
+	srv.recordLatency("command", 250*time.Millisecond)
+	resp := mustLatency(t, c, "HISTORY", "command").(Array)
+	if len(resp) != 1 || resp[0].(Array)[1] != integer(250) {
+		t.Fatalf("LATENCY HISTORY command = %v, want one 250ms sample", resp)
+	}
+	latest := mustLatency(t, c, "LATEST").(Array)
+	if len(latest) != 1 {
+		t.Fatalf("LATENCY LATEST = %v, want one event", latest)
+	}
+	if e := latest[0].(Array); e[0] != BulkString("command") || e[2] != integer(250) || e[3] != integer(250) {
+		t.Fatalf("LATENCY LATEST entry = %v", e)
+	}
+	if resp := mustLatency(t, c, "HISTORY", "nosuchevent"); len(resp.(Array)) != 0 {
+		t.Fatalf("LATENCY HISTORY nosuchevent = %v, want empty", resp)
+	}
+	if n := mustLatency(t, c, "RESET"); n != integer(1) {
+		t.Fatalf("LATENCY RESET = %v, want 1", n)
+	}
+	for _, args := range [][]string{{"HISTORY"}, {"LATEST", "x"}, {"NOSUCH"}} {
+		if _, err := latency(args, c); err == nil {
+			t.Fatalf("LATENCY %v succeeded", args)
+		}
+	}
+}
+
+func mustLatency(t *testing.T, c *client, args ...string) RespValue {
+	t.Helper()
+	resp, err := latency(args, c)
+	if err != nil {
+		t.Fatalf("LATENCY %v: %v", args, err)
+	}
+	return resp
+}
+
+func TestLatencyInstrumentation(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	// a threshold below any real run time samples every event
+	srv.cfg.latencyMonitorThreshold = time.Nanosecond
+	srv.expire()
+	if got := srv.latency.History("expire-cycle"); len(got) != 1 {
+		t.Fatalf("expire-cycle samples = %v, want one", got)
+	}
+
+	server, conn := net.Pipe()
+	defer conn.Close()
+	go handleClient(server, srv)
+	conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+	bufio.NewReader(conn).ReadString('\n')
+	if got := srv.latency.History("command"); len(got) != 1 {
+		t.Fatalf("command samples = %v, want one", got)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"os"
 	"strconv"
@@ -15,8 +17,6 @@ import (
 	"time"
 )
 
-var _ = os.Exit
-
 type RespValue interface{}
 
 type SimpleString string
@@ -24,39 +24,130 @@ type BulkString string
 type integer int64
 type Array []RespValue
 
+// RESP3 types, written as their closest RESP2 equivalent to RESP2 clients
+
+// Map holds alternating keys and values
+type Map []RespValue
+type Boolean bool
+type Double float64
+
+// bulkArray converts a []string to an Array of BulkString
+func bulkArray(vals []string) Array {
+	respArray := make(Array, len(vals))
+	for i, v := range vals {
+		respArray[i] = BulkString(v)
+	}
+	return respArray
+}
+
+// boolInt converts a boolean reply to the 1/0 integer Redis uses
+func boolInt(b bool) integer {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// formatFloat renders f the way Redis prints floating point replies:
+// the shortest decimal representation, without exponent or trailing zeros
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
 // Kv is a simple in-memory key-value store with mutex for concurrency safety.
 type Kv struct {
 	mu    sync.Mutex
 	data  map[string]string
 	exp   map[string]time.Time
 	lists map[string][]string
-	// waiters holds channels for clients blocked on BLPOP for a given key.
-	// When an element is pushed to a list with waiting clients, the server
-	// will deliver the element to the longest-waiting client instead of
-	// appending it to the list.
-	waiters map[string][]chan string
+	// hashes maps a key to its field-value pairs
+	hashes map[string]map[string]string
+	// sets maps a key to its members
+	sets map[string]map[string]struct{}
+	// zsets maps a key to its sorted set
+	zsets map[string]*SortedSet
+	// streams maps a key to its stream
+	streams map[string]*Stream
+	// waiters holds the clients blocked on a given key (BLPOP, BRPOP, ...)
+	// in arrival order. When data is pushed to a key with waiting clients
+	// the longest-waiting client is served first.
+	waiters map[string][]*waiter
+	// accessed records when each existing key was last read or written,
+	// for OBJECT IDLETIME. Entries are dropped along with their key by
+	// deleteLocked.
+	accessed map[string]time.Time
+	// stats counts the keyspace hits and misses for INFO
+	stats keyspaceStats
 }
 
 // constructor function for Kv
 func NewKv() *Kv {
 	return &Kv{
-		data:    make(map[string]string),
-		exp:     make(map[string]time.Time),
-		lists:   make(map[string][]string),
-		waiters: make(map[string][]chan string),
+		data:     make(map[string]string),
+		exp:      make(map[string]time.Time),
+		lists:    make(map[string][]string),
+		hashes:   make(map[string]map[string]string),
+		sets:     make(map[string]map[string]struct{}),
+		zsets:    make(map[string]*SortedSet),
+		streams:  make(map[string]*Stream),
+		waiters:  make(map[string][]*waiter),
+		accessed: make(map[string]time.Time),
 	}
 }
 
-// Set stores the key-value pair in the Kv store with an optional TTL
-func (k *Kv) SetWithTTL(key, value string, ttl time.Duration) {
+// SetOpts holds the options of a SET
+type SetOpts struct {
+	TTL time.Duration
+	// ExpireAt is an absolute expiry time (EXAT, PXAT), used when not zero
+	ExpireAt time.Time
+	// NX only sets keys that do not exist yet, XX only keys that do
+	NX, XX bool
+	// Get returns the previous value, the key must then hold a string
+	Get bool
+	// KeepTTL keeps the expiry of an existing key instead of clearing it
+	KeepTTL bool
+}
+
+// SetWithOpts stores the key-value pair when the NX/XX condition of opts
+// holds, reporting whether it did. With opts.Get the previous value of the
+// key is returned too, even when the condition is not met.
+func (k *Kv) SetWithOpts(key, value string, opts SetOpts) (old string, hadOld, ok bool, err error) {
 	k.mu.Lock()
+	defer k.mu.Unlock()
+	if opts.Get {
+		if err := k.checkType(key, "string"); err != nil {
+			return "", false, false, err
+		}
+		old, hadOld = k.getLocked(key)
+	}
+	exists := k.typeOf(key) != "none"
+	if (opts.NX && exists) || (opts.XX && !exists) {
+		return old, hadOld, false, nil
+	}
+	// SET overwrites a value of any type
+	expTime, hadTTL := k.exp[key]
+	k.deleteLocked(key)
 	k.data[key] = value
-	if ttl > 0 {
-		k.exp[key] = time.Now().Add(ttl)
-	} else {
-		delete(k.exp, key)
+	k.accessed[key] = time.Now()
+	if !opts.ExpireAt.IsZero() {
+		k.exp[key] = opts.ExpireAt
+	} else if opts.TTL > 0 {
+		k.exp[key] = time.Now().Add(opts.TTL)
+	} else if opts.KeepTTL && hadTTL {
+		k.exp[key] = expTime
 	}
-	k.mu.Unlock()
+	return old, hadOld, true, nil
+}
+
+// Set stores the key-value pair in the Kv store with an optional TTL
+func (k *Kv) SetWithTTL(key, value string, ttl time.Duration) {
+	k.SetWithOpts(key, value, SetOpts{TTL: ttl})
 }
 
 // without expiration
@@ -64,21 +155,92 @@ func (k *Kv) Set(key, value string) {
 	k.SetWithTTL(key, value, 0)
 }
 
-func (k *Kv) Get(key string) (string, bool) {
+func (k *Kv) Get(key string) (string, bool, error) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return "", false, err
+	}
+	val, ok := k.getLocked(key)
+	k.recordLookup(ok)
+	return val, ok, nil
+}
 
-	// Check for expiration
-	if expTime, ok := k.exp[key]; ok {
-		if time.Now().After(expTime) {
-			// Key has expired
-			delete(k.data, key)
-			delete(k.exp, key)
-			return "", false
-		}
+// respErr is an error whose message already starts with a RESP error code
+// (e.g. WRONGTYPE) and is sent to the client as is.
+type respErr string
+
+func (e respErr) Error() string { return string(e) }
+
+// errWrongType is returned when a command targets a key holding another type.
+var errWrongType = respErr("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// typeOf returns the type name of the value stored at key, or "none".
+// Callers must hold k.mu.
+func (k *Kv) typeOf(key string) string {
+	if k.expireLocked(key) {
+		return "none"
+	}
+	if _, ok := k.data[key]; ok {
+		return "string"
+	}
+	if _, ok := k.lists[key]; ok {
+		return "list"
+	}
+	if _, ok := k.hashes[key]; ok {
+		return "hash"
+	}
+	if _, ok := k.sets[key]; ok {
+		return "set"
+	}
+	if _, ok := k.zsets[key]; ok {
+		return "zset"
+	}
+	if _, ok := k.streams[key]; ok {
+		return "stream"
+	}
+	return "none"
+}
+
+// expireLocked deletes key if its TTL has elapsed, reporting whether it did.
+// Callers must hold k.mu.
+func (k *Kv) expireLocked(key string) bool {
+	if expTime, ok := k.exp[key]; ok && !time.Now().Before(expTime) {
+		k.deleteLocked(key)
+		return true
+	}
+	return false
+}
+
+// deleteLocked removes key, whatever its type, along with its expiry.
+// Callers must hold k.mu.
+func (k *Kv) deleteLocked(key string) {
+	delete(k.data, key)
+	delete(k.exp, key)
+	delete(k.lists, key)
+	delete(k.hashes, key)
+	delete(k.sets, key)
+	delete(k.zsets, key)
+	delete(k.accessed, key)
+	if _, ok := k.streams[key]; ok {
+		delete(k.streams, key)
+		// clients blocked in XREADGROUP fail once the stream is gone
+		k.wake(key)
 	}
-	val, ok := k.data[key]
-	return val, ok
+}
+
+// checkType returns errWrongType if key exists with a type other than typ,
+// recording the access to key when it exists. Callers must hold k.mu.
+func (k *Kv) checkType(key, typ string) error {
+	t := k.typeOf(key)
+	if t == "none" {
+		return nil
+	}
+	k.accessed[key] = time.Now()
+	if t != typ {
+		return errWrongType
+	}
+	return nil
 }
 
 // list operations:
@@ -86,20 +248,77 @@ func (k *Kv) Get(key string) (string, bool) {
 func (k *Kv) RPush(key string, values ...string) int {
 	k.mu.Lock()
 	defer k.mu.Unlock()
-	k.lists[key] = append(k.lists[key], values...)
-	return len(k.lists[key])
+	return k.pushLocked(key, false, values)
+}
+
+// pushLocked appends values to the list at key, or prepends them as a block
+// when left is set, then serves any clients blocked on the key. The returned
+// length is the one right after the push. Callers must hold k.mu.
+func (k *Kv) pushLocked(key string, left bool, values []string) int {
+	if left {
+		list := make([]string, 0, len(values)+len(k.lists[key]))
+		list = append(list, values...)
+		k.lists[key] = append(list, k.lists[key]...)
+	} else {
+		k.lists[key] = append(k.lists[key], values...)
+	}
+	n := len(k.lists[key])
+	k.wake(key)
+	return n
+}
+
+// popLocked removes and returns up to n elements from the head (left) or
+// the tail of the list at key, deleting the key once it is empty.
+// Callers must hold k.mu.
+func (k *Kv) popLocked(key string, left bool, n int) []string {
+	list := k.lists[key]
+	if n > len(list) {
+		n = len(list)
+	}
+	if n <= 0 {
+		return nil
+	}
+	vals := make([]string, n)
+	if left {
+		copy(vals, list[:n])
+		list = list[n:]
+	} else {
+		// elements come off the tail in reverse order
+		for i := range vals {
+			vals[i] = list[len(list)-1-i]
+		}
+		list = list[:len(list)-n]
+	}
+	if len(list) == 0 {
+		k.deleteLocked(key)
+	} else {
+		k.lists[key] = list
+	}
+	return vals
 }
 
 // LRANGE: get elements from list stored at key
 func (k *Kv) LRange(key string, start, stop int) ([]string, error) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
+	if err := k.checkType(key, "list"); err != nil {
+		return nil, err
+	}
 	list, ok := k.lists[key]
 	if !ok {
 		return []string{}, nil
 	}
-	n := len(list)
+	start, stop, ok = clampRange(len(list), start, stop)
+	if !ok {
+		return []string{}, nil
+	}
+	return list[start : stop+1], nil
+}
 
+// clampRange resolves the inclusive, possibly negative, index range
+// [start, stop] against a sequence of length n. It reports false when the
+// range selects no elements.
+func clampRange(n, start, stop int) (int, int, bool) {
 	// convert negative indices to absolute positions
 	if start < 0 {
 		start = n + start
@@ -117,36 +336,38 @@ func (k *Kv) LRange(key string, start, stop int) ([]string, error) {
 	}
 
 	if start >= n || start > stop {
-		return []string{}, nil
+		return 0, 0, false
 	}
 	if stop >= n {
 		stop = n - 1
 	}
-	return list[start : stop+1], nil
+	return start, stop, true
 }
 
 // LPush: prepend values to the list stored at key
 func (k *Kv) LPush(key string, values ...string) int {
 	k.mu.Lock()
 	defer k.mu.Unlock()
-	// Prepend values in reverse order so the given order is preserved
-	for i := len(values) - 1; i >= 0; i-- {
-		k.lists[key] = append([]string{values[i]}, k.lists[key]...)
-	}
-	return len(k.lists[key])
+	return k.pushLocked(key, true, values)
 }
 
-// LLen: get length of list stored at key
-func (k *Kv) LLen(key string) integer {
+// LLen: get length of list stored at key, 0 if the key does not exist
+func (k *Kv) LLen(key string) (int, error) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
-	return integer(len(k.lists[key]))
+	if err := k.checkType(key, "list"); err != nil {
+		return 0, err
+	}
+	return len(k.lists[key]), nil
 }
 
 // LPop: remove and return the first element OR the n first elements if n is provided
 func (k *Kv) LPop(key string, n int) ([]string, error) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
+	if err := k.checkType(key, "list"); err != nil {
+		return nil, err
+	}
 	list, ok := k.lists[key]
 	if !ok || len(list) == 0 {
 		return nil, errors.New("list is empty or does not exist")
@@ -154,13 +375,225 @@ func (k *Kv) LPop(key string, n int) ([]string, error) {
 	if n <= 0 {
 		n = 1
 	}
-	if n > len(list) {
-		n = len(list)
+	return k.popLocked(key, true, n), nil
+}
+
+// LIndex: get the element at index, negative indices count from the tail
+func (k *Kv) LIndex(key string, idx int) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "list"); err != nil {
+		return "", false, err
 	}
-	vals := make([]string, n)
-	copy(vals, list[:n])
-	k.lists[key] = list[n:]
-	return vals, nil
+	list := k.lists[key]
+	if idx < 0 {
+		idx = len(list) + idx
+	}
+	if idx < 0 || idx >= len(list) {
+		return "", false, nil
+	}
+	return list[idx], true, nil
+}
+
+// LSet: overwrite the element at index, negative indices count from the tail
+func (k *Kv) LSet(key string, idx int, value string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "list"); err != nil {
+		return err
+	}
+	list, ok := k.lists[key]
+	if !ok {
+		return errors.New("no such key")
+	}
+	if idx < 0 {
+		idx = len(list) + idx
+	}
+	if idx < 0 || idx >= len(list) {
+		return errors.New("index out of range")
+	}
+	list[idx] = value
+	return nil
+}
+
+// LInsert: insert value before or after the first occurrence of pivot.
+// Returns the new length, -1 if pivot was not found or 0 if the key does not exist.
+func (k *Kv) LInsert(key, where, pivot, value string) (int, error) {
+	where = strings.ToUpper(where)
+	if where != "BEFORE" && where != "AFTER" {
+		return 0, errors.New("syntax error")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "list"); err != nil {
+		return 0, err
+	}
+	list, ok := k.lists[key]
+	if !ok {
+		return 0, nil
+	}
+	for i, v := range list {
+		if v != pivot {
+			continue
+		}
+		if where == "AFTER" {
+			i++
+		}
+		list = append(list, "")
+		copy(list[i+1:], list[i:])
+		list[i] = value
+		k.lists[key] = list
+		return len(list), nil
+	}
+	return -1, nil
+}
+
+// LTrim: keep only the elements in the inclusive range [start, stop],
+// deleting the key when nothing is left
+func (k *Kv) LTrim(key string, start, stop int) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "list"); err != nil {
+		return err
+	}
+	list, ok := k.lists[key]
+	if !ok {
+		return nil
+	}
+	start, stop, ok = clampRange(len(list), start, stop)
+	if !ok {
+		k.deleteLocked(key)
+		return nil
+	}
+	k.lists[key] = list[start : stop+1]
+	return nil
+}
+
+// LRem: remove occurrences of value, from the head when count > 0, from the
+// tail when count < 0 and everywhere when count == 0. Returns the number of
+// removed elements.
+func (k *Kv) LRem(key string, count int, value string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "list"); err != nil {
+		return 0, err
+	}
+	list, ok := k.lists[key]
+	if !ok {
+		return 0, nil
+	}
+	limit := count
+	if limit < 0 {
+		// -math.MinInt overflows, and no list is that long anyway
+		limit = -max(limit, -math.MaxInt)
+	}
+	removed := 0
+	kept := make([]string, len(list))
+	n := 0
+	if count >= 0 {
+		for _, v := range list {
+			if v == value && (limit == 0 || removed < limit) {
+				removed++
+				continue
+			}
+			kept[n] = v
+			n++
+		}
+		kept = kept[:n]
+	} else {
+		// walk from the tail, filling kept from the back to keep the order
+		n = len(kept)
+		for i := len(list) - 1; i >= 0; i-- {
+			if list[i] == value && removed < limit {
+				removed++
+				continue
+			}
+			n--
+			kept[n] = list[i]
+		}
+		kept = kept[n:]
+	}
+	if len(kept) == 0 {
+		k.deleteLocked(key)
+	} else {
+		k.lists[key] = kept
+	}
+	return removed, nil
+}
+
+// LMove: atomically pop an element from one end of src and push it to one
+// end of dst. whereFrom and whereTo are "LEFT" or "RIGHT".
+func (k *Kv) LMove(src, dst, whereFrom, whereTo string) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(src, "list"); err != nil {
+		return "", false, err
+	}
+	if err := k.checkType(dst, "list"); err != nil {
+		return "", false, err
+	}
+	vals := k.popLocked(src, strings.EqualFold(whereFrom, "LEFT"), 1)
+	if len(vals) == 0 {
+		return "", false, nil
+	}
+	k.pushLocked(dst, strings.EqualFold(whereTo, "LEFT"), vals)
+	return vals[0], true, nil
+}
+
+// LPos: return the indices of element in the list. rank selects which match
+// to start from (negative ranks search from the tail), count caps the number
+// of returned matches (0 = all) and maxlen caps the number of scanned
+// elements (0 = whole list).
+func (k *Kv) LPos(key, element string, rank, count, maxlen int) ([]int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "list"); err != nil {
+		return nil, err
+	}
+	list := k.lists[key]
+	n := len(list)
+	step, i := 1, 0
+	if rank < 0 {
+		step, i = -1, n-1
+		rank = -rank
+	}
+	var matches []int
+	for scanned := 0; i >= 0 && i < n; i, scanned = i+step, scanned+1 {
+		if maxlen > 0 && scanned >= maxlen {
+			break
+		}
+		if list[i] != element {
+			continue
+		}
+		if rank > 1 {
+			rank--
+			continue
+		}
+		matches = append(matches, i)
+		if count > 0 && len(matches) == count {
+			break
+		}
+	}
+	return matches, nil
+}
+
+// LMPop: pop up to count elements from the first non-empty list among keys,
+// from the head when dir is "LEFT" and from the tail when it is "RIGHT".
+// Returns the popped key, or an empty key when all lists are empty.
+func (k *Kv) LMPop(keys []string, dir string, count int) (string, []string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range keys {
+		if err := k.checkType(key, "list"); err != nil {
+			return "", nil, err
+		}
+	}
+	for _, key := range keys {
+		if vals := k.popLocked(key, strings.EqualFold(dir, "LEFT"), count); len(vals) > 0 {
+			return key, vals, nil
+		}
+	}
+	return "", nil, nil
 }
 
 // B
@@ -170,16 +603,147 @@ type Handler func(args []string, kv *Kv) (RespValue, error)
 
 // Map of command names to their handlers
 var handlers = map[string]Handler{
-	"PING":   ping,
-	"ECHO":   echo,
-	"SET":    set,
-	"GET":    get,
-	"RPUSH":  rpush,
-	"LRANGE": lrange,
-	"LPUSH":  lpush,
-	"BLPOP":  blpop,
-	"LLEN":   llen,
-	"LPOP":   lpop,
+	"PING":             ping,
+	"ECHO":             echo,
+	"SET":              set,
+	"GET":              get,
+	"RPUSH":            rpush,
+	"LRANGE":           lrange,
+	"LPUSH":            lpush,
+	"BLPOP":            blpop,
+	"BRPOP":            brpop,
+	"LLEN":             llen,
+	"LPOP":             lpop,
+	"LINDEX":           lindex,
+	"LSET":             lset,
+	"LINSERT":          linsert,
+	"LTRIM":            ltrim,
+	"LREM":             lrem,
+	"LMOVE":            lmove,
+	"LPOS":             lpos,
+	"LMPOP":            lmpop,
+	"BLMPOP":           blmpop,
+	"HSET":             hset,
+	"HGET":             hget,
+	"HEXISTS":          hexists,
+	"HDEL":             hdel,
+	"HGETALL":          hgetall,
+	"HKEYS":            hkeys,
+	"HVALS":            hvals,
+	"HLEN":             hlen,
+	"HMGET":            hmget,
+	"HINCRBY":          hincrby,
+	"HINCRBYFLOAT":     hincrbyfloat,
+	"HSETNX":           hsetnx,
+	"HSCAN":            hscan,
+	"SADD":             sadd,
+	"SREM":             srem,
+	"SMEMBERS":         smembers,
+	"SCARD":            scard,
+	"SISMEMBER":        sismember,
+	"SMISMEMBER":       smismember,
+	"SUNION":           sunion,
+	"SINTER":           sinter,
+	"SDIFF":            sdiff,
+	"SUNIONSTORE":      sunionstore,
+	"SINTERSTORE":      sinterstore,
+	"SDIFFSTORE":       sdiffstore,
+	"SPOP":             spop,
+	"SRANDMEMBER":      srandmember,
+	"SMOVE":            smove,
+	"SINTERCARD":       sintercard,
+	"ZADD":             zadd,
+	"ZRANGE":           zrange,
+	"ZREM":             zrem,
+	"ZCARD":            zcard,
+	"ZSCORE":           zscore,
+	"ZRANK":            zrank,
+	"ZREVRANK":         zrevrank,
+	"ZINCRBY":          zincrby,
+	"ZCOUNT":           zcount,
+	"ZRANGEBYSCORE":    zrangebyscore,
+	"ZREVRANGE":        zrevrange,
+	"ZREVRANGEBYSCORE": zrevrangebyscore,
+	"ZRANGEBYLEX":      zrangebylex,
+	"ZREVRANGEBYLEX":   zrevrangebylex,
+	"ZLEXCOUNT":        zlexcount,
+	"ZPOPMIN":          zpopmin,
+	"ZPOPMAX":          zpopmax,
+	"ZUNIONSTORE":      zunionstore,
+	"ZINTERSTORE":      zinterstore,
+	"ZDIFFSTORE":       zdiffstore,
+	"ZMSCORE":          zmscore,
+	"ZSCAN":            zscan,
+	"ZMPOP":            zmpop,
+	"BZMPOP":           bzmpop,
+	"ZINTERCARD":       zintercard,
+	"INCR":             incr,
+	"INCRBY":           incrby,
+	"DECR":             decr,
+	"DECRBY":           decrby,
+	"APPEND":           appendCmd,
+	"GETSET":           getset,
+	"MSET":             mset,
+	"MGET":             mget,
+	"MSETNX":           msetnx,
+	"SETNX":            setnx,
+	"SETEX":            setex,
+	"PSETEX":           psetex,
+	"GETEX":            getex,
+	"GETDEL":           getdel,
+	"GETRANGE":         getrange,
+	"SETRANGE":         setrange,
+	"DEL":              del,
+	"EXISTS":           exists,
+	"EXPIRE":           expire,
+	"PEXPIRE":          pexpire,
+	"EXPIREAT":         expireat,
+	"PEXPIREAT":        pexpireat,
+	"TTL":              ttl,
+	"PTTL":             pttl,
+	"PERSIST":          persist,
+	"TYPE":             typeCmd,
+	"KEYS":             keysCmd,
+	"SCAN":             scan,
+	"RANDOMKEY":        randomkey,
+	"DBSIZE":           dbsize,
+	"FLUSHDB":          flushdb,
+	"SORT":             sortCmd,
+	"SORT_RO":          sortRO,
+	"DUMP":             dump,
+	"RESTORE":          restore,
+	"OBJECT":           object,
+	"WAIT":             wait,
+	"SETBIT":           setbit,
+	"GETBIT":           getbit,
+	"BITCOUNT":         bitcount,
+	"BITOP":            bitop,
+	"BITFIELD":         bitfield,
+	"BITFIELD_RO":      bitfieldRO,
+	"GEOADD":           geoadd,
+	"GEOPOS":           geopos,
+	"GEODIST":          geodist,
+	"GEOHASH":          geohash,
+	"GEOSEARCH":        geosearch,
+	"GEOSEARCHSTORE":   geosearchstore,
+	// deprecated since Redis 6.2, GEOSEARCH and GEOSEARCHSTORE replace them
+	"GEORADIUS":         georadius,
+	"GEORADIUSBYMEMBER": georadiusbymember,
+	"XADD":              xadd,
+	"XLEN":              xlen,
+	"XRANGE":            xrange,
+	"XREVRANGE":         xrevrange,
+	"XREAD":             xread,
+	"XTRIM":             xtrim,
+	"XDEL":              xdel,
+	"XSETID":            xsetid,
+	"XINFO":             xinfo,
+	"XGROUP":            xgroup,
+	"XREADGROUP":        xreadgroup,
+	"XACK":              xack,
+	"XCLAIM":            xclaim,
+	"XAUTOCLAIM":        xautoclaim,
+	"XPENDING":          xpending,
 }
 
 // Handlers for redis client commands
@@ -199,11 +763,33 @@ func echo(args []string, kv *Kv) (RespValue, error) {
 	return BulkString(args[0]), nil
 }
 
+// wait acknowledges WAIT numreplicas timeout. There is no replication yet,
+// so no replica can acknowledge anything and it answers 0 right away.
+func wait(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("WAIT requires exactly two arguments")
+	}
+	if _, err := strconv.Atoi(args[0]); err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	timeout, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errors.New("timeout is not an integer or out of range")
+	}
+	if timeout < 0 {
+		return nil, errors.New("timeout is negative")
+	}
+	return integer(0), nil
+}
+
 func get(args []string, kv *Kv) (RespValue, error) {
 	if len(args) != 1 {
 		return nil, errors.New("GET requires exactly one argument")
 	}
-	val, ok := kv.Get(args[0])
+	val, ok, err := kv.Get(args[0])
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
 		return nil, nil // Key not found
 	}
@@ -217,37 +803,75 @@ func set(args []string, kv *Kv) (RespValue, error) {
 	}
 	key := args[0]
 	value := args[1]
-	var ttl time.Duration
+	var opts SetOpts
+	var expireOpt, expireArg string
+	expiries := 0
 
-	// Check for optional PX and EX argument for expiration in milliseconds
+	// Check for optional PX, EX, PXAT, EXAT and KEEPTTL expiration, NX and XX
+	// condition and GET arguments
 	if len(args) > 2 {
 		i := 2
 		for i < len(args) {
 			option := strings.ToUpper(args[i])
-			if option == "PX" && i+1 < len(args) {
-				ms, err := strconv.Atoi(args[i+1])
-				if err != nil {
-					return nil, errors.New("invalid PX value")
-				}
-				ttl = time.Duration(ms) * time.Millisecond
+			if (option == "EX" || option == "PX" || option == "EXAT" || option == "PXAT") && i+1 < len(args) {
+				expireOpt, expireArg = option, args[i+1]
+				expiries++
 				i += 2
 				continue
 			}
-			if option == "EX" && i+1 < len(args) {
-				seconds, err := strconv.Atoi(args[i+1])
-				if err != nil {
-					return nil, errors.New("invalid EX value")
+			if option == "NX" || option == "XX" {
+				opts.NX = opts.NX || option == "NX"
+				opts.XX = opts.XX || option == "XX"
+				if opts.NX && opts.XX {
+					return nil, errors.New("syntax error")
 				}
-				ttl = time.Duration(seconds) * time.Second
-				i += 2
+				i++
+				continue
+			}
+			if option == "GET" {
+				opts.Get = true
+				i++
+				continue
+			}
+			if option == "KEEPTTL" {
+				opts.KeepTTL = true
+				expiries++
+				i++
 				continue
 			}
 			return nil, errors.New("invalid SET option")
 
 		}
 	}
+	// EX, PX, EXAT, PXAT and KEEPTTL exclude each other, which is checked
+	// before the expire time itself
+	if expiries > 1 {
+		return nil, errors.New("syntax error")
+	}
+	if expireOpt != "" {
+		at, err := parseExpireTime(expireOpt, expireArg, "set")
+		if err != nil {
+			return nil, err
+		}
+		if !at.After(time.Now()) {
+			return nil, errors.New("invalid expire time in 'set' command")
+		}
+		opts.ExpireAt = at
+	}
 
-	kv.SetWithTTL(key, value, ttl)
+	old, hadOld, ok, err := kv.SetWithOpts(key, value, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Get {
+		if !hadOld {
+			return nil, nil
+		}
+		return BulkString(old), nil
+	}
+	if !ok {
+		return nil, nil // NX or XX condition not met
+	}
 	return SimpleString("OK"), nil
 }
 
@@ -256,31 +880,14 @@ func rpush(args []string, kv *Kv) (RespValue, error) {
 		return nil, errors.New("RPUSH requires at least two arguments")
 	}
 	key := args[0]
-	values := args[1:]
-	// Append all values first so the returned length reflects the list
-	// size immediately after the RPUSH. Then deliver elements to any
-	// waiters (FIFO) by popping from the list and sending the value.
 	kv.mu.Lock()
-	// append values
-	kv.lists[key] = append(kv.lists[key], values...)
-	pushedLen := len(kv.lists[key])
-
-	// deliver to waiters while both waiters and list items exist
-	for len(kv.waiters[key]) > 0 && len(kv.lists[key]) > 0 {
-		ch := kv.waiters[key][0]
-		kv.waiters[key] = kv.waiters[key][1:]
-		// pop first element
-		val := kv.lists[key][0]
-		kv.lists[key] = kv.lists[key][1:]
-		// deliver without blocking; channel is buffered but use goroutine as fallback
-		select {
-		case ch <- val:
-		default:
-			go func(c chan string, v string) { c <- v }(ch, val)
-		}
+	defer kv.mu.Unlock()
+	if err := kv.checkType(key, "list"); err != nil {
+		return nil, err
 	}
-	kv.mu.Unlock()
-	return integer(pushedLen), nil
+	// The returned length reflects the list size immediately after the
+	// RPUSH, before elements are handed to any blocked clients.
+	return integer(kv.pushLocked(key, false, args[1:])), nil
 }
 
 func lrange(args []string, kv *Kv) (RespValue, error) {
@@ -300,12 +907,7 @@ func lrange(args []string, kv *Kv) (RespValue, error) {
 	if err != nil {
 		return nil, err
 	}
-	//convert []string to Array of BulkString
-	respArray := make(Array, len(list))
-	for i, v := range list {
-		respArray[i] = BulkString(v)
-	}
-	return respArray, nil
+	return bulkArray(list), nil
 }
 
 func lpush(args []string, kv *Kv) (RespValue, error) {
@@ -321,75 +923,52 @@ func lpush(args []string, kv *Kv) (RespValue, error) {
 	for i := range values {
 		rev[i] = values[len(values)-1-i]
 	}
-	pushedLen := kv.LPush(key, rev...)
-	return integer(pushedLen), nil
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if err := kv.checkType(key, "list"); err != nil {
+		return nil, err
+	}
+	return integer(kv.pushLocked(key, true, rev)), nil
 }
 
 func blpop(args []string, kv *Kv) (RespValue, error) {
-	if len(args) != 2 {
-		return nil, errors.New("BLPOP requires exactly two arguments: key and timeout")
+	return blockingPop(args, kv, true)
+}
+
+func brpop(args []string, kv *Kv) (RespValue, error) {
+	return blockingPop(args, kv, false)
+}
+
+// blockingPop implements BLPOP and BRPOP: the first non-empty key among
+// args[:len(args)-1] is popped, otherwise the client waits for a push or
+// for the timeout (in seconds, 0 = forever) to elapse.
+func blockingPop(args []string, kv *Kv, left bool) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("blocking pop requires at least one key and a timeout")
 	}
-	key := args[0]
-	timeoutSec, err := strconv.Atoi(args[1])
-	if err != nil || timeoutSec < 0 {
-		return nil, errors.New("invalid timeout")
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
 	}
-
-	// First try immediate pop
-	kv.mu.Lock()
-	if list, ok := kv.lists[key]; ok && len(list) > 0 {
-		val := list[0]
-		kv.lists[key] = list[1:]
-		kv.mu.Unlock()
-		resp := Array{BulkString(key), BulkString(val)}
-		return resp, nil
-	}
-
-	// No element available: set up a waiter
-	ch := make(chan string, 1)
-	kv.waiters[key] = append(kv.waiters[key], ch) //append waiter channel to the list of waiters for the key
-	//channel is buffered to avoid blocking the sender in rpush
-	kv.mu.Unlock()
-
-	// Wait for value or timeout. timeoutSec == 0 means block indefinitely.
-	if timeoutSec == 0 {
-		val := <-ch
-		resp := Array{BulkString(key), BulkString(val)}
-		return resp, nil
-	}
-
-	timer := time.NewTimer(time.Duration(timeoutSec) * time.Second)
-	select {
-	// Got value not a timeout
-	case val := <-ch:
-		if !timer.Stop() {
-			<-timer.C // drain the timer channel if needed
-		}
-		resp := Array{BulkString(key), BulkString(val)}
-		return resp, nil
-	case <-timer.C:
-		// timeout: remove waiter
-		kv.mu.Lock()
-		waiters := kv.waiters[key]
-		// find and remove ch from waiters slice
-		for i, w := range waiters {
-			if w == ch {
-				kv.waiters[key] = append(waiters[:i], waiters[i+1:]...)
-				break
-			}
+	keys := args[:len(args)-1]
+	return kv.block(keys, "list", timeout, func(key string) (RespValue, bool, error) {
+		vals := kv.popLocked(key, left, 1)
+		if len(vals) == 0 {
+			return nil, false, nil
 		}
-		kv.mu.Unlock()
-		return nil, nil
-	}
+		return Array{BulkString(key), BulkString(vals[0])}, true, nil
+	})
 }
 
 func llen(args []string, kv *Kv) (RespValue, error) {
 	if len(args) != 1 {
 		return nil, errors.New("LLEN requires exactly one argument")
 	}
-	key := args[0]
-	length := kv.LLen(key)
-	return length, nil
+	length, err := kv.LLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return integer(length), nil
 }
 
 func lpop(args []string, kv *Kv) (RespValue, error) {
@@ -415,17 +994,260 @@ func lpop(args []string, kv *Kv) (RespValue, error) {
 	if len(vals) == 1 {
 		return BulkString(vals[0]), nil
 	}
-	respArray := make(Array, len(vals))
-	for i, v := range vals {
-		respArray[i] = BulkString(v)
+	return bulkArray(vals), nil
+}
+
+func lindex(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("LINDEX requires exactly two arguments")
+	}
+	idx, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errors.New("invalid index")
+	}
+	val, ok, err := kv.LIndex(args[0], idx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return BulkString(val), nil
+}
+
+func lset(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("LSET requires exactly three arguments")
+	}
+	idx, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errors.New("invalid index")
+	}
+	if err := kv.LSet(args[0], idx, args[2]); err != nil {
+		return nil, err
+	}
+	return SimpleString("OK"), nil
+}
+
+func linsert(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 4 {
+		return nil, errors.New("LINSERT requires exactly four arguments")
+	}
+	n, err := kv.LInsert(args[0], args[1], args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func ltrim(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("LTRIM requires exactly three arguments")
+	}
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errors.New("invalid start index")
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, errors.New("invalid stop index")
+	}
+	if err := kv.LTrim(args[0], start, stop); err != nil {
+		return nil, err
+	}
+	return SimpleString("OK"), nil
+}
+
+func lrem(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("LREM requires exactly three arguments")
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errors.New("invalid count argument")
+	}
+	n, err := kv.LRem(args[0], count, args[2])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func lmove(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 4 {
+		return nil, errors.New("LMOVE requires exactly four arguments")
+	}
+	for _, where := range args[2:] {
+		if !strings.EqualFold(where, "LEFT") && !strings.EqualFold(where, "RIGHT") {
+			return nil, errors.New("syntax error")
+		}
+	}
+	val, ok, err := kv.LMove(args[0], args[1], args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return BulkString(val), nil
+}
+
+func lpos(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("LPOS requires at least two arguments")
+	}
+	rank, count, maxlen := 1, 1, 0
+	withCount := false
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, errors.New("syntax error")
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return nil, errors.New("value is not an integer or out of range")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			if n == 0 {
+				return nil, errors.New("RANK can't be zero")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return nil, errors.New("COUNT can't be negative")
+			}
+			count = n
+			withCount = true
+		case "MAXLEN":
+			if n < 0 {
+				return nil, errors.New("MAXLEN can't be negative")
+			}
+			maxlen = n
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	matches, err := kv.LPos(args[0], args[1], rank, count, maxlen)
+	if err != nil {
+		return nil, err
+	}
+	if !withCount {
+		if len(matches) == 0 {
+			return nil, nil
+		}
+		return integer(matches[0]), nil
+	}
+	respArray := make(Array, len(matches))
+	for i, m := range matches {
+		respArray[i] = integer(m)
 	}
 	return respArray, nil
 }
 
+// parseMPop parses the "numkeys key [key ...] LEFT|RIGHT [COUNT count]"
+// arguments shared by LMPOP and BLMPOP
+func parseMPop(args []string) (keys []string, dir string, count int, err error) {
+	if len(args) < 3 {
+		return nil, "", 0, errors.New("wrong number of arguments")
+	}
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys <= 0 {
+		return nil, "", 0, errors.New("numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-2 {
+		return nil, "", 0, errors.New("syntax error")
+	}
+	keys = args[1 : numKeys+1]
+	dir = strings.ToUpper(args[numKeys+1])
+	if dir != "LEFT" && dir != "RIGHT" {
+		return nil, "", 0, errors.New("syntax error")
+	}
+	count = 1
+	rest := args[numKeys+2:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || !strings.EqualFold(rest[0], "COUNT") {
+			return nil, "", 0, errors.New("syntax error")
+		}
+		count, err = strconv.Atoi(rest[1])
+		if err != nil || count <= 0 {
+			return nil, "", 0, errors.New("count should be greater than 0")
+		}
+	}
+	return keys, dir, count, nil
+}
+
+// mpopReply formats a multi-key pop result as [key, [values...]]
+func mpopReply(key string, vals []string) RespValue {
+	return Array{BulkString(key), bulkArray(vals)}
+}
+
+func lmpop(args []string, kv *Kv) (RespValue, error) {
+	keys, dir, count, err := parseMPop(args)
+	if err != nil {
+		return nil, err
+	}
+	key, vals, err := kv.LMPop(keys, dir, count)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, nil
+	}
+	return mpopReply(key, vals), nil
+}
+
+func blmpop(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("BLMPOP requires a timeout")
+	}
+	timeout, err := parseTimeout(args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys, dir, count, err := parseMPop(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return kv.block(keys, "list", timeout, func(key string) (RespValue, bool, error) {
+		vals := kv.popLocked(key, dir == "LEFT", count)
+		if len(vals) == 0 {
+			return nil, false, nil
+		}
+		return mpopReply(key, vals), true, nil
+	})
+}
+
 func main() {
 	// You can use print statements as follows for debugging, they'll be visible when running tests.
 	fmt.Println("Logs from your program will appear here!")
 
+	requirepass := flag.String("requirepass", "", "password of the default user")
+	var users []string
+	flag.Func("user", "add an ACL user as name:password[:cmd,cmd...]", func(s string) error {
+		users = append(users, s)
+		return nil
+	})
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [config file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	cfg := newConfig("")
+	if flag.NArg() > 0 {
+		if err := cfg.LoadFile(flag.Arg(0)); err != nil {
+			log.Fatal("Failed to load config file ", err)
+		}
+	}
+	// options given on the command line override the config file
+	if *requirepass != "" {
+		cfg.Set([]string{"requirepass", *requirepass})
+	}
+	for _, u := range users {
+		if err := cfg.parseUser(u); err != nil {
+			log.Fatal("Invalid -user ", err)
+		}
+	}
+
 	l, err := net.Listen("tcp", "0.0.0.0:6379")
 	if err != nil {
 		log.Fatal("Failed to bind to port 6379", err)
@@ -434,23 +1256,14 @@ func main() {
 	defer l.Close()
 	fmt.Println("Server listening on 6379")
 
-	// Initialize key-value store
-	kvStore := NewKv()
+	// Initialize the databases
+	srv := NewServer(cfg)
 
 	// Goroutine to handle expiration of keys
 	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			now := time.Now()
-			kvStore.mu.Lock()
-			for k, exp := range kvStore.exp {
-				if now.After(exp) {
-					delete(kvStore.data, k)
-					delete(kvStore.exp, k)
-				}
-			}
-			kvStore.mu.Unlock()
+		for {
+			time.Sleep(cfg.expireInterval())
+			srv.expire()
 		}
 	}()
 
@@ -463,7 +1276,7 @@ func main() {
 		}
 
 		//Handle Client connections
-		go handleClient(con, kvStore)
+		go handleClient(con, srv)
 	}
 }
 
@@ -537,9 +1350,14 @@ func readRespArray(r *bufio.Reader) ([]string, error) {
 }
 
 // write RESP value to writer
-func writeResp(w *bufio.Writer, val RespValue) error {
+// writeResp writes val to w in the RESP protocol version proto
+func writeResp(w *bufio.Writer, val RespValue, proto int) error {
 	switch v := val.(type) {
 	case nil:
+		if proto >= 3 {
+			_, err := w.WriteString("_\r\n")
+			return err
+		}
 		// Null bulk string
 		_, err := w.WriteString("$-1\r\n")
 		return err
@@ -565,20 +1383,88 @@ func writeResp(w *bufio.Writer, val RespValue) error {
 			return err
 		}
 		for _, elem := range v {
-			if err := writeResp(w, elem); err != nil {
+			if err := writeResp(w, elem, proto); err != nil {
 				return err
 			}
 		}
 		return nil
+	case Map:
+		if proto < 3 {
+			return writeResp(w, Array(v), proto)
+		}
+		if _, err := w.WriteString(fmt.Sprintf("%%%d\r\n", len(v)/2)); err != nil {
+			return err
+		}
+		for _, elem := range v {
+			if err := writeResp(w, elem, proto); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Boolean:
+		if proto < 3 {
+			return writeResp(w, boolInt(bool(v)), proto)
+		}
+		b := "f"
+		if v {
+			b = "t"
+		}
+		_, err := w.WriteString("#" + b + "\r\n")
+		return err
+	case Double:
+		if proto < 3 {
+			return writeResp(w, BulkString(formatFloat(float64(v))), proto)
+		}
+		_, err := w.WriteString("," + formatFloat(float64(v)) + "\r\n")
+		return err
 	default:
 		return errors.New("unsupported RESP type")
 	}
 }
 
-func handleClient(con net.Conn, kv *Kv) {
+// write an error reply, adding the generic error prefix unless the error
+// already carries its own code
+func writeError(w *bufio.Writer, err error) {
+	var re respErr
+	if errors.As(err, &re) {
+		w.WriteString(fmt.Sprintf("-%s\r\n", re.Error()))
+		return
+	}
+	w.WriteString(fmt.Sprintf("-ERR %s\r\n", err.Error()))
+}
+
+// redactArgs returns args with the credentials passed to AUTH and HELLO
+// replaced, so that they can be logged
+func redactArgs(args []string) []string {
+	cmd := strings.ToUpper(args[0])
+	if cmd != "AUTH" && cmd != "HELLO" {
+		return args
+	}
+	out := append([]string(nil), args...)
+	for i := 1; i < len(out); i++ {
+		switch {
+		case cmd == "AUTH":
+			out[i] = "(redacted)"
+		case strings.EqualFold(out[i], "AUTH"):
+			// HELLO ... AUTH <user> <password>
+			for j := i + 1; j < len(out) && j <= i+2; j++ {
+				out[j] = "(redacted)"
+			}
+			i += 2
+		}
+	}
+	return out
+}
+
+func handleClient(con net.Conn, srv *Server) {
 	defer con.Close()
 	r := bufio.NewReader(con)
 	w := bufio.NewWriter(con)
+	c := newClient(srv)
+	c.addr = con.RemoteAddr().String()
+	srv.stats.connectedClients.Add(1)
+	defer srv.stats.connectedClients.Add(-1)
+	srv.stats.totalConnections.Add(1)
 
 	for {
 		// line, err := r.ReadString('\n')
@@ -597,24 +1483,25 @@ func handleClient(con net.Conn, kv *Kv) {
 			continue
 		}
 
-		cmd := strings.ToUpper(args[0])
-		handler, ok := handlers[cmd]
-		if !ok {
-			errMsg := "-Err unknown command\r\n"
-			w.WriteString(errMsg)
+		start := time.Now()
+		resp, err := c.execute(args)
+		if d := time.Since(start); !blockingCommands[strings.ToUpper(args[0])] {
+			srv.logSlow(c, args, d)
+			srv.recordLatency("command", d)
+		}
+		srv.stats.totalCommands.Add(1)
+		if errors.Is(err, errQuit) {
+			writeResp(w, resp, c.respVersion)
 			w.Flush()
-			continue
+			return
 		}
-
-		resp, err := handler(args[1:], kv)
 		if err != nil {
-			errMsg := fmt.Sprintf("-Err %s\r\n", err.Error())
-			w.WriteString(errMsg)
+			writeError(w, err)
 			w.Flush()
 			continue
 		}
 
-		if err := writeResp(w, resp); err != nil {
+		if err := writeResp(w, resp, c.respVersion); err != nil {
 			log.Printf("problem writing response: %v", err)
 			return
 		}
@@ -623,7 +1510,7 @@ func handleClient(con net.Conn, kv *Kv) {
 			return
 		}
 
-		log.Printf("Received Data: %q", args)
+		log.Printf("Received Data: %q", redactArgs(args))
 
 		// if _, err := con.Write([]byte("+PONG\r\n")); err != nil {
 		// 	log.Print("problem writing to connection")
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
+	"math"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestLPushBasic(t *testing.T) {
@@ -84,3 +87,402 @@ func TestLPushConcurrent(t *testing.T) {
 		t.Fatalf("expected non-empty elements in list")
 	}
 }
+
+func TestLLen(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("mylist", "a", "b")
+	kv.RPush("mylist", "c")
+	n, err := kv.LLen("mylist")
+	if err != nil {
+		t.Fatalf("LLen error: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected length 3, got %d", n)
+	}
+	n, err = kv.LLen("missing")
+	if err != nil || n != 0 {
+		t.Fatalf("expected 0 for missing key, got %d (%v)", n, err)
+	}
+	kv.Set("str", "value")
+	if _, err := kv.LLen("str"); !errors.Is(err, errWrongType) {
+		t.Fatalf("expected WRONGTYPE error, got %v", err)
+	}
+}
+
+func TestLIndex(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("mylist", "a", "b", "c")
+	cases := []struct {
+		idx  int
+		want string
+		ok   bool
+	}{
+		{0, "a", true},
+		{2, "c", true},
+		{-1, "c", true},
+		{-3, "a", true},
+		{3, "", false},
+		{-4, "", false},
+	}
+	for _, c := range cases {
+		got, ok, err := kv.LIndex("mylist", c.idx)
+		if err != nil {
+			t.Fatalf("LIndex(%d) error: %v", c.idx, err)
+		}
+		if ok != c.ok || got != c.want {
+			t.Fatalf("LIndex(%d) = %q, %v; want %q, %v", c.idx, got, ok, c.want, c.ok)
+		}
+	}
+	if _, ok, _ := kv.LIndex("missing", 0); ok {
+		t.Fatalf("expected missing key to return false")
+	}
+}
+
+func TestLSet(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("mylist", "a", "b", "c")
+	if err := kv.LSet("mylist", 1, "B"); err != nil {
+		t.Fatalf("LSet error: %v", err)
+	}
+	if err := kv.LSet("mylist", -1, "C"); err != nil {
+		t.Fatalf("LSet error: %v", err)
+	}
+	got, _ := kv.LRange("mylist", 0, -1)
+	want := []string{"a", "B", "C"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("at index %d expected %q got %q", i, want[i], got[i])
+		}
+	}
+	if err := kv.LSet("mylist", 3, "x"); err == nil {
+		t.Fatalf("expected out of range error")
+	}
+	if err := kv.LSet("missing", 0, "x"); err == nil {
+		t.Fatalf("expected error for missing key")
+	}
+}
+
+func TestLInsert(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("mylist", "a", "c")
+	if n, err := kv.LInsert("mylist", "before", "c", "b"); err != nil || n != 3 {
+		t.Fatalf("LInsert BEFORE = %d, %v; want 3", n, err)
+	}
+	if n, err := kv.LInsert("mylist", "AFTER", "c", "d"); err != nil || n != 4 {
+		t.Fatalf("LInsert AFTER = %d, %v; want 4", n, err)
+	}
+	got, _ := kv.LRange("mylist", 0, -1)
+	want := []string{"a", "b", "c", "d"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("at index %d expected %q got %q", i, want[i], got[i])
+		}
+	}
+	if n, _ := kv.LInsert("mylist", "BEFORE", "zz", "x"); n != -1 {
+		t.Fatalf("expected -1 for missing pivot, got %d", n)
+	}
+	if n, _ := kv.LInsert("missing", "BEFORE", "a", "x"); n != 0 {
+		t.Fatalf("expected 0 for missing key, got %d", n)
+	}
+	if _, err := kv.LInsert("mylist", "MIDDLE", "a", "x"); err == nil {
+		t.Fatalf("expected syntax error for invalid position")
+	}
+}
+
+func TestLTrim(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("mylist", "a", "b", "c", "d", "e")
+	if err := kv.LTrim("mylist", 1, -2); err != nil {
+		t.Fatalf("LTrim error: %v", err)
+	}
+	got, _ := kv.LRange("mylist", 0, -1)
+	want := []string{"b", "c", "d"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("at index %d expected %q got %q", i, want[i], got[i])
+		}
+	}
+
+	if err := kv.LTrim("mylist", 2, 1); err != nil {
+		t.Fatalf("LTrim error: %v", err)
+	}
+	if _, ok := kv.lists["mylist"]; ok {
+		t.Fatalf("expected empty list to be deleted")
+	}
+
+	if err := kv.LTrim("missing", 0, 1); err != nil {
+		t.Fatalf("LTrim on missing key error: %v", err)
+	}
+	if _, ok := kv.lists["missing"]; ok {
+		t.Fatalf("LTrim should not create missing key")
+	}
+}
+
+func TestLRem(t *testing.T) {
+	cases := []struct {
+		count   int
+		removed int
+		want    []string
+	}{
+		{2, 2, []string{"b", "a", "c", "a"}},
+		{-2, 2, []string{"a", "b", "a", "c"}},
+		{0, 4, []string{"b", "c"}},
+		{math.MinInt, 4, []string{"b", "c"}},
+	}
+	for _, c := range cases {
+		kv := NewKv()
+		kv.RPush("mylist", "a", "b", "a", "a", "c", "a")
+		n, err := kv.LRem("mylist", c.count, "a")
+		if err != nil {
+			t.Fatalf("LRem(%d) error: %v", c.count, err)
+		}
+		if n != c.removed {
+			t.Fatalf("LRem(%d) removed %d, want %d", c.count, n, c.removed)
+		}
+		got, _ := kv.LRange("mylist", 0, -1)
+		if len(got) != len(c.want) {
+			t.Fatalf("LRem(%d) left %v, want %v", c.count, got, c.want)
+		}
+		for i := range c.want {
+			if got[i] != c.want[i] {
+				t.Fatalf("LRem(%d) left %v, want %v", c.count, got, c.want)
+			}
+		}
+	}
+
+	kv := NewKv()
+	kv.RPush("mylist", "x", "y")
+	if n, _ := kv.LRem("mylist", 0, "z"); n != 0 {
+		t.Fatalf("expected 0 removals, got %d", n)
+	}
+	if n, _ := kv.LLen("mylist"); n != 2 {
+		t.Fatalf("expected list to be unchanged, got length %d", n)
+	}
+}
+
+func TestLMove(t *testing.T) {
+	cases := []struct {
+		from, to string
+		moved    string
+		src, dst []string
+	}{
+		{"LEFT", "LEFT", "a", []string{"b", "c"}, []string{"a", "x", "y"}},
+		{"LEFT", "RIGHT", "a", []string{"b", "c"}, []string{"x", "y", "a"}},
+		{"RIGHT", "LEFT", "c", []string{"a", "b"}, []string{"c", "x", "y"}},
+		{"RIGHT", "RIGHT", "c", []string{"a", "b"}, []string{"x", "y", "c"}},
+	}
+	for _, c := range cases {
+		kv := NewKv()
+		kv.RPush("src", "a", "b", "c")
+		kv.RPush("dst", "x", "y")
+		val, ok, err := kv.LMove("src", "dst", c.from, c.to)
+		if err != nil || !ok || val != c.moved {
+			t.Fatalf("LMove %s %s = %q, %v, %v; want %q", c.from, c.to, val, ok, err, c.moved)
+		}
+		for name, want := range map[string][]string{"src": c.src, "dst": c.dst} {
+			got, _ := kv.LRange(name, 0, -1)
+			if len(got) != len(want) {
+				t.Fatalf("LMove %s %s: %s = %v, want %v", c.from, c.to, name, got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("LMove %s %s: %s = %v, want %v", c.from, c.to, name, got, want)
+				}
+			}
+		}
+	}
+
+	kv := NewKv()
+	if _, ok, _ := kv.LMove("empty", "dst", "LEFT", "RIGHT"); ok {
+		t.Fatalf("expected no move from empty source")
+	}
+}
+
+func TestLPos(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("mylist", "a", "b", "c", "1", "2", "3", "c", "c")
+	cases := []struct {
+		rank, count, maxlen int
+		want                []int
+	}{
+		{1, 1, 0, []int{2}},
+		{1, 0, 0, []int{2, 6, 7}},
+		{2, 0, 0, []int{6, 7}},
+		{-1, 1, 0, []int{7}},
+		{-1, 2, 0, []int{7, 6}},
+		{1, 0, 3, []int{2}},
+		{-1, 0, 2, []int{7, 6}},
+	}
+	for _, c := range cases {
+		got, err := kv.LPos("mylist", "c", c.rank, c.count, c.maxlen)
+		if err != nil {
+			t.Fatalf("LPos error: %v", err)
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("LPos(rank=%d count=%d maxlen=%d) = %v, want %v", c.rank, c.count, c.maxlen, got, c.want)
+		}
+		for i := range c.want {
+			if got[i] != c.want[i] {
+				t.Fatalf("LPos(rank=%d count=%d maxlen=%d) = %v, want %v", c.rank, c.count, c.maxlen, got, c.want)
+			}
+		}
+	}
+	if got, _ := kv.LPos("mylist", "zz", 1, 1, 0); len(got) != 0 {
+		t.Fatalf("expected no match, got %v", got)
+	}
+}
+
+func TestLMPop(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("b", "1", "2", "3")
+	key, vals, err := kv.LMPop([]string{"a", "b"}, "RIGHT", 2)
+	if err != nil {
+		t.Fatalf("LMPop error: %v", err)
+	}
+	if key != "b" || len(vals) != 2 || vals[0] != "3" || vals[1] != "2" {
+		t.Fatalf("LMPop = %q %v, want b [3 2]", key, vals)
+	}
+	key, vals, _ = kv.LMPop([]string{"a", "b"}, "LEFT", 5)
+	if key != "b" || len(vals) != 1 || vals[0] != "1" {
+		t.Fatalf("LMPop = %q %v, want b [1]", key, vals)
+	}
+	if key, _, _ := kv.LMPop([]string{"a", "b"}, "LEFT", 1); key != "" {
+		t.Fatalf("expected empty key when all lists are empty, got %q", key)
+	}
+	if _, err := lmpop([]string{"9223372036854775806", "l", "LEFT"}, kv); err == nil {
+		t.Fatalf("expected error for numkeys overflowing the argument count")
+	}
+}
+
+func TestSetNXXX(t *testing.T) {
+	kv := NewKv()
+	if resp, err := set([]string{"k", "v1", "NX"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("SET NX on new key = %v, %v; want OK", resp, err)
+	}
+	if resp, _ := set([]string{"k", "v2", "nx"}, kv); resp != nil {
+		t.Fatalf("SET NX on existing key = %v, want nil", resp)
+	}
+	if resp, _ := set([]string{"k", "v3", "XX"}, kv); resp != SimpleString("OK") {
+		t.Fatalf("SET XX on existing key = %v, want OK", resp)
+	}
+	if val, _, _ := kv.Get("k"); val != "v3" {
+		t.Fatalf("k = %q, want v3", val)
+	}
+	if resp, _ := set([]string{"missing", "v", "XX"}, kv); resp != nil {
+		t.Fatalf("SET XX on missing key = %v, want nil", resp)
+	}
+	if _, ok, _ := kv.Get("missing"); ok {
+		t.Fatalf("expected SET XX not to create the key")
+	}
+	if _, err := set([]string{"k", "v", "NX", "XX"}, kv); err == nil {
+		t.Fatalf("expected syntax error for NX with XX")
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	kv := NewKv()
+	if resp, err := set([]string{"k", "v1", "GET"}, kv); err != nil || resp != nil {
+		t.Fatalf("SET GET on missing key = %v, %v; want nil", resp, err)
+	}
+	if resp, _ := set([]string{"k", "v2", "GET"}, kv); resp != BulkString("v1") {
+		t.Fatalf("SET GET = %v, want v1", resp)
+	}
+	// NX GET returns the old value even though nothing is set
+	if resp, _ := set([]string{"k", "v3", "NX", "GET"}, kv); resp != BulkString("v2") {
+		t.Fatalf("SET NX GET = %v, want v2", resp)
+	}
+	if val, _, _ := kv.Get("k"); val != "v2" {
+		t.Fatalf("k = %q, want v2", val)
+	}
+	kv.RPush("list", "x")
+	if _, err := set([]string{"list", "v", "GET"}, kv); !errors.Is(err, errWrongType) {
+		t.Fatalf("SET GET on list err = %v, want WRONGTYPE", err)
+	}
+}
+
+func TestSetKeepTTL(t *testing.T) {
+	kv := NewKv()
+	set([]string{"k", "v1", "EX", "100"}, kv)
+	exp := kv.exp["k"]
+	if resp, err := set([]string{"k", "v2", "KEEPTTL"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("SET KEEPTTL = %v, %v; want OK", resp, err)
+	}
+	if got, ok := kv.exp["k"]; !ok || !got.Equal(exp) {
+		t.Fatalf("expiry after SET KEEPTTL = %v, want %v", got, exp)
+	}
+	if val, _, _ := kv.Get("k"); val != "v2" {
+		t.Fatalf("k = %q, want v2", val)
+	}
+	set([]string{"k", "v3"}, kv)
+	if _, ok := kv.exp["k"]; ok {
+		t.Fatalf("expected plain SET to clear the TTL")
+	}
+	for _, args := range [][]string{
+		{"k", "v", "KEEPTTL", "PX", "100"},
+		{"k", "v", "KEEPTTL", "EX", "0"},
+		{"k", "v", "EX", "10", "PXAT", "99999999999999"},
+		{"k", "v", "EX", "10", "EX", "20"},
+	} {
+		if _, err := set(args, kv); err == nil || err.Error() != "syntax error" {
+			t.Fatalf("SET %v = %v, want a syntax error", args, err)
+		}
+	}
+	// EX and PX must be positive and fit a duration
+	for _, args := range [][]string{
+		{"k", "v", "EX", "0"},
+		{"k", "v", "PX", "-1"},
+		{"k", "v", "EX", "9223372036854775807"},
+	} {
+		if _, err := set(args, kv); err == nil || err.Error() != "invalid expire time in 'set' command" {
+			t.Fatalf("SET %v = %v, want an invalid expire time error", args, err)
+		}
+	}
+	if _, ok, _ := kv.Get("k"); !ok {
+		t.Fatalf("failed SETs must leave k alone")
+	}
+}
+
+func TestSetExpireAt(t *testing.T) {
+	kv := NewKv()
+	at := time.Now().Add(5 * time.Second).Truncate(time.Second)
+	if resp, err := set([]string{"k", "v", "EXAT", strconv.FormatInt(at.Unix(), 10)}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("SET EXAT = %v, %v; want OK", resp, err)
+	}
+	if !kv.exp["k"].Equal(at) {
+		t.Fatalf("SET EXAT expiry = %v, want %v", kv.exp["k"], at)
+	}
+
+	at = time.Now().Add(50 * time.Millisecond).Truncate(time.Millisecond)
+	set([]string{"p", "v", "PXAT", strconv.FormatInt(at.UnixMilli(), 10)}, kv)
+	if !kv.exp["p"].Equal(at) {
+		t.Fatalf("SET PXAT expiry = %v, want %v", kv.exp["p"], at)
+	}
+	if _, ok, _ := kv.Get("p"); !ok {
+		t.Fatalf("expected p to exist before its expiry")
+	}
+	time.Sleep(time.Until(at) + 10*time.Millisecond)
+	if _, ok, _ := kv.Get("p"); ok {
+		t.Fatalf("expected p to have expired")
+	}
+
+	past := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	if _, err := set([]string{"k", "v", "EXAT", past}, kv); err == nil {
+		t.Fatalf("expected error for EXAT in the past")
+	}
+	if _, err := set([]string{"k", "v", "PXAT", "abc"}, kv); err == nil {
+		t.Fatalf("expected error for non-integer PXAT")
+	}
+}
+
+func TestWait(t *testing.T) {
+	kv := NewKv()
+	if resp, err := wait([]string{"1", "100"}, kv); err != nil || resp != integer(0) {
+		t.Fatalf("WAIT = %v, %v; want 0", resp, err)
+	}
+	if _, err := wait([]string{"1", "-1"}, kv); err == nil {
+		t.Fatalf("expected error for negative timeout")
+	}
+}
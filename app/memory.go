@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// Memory usage estimates. Go does not report the size of a value, so it is
+// added up from the size of the headers and the bytes they point to, plus
+// estimated map overheads.
+const (
+	stringHeaderSize = int64(unsafe.Sizeof(""))
+	sliceHeaderSize  = int64(unsafe.Sizeof([]string(nil)))
+	// mapOverhead is the estimated size of an empty map
+	mapOverhead = 48
+	// mapEntryOverhead is the estimated cost of a map entry on top of its
+	// key and value, from the bucket's hash bits and unused slots
+	mapEntryOverhead = 16
+	// memorySamples is the number of elements MEMORY USAGE samples by default
+	memorySamples = 5
+)
+
+// stringSize estimates the memory of s, header included
+func stringSize(s string) int64 {
+	return stringHeaderSize + int64(len(s))
+}
+
+// sizeSampler estimates the size of an aggregate value from the size of a
+// limited number of its elements
+type sizeSampler struct {
+	// limit is the number of elements to sample, 0 meaning all of them
+	limit, seen int
+	total       int64
+}
+
+// add records the size of an element, reporting whether to sample more
+func (s *sizeSampler) add(size int64) bool {
+	s.total += size
+	s.seen++
+	return s.limit == 0 || s.seen < s.limit
+}
+
+// estimate returns the estimated size of n elements
+func (s *sizeSampler) estimate(n int) int64 {
+	if s.seen == 0 {
+		return 0
+	}
+	return s.total * int64(n) / int64(s.seen)
+}
+
+// MemoryUsage: get the estimated number of bytes used by key and its value,
+// sampling up to samples elements of aggregate values (all with 0)
+func (k *Kv) MemoryUsage(key string, samples int) (int64, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	typ := k.typeOf(key)
+	if typ == "none" {
+		return 0, false
+	}
+	return k.memoryUsageLocked(key, typ, samples), true
+}
+
+// memoryUsageLocked estimates the memory of key holding typ. Callers must
+// hold k.mu.
+func (k *Kv) memoryUsageLocked(key, typ string, samples int) int64 {
+	size := stringSize(key) + mapEntryOverhead
+	if _, ok := k.exp[key]; ok {
+		size += stringSize(key) + int64(unsafe.Sizeof(time.Time{})) + mapEntryOverhead
+	}
+	s := sizeSampler{limit: samples}
+	switch typ {
+	case "string":
+		size += stringSize(k.data[key])
+	case "list":
+		list := k.lists[key]
+		for _, elem := range list {
+			if !s.add(stringSize(elem)) {
+				break
+			}
+		}
+		size += sliceHeaderSize + s.estimate(len(list))
+	case "hash":
+		h := k.hashes[key]
+		for f, v := range h {
+			if !s.add(stringSize(f) + stringSize(v) + mapEntryOverhead) {
+				break
+			}
+		}
+		size += mapOverhead + s.estimate(len(h))
+	case "set":
+		set := k.sets[key]
+		for m := range set {
+			if !s.add(stringSize(m) + mapEntryOverhead) {
+				break
+			}
+		}
+		size += mapOverhead + s.estimate(len(set))
+	case "zset":
+		z := k.zsets[key]
+		// each member is in the members map and, sharing its bytes, in the
+		// index
+		for _, e := range z.index {
+			if !s.add(stringSize(e.member) + 8 + mapEntryOverhead + int64(unsafe.Sizeof(e))) {
+				break
+			}
+		}
+		size += int64(unsafe.Sizeof(*z)) + mapOverhead + s.estimate(len(z.index))
+	case "stream":
+		size += streamMemoryUsage(k.streams[key], &s)
+	}
+	return size
+}
+
+// streamMemoryUsage estimates the memory of st, sampling its entries with s
+func streamMemoryUsage(st *Stream, s *sizeSampler) int64 {
+	for _, e := range st.entries {
+		size := int64(unsafe.Sizeof(e))
+		for _, f := range e.Fields {
+			size += stringSize(f)
+		}
+		if !s.add(size) {
+			break
+		}
+	}
+	size := int64(unsafe.Sizeof(*st)) + s.estimate(len(st.entries)) + mapOverhead
+	pendingSize := int64(unsafe.Sizeof(StreamID{})+unsafe.Sizeof(pendingEntry{})) + mapEntryOverhead
+	for name, g := range st.groups {
+		size += stringSize(name) + int64(unsafe.Sizeof(*g)) + 2*mapOverhead + mapEntryOverhead
+		size += int64(len(g.pending)) * pendingSize
+		for cname, c := range g.consumers {
+			size += stringSize(cname) + int64(unsafe.Sizeof(*c)) + mapOverhead + mapEntryOverhead
+			size += int64(len(c.pending)) * (int64(unsafe.Sizeof(StreamID{})) + mapEntryOverhead)
+		}
+	}
+	return size
+}
+
+// DatasetBytes: get the estimated memory used by the keys and values of
+// the database
+func (k *Kv) DatasetBytes() int64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var size int64
+	for _, key := range k.keysLocked() {
+		size += k.memoryUsageLocked(key, k.typeOf(key), memorySamples)
+	}
+	return size
+}
+
+// memoryDoctor returns a diagnosis of the memory issues found in m
+func memoryDoctor(m *runtime.MemStats, maxmemory int64) string {
+	var issues []string
+	if maxmemory > 0 && int64(m.HeapAlloc) > maxmemory {
+		issues = append(issues, fmt.Sprintf("Used memory (%d bytes) is above maxmemory (%d bytes). There is no eviction policy, so the server keeps growing: delete keys or raise maxmemory.", m.HeapAlloc, maxmemory))
+	}
+	// memory the heap holds on to without using it
+	if idle := m.HeapIdle - m.HeapReleased; m.HeapInuse > 0 && idle > m.HeapInuse && idle > 64<<20 {
+		issues = append(issues, fmt.Sprintf("High fragmentation: %d bytes of heap are unused but not returned to the OS. MEMORY PURGE returns them.", idle))
+	}
+	if m.NumGC > 0 && m.GCCPUFraction > 0.1 {
+		issues = append(issues, fmt.Sprintf("The garbage collector used %.1f%% of the CPU time. The dataset may hold many small values; consider grouping them in hashes.", m.GCCPUFraction*100))
+	}
+	if len(issues) == 0 {
+		return "No memory issues found in this instance."
+	}
+	return "Memory issues found in this instance:\n\n * " + strings.Join(issues, "\n\n * ") + "\n"
+}
+
+// mallocStats formats the Go runtime memory statistics of m
+func mallocStats(m *runtime.MemStats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Go runtime memory stats (%s):\n", runtime.Version())
+	for _, stat := range []struct {
+		name  string
+		value uint64
+	}{
+		{"heap_alloc", m.HeapAlloc},
+		{"heap_sys", m.HeapSys},
+		{"heap_idle", m.HeapIdle},
+		{"heap_inuse", m.HeapInuse},
+		{"heap_released", m.HeapReleased},
+		{"heap_objects", m.HeapObjects},
+		{"total_alloc", m.TotalAlloc},
+		{"mallocs", m.Mallocs},
+		{"frees", m.Frees},
+		{"stack_inuse", m.StackInuse},
+		{"sys", m.Sys},
+		{"num_gc", uint64(m.NumGC)},
+	} {
+		fmt.Fprintf(&b, "%s: %d\n", stat.name, stat.value)
+	}
+	return b.String()
+}
+
+// MemoryStats: get the memory metrics of MEMORY STATS, as alternating names
+// and values
+func (s *Server) MemoryStats() Map {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	keys := 0
+	var dataset int64
+	var dbs Map
+	for i, kv := range s.dbs {
+		n := kv.DBSize()
+		if n == 0 {
+			continue
+		}
+		keys += n
+		dataset += kv.DatasetBytes()
+		expires, _ := kv.ExpiresInfo()
+		dbs = append(dbs, BulkString(fmt.Sprintf("db.%d", i)), Map{
+			BulkString("overhead.hashtable.main"), integer(mapOverhead + int64(n)*(stringHeaderSize+mapEntryOverhead)),
+			BulkString("overhead.hashtable.expires"), integer(mapOverhead + int64(expires)*(stringHeaderSize+mapEntryOverhead)),
+		})
+	}
+	ratio := func(a, b uint64) Double {
+		if b == 0 {
+			return 0
+		}
+		return Double(float64(a) / float64(b))
+	}
+	resident := m.Sys - m.HeapReleased
+	var bytesPerKey uint64
+	if keys > 0 {
+		bytesPerKey = m.HeapAlloc / uint64(keys)
+	}
+	stats := Map{
+		BulkString("total.allocated"), integer(m.HeapAlloc),
+		BulkString("dataset.bytes"), integer(dataset),
+		BulkString("dataset.percentage"), ratio(100*uint64(dataset), m.HeapAlloc),
+		BulkString("keys.count"), integer(keys),
+		BulkString("keys.bytes-per-key"), integer(bytesPerKey),
+		BulkString("allocator.allocated"), integer(m.HeapAlloc),
+		BulkString("allocator.active"), integer(m.HeapInuse),
+		BulkString("allocator.resident"), integer(resident),
+		BulkString("allocator.fragmentation.ratio"), ratio(m.HeapInuse, m.HeapAlloc),
+		BulkString("rss-overhead.ratio"), ratio(resident, m.HeapInuse),
+	}
+	return append(stats, dbs...)
+}
+
+var memoryHelp = []string{
+	"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"DOCTOR",
+	"    Return memory problems reports.",
+	"MALLOC-STATS",
+	"    Return internal statistics report from the memory allocator.",
+	"PURGE",
+	"    Attempt to purge dirty pages for reclamation by the allocator.",
+	"STATS",
+	"    Return information about the memory usage of the server.",
+	"USAGE <key> [SAMPLES <count>]",
+	"    Return memory in bytes used by <key> and its value. Nested values are",
+	"    sampled up to <count> times (default: 5, 0 means sample all).",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handlers for memory commands
+
+func memory(args []string, c *client) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("MEMORY requires a subcommand")
+	}
+	sub := strings.ToUpper(args[0])
+	if sub == "USAGE" {
+		return memoryUsage(args[1:], c.kv())
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments for 'memory|%s' command", strings.ToLower(sub))
+	}
+	switch sub {
+	case "DOCTOR", "MALLOC-STATS":
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		if sub == "MALLOC-STATS" {
+			return BulkString(mallocStats(&m)), nil
+		}
+		return BulkString(memoryDoctor(&m, c.cfg.maxMemory())), nil
+	case "PURGE":
+		debug.FreeOSMemory()
+		return SimpleString("OK"), nil
+	case "STATS":
+		return c.srv.MemoryStats(), nil
+	case "HELP":
+		return bulkArray(memoryHelp), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try MEMORY HELP.", args[0])
+	}
+}
+
+func memoryUsage(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 && len(args) != 3 {
+		return nil, errors.New("wrong number of arguments for 'memory|usage' command")
+	}
+	samples := memorySamples
+	if len(args) == 3 {
+		if strings.ToUpper(args[1]) != "SAMPLES" {
+			return nil, errors.New("syntax error")
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 0 {
+			return nil, errors.New("value is out of range, must be positive")
+		}
+		samples = n
+	}
+	size, ok := kv.MemoryUsage(args[0], samples)
+	if !ok {
+		return nil, nil
+	}
+	return integer(size), nil
+}
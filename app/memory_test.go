@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	kv := NewKv()
+	kv.Set("short", "v")
+	kv.Set("long1", strings.Repeat("x", 1000))
+	small, _ := kv.MemoryUsage("short", 0)
+	big, _ := kv.MemoryUsage("long1", 0)
+	if big-small != 999 {
+		t.Fatalf("MemoryUsage(long1) - MemoryUsage(short) = %d, want 999", big-small)
+	}
+	if _, ok := kv.MemoryUsage("missing", 0); ok {
+		t.Fatalf("MemoryUsage of a missing key succeeded")
+	}
+	kv.Expire("short", time.Hour, ExpireOption{})
+	if withTTL, _ := kv.MemoryUsage("short", 0); withTTL <= small {
+		t.Fatalf("MemoryUsage with a TTL = %d, want more than %d", withTTL, small)
+	}
+
+	// every type grows with its elements
+	for i := 0; i < 100; i++ {
+		s := strconv.Itoa(i)
+		kv.RPush("list", s)
+		kv.HSet("hash", s, s)
+		kv.SAdd("set", s)
+		kv.ZAdd("zset", ZAddOpts{}, zsetEntry{float64(i), s})
+		kv.XAdd("stream", StreamID{}, XAddOpts{AutoID: true}, []string{"f", s})
+	}
+	for _, key := range []string{"list", "hash", "set", "zset", "stream"} {
+		all, ok := kv.MemoryUsage(key, 0)
+		if !ok || all < 100*int64(len("99")) {
+			t.Fatalf("MemoryUsage(%s) = %d, %v; want at least the size of its elements", key, all, ok)
+		}
+		// elements of similar size extrapolate to about the same total
+		sampled, _ := kv.MemoryUsage(key, 5)
+		if sampled < all*8/10 || sampled > all*12/10 {
+			t.Fatalf("MemoryUsage(%s) sampling 5 = %d, want about %d", key, sampled, all)
+		}
+	}
+	// consumer groups count towards the stream
+	before, _ := kv.MemoryUsage("stream", 0)
+	kv.XGroupCreate("stream", "g", StreamID{}, false, 0)
+	kv.XGroupCreateConsumer("stream", "g", "alice")
+	if after, _ := kv.MemoryUsage("stream", 0); after <= before {
+		t.Fatalf("MemoryUsage(stream) with a group = %d, want more than %d", after, before)
+	}
+}
+
+func TestMemoryCommands(t *testing.T) {
+	c := newClient(NewServer(newConfig("")))
+	c.kv().Set("k", "v")
+	resp, err := memory([]string{"USAGE", "k", "SAMPLES", "0"}, c)
+	if n, ok := resp.(integer); err != nil || !ok || n <= 0 {
+		t.Fatalf("MEMORY USAGE = %v, %v; want a size", resp, err)
+	}
+	if resp, err := memory([]string{"usage", "missing"}, c); err != nil || resp != nil {
+		t.Fatalf("MEMORY USAGE missing = %v, %v; want nil", resp, err)
+	}
+	for _, args := range [][]string{{"USAGE"}, {"USAGE", "k", "SAMPLES"}, {"USAGE", "k", "SAMPLES", "-1"}, {"USAGE", "k", "COUNT", "1"}, {"STATS", "x"}, {"NOSUCH"}} {
+		if _, err := memory(args, c); err == nil {
+			t.Fatalf("MEMORY %v succeeded", args)
+		}
+	}
+
+	if resp, err := memory([]string{"PURGE"}, c); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("MEMORY PURGE = %v, %v; want OK", resp, err)
+	}
+	for _, sub := range []string{"DOCTOR", "MALLOC-STATS"} {
+		resp, err := memory([]string{sub}, c)
+		if s, ok := resp.(BulkString); err != nil || !ok || s == "" {
+			t.Fatalf("MEMORY %s = %v, %v; want a report", sub, resp, err)
+		}
+	}
+
+	// a tiny maxmemory is always exceeded
+	c.cfg.Set([]string{"maxmemory", "1"})
+	resp, _ = memory([]string{"DOCTOR"}, c)
+	if !strings.Contains(string(resp.(BulkString)), "above maxmemory") {
+		t.Fatalf("MEMORY DOCTOR = %q, want the maxmemory issue", resp)
+	}
+
+	c.srv.dbs[3].Set("other", "v")
+	resp, err = memory([]string{"STATS"}, c)
+	if err != nil {
+		t.Fatalf("MEMORY STATS: %v", err)
+	}
+	stats := map[string]RespValue{}
+	for i, m := 0, resp.(Map); i+1 < len(m); i += 2 {
+		stats[string(m[i].(BulkString))] = m[i+1]
+	}
+	if stats["keys.count"] != integer(2) {
+		t.Fatalf("keys.count = %v, want 2", stats["keys.count"])
+	}
+	if _, ok := stats["dataset.bytes"].(integer); !ok {
+		t.Fatalf("dataset.bytes = %v, want an integer", stats["dataset.bytes"])
+	}
+	if _, ok := stats["allocator.fragmentation.ratio"].(Double); !ok {
+		t.Fatalf("allocator.fragmentation.ratio = %v, want a double", stats["allocator.fragmentation.ratio"])
+	}
+	for _, db := range []string{"db.0", "db.3"} {
+		if _, ok := stats[db].(Map); !ok {
+			t.Fatalf("MEMORY STATS has no %s: %v", db, resp)
+		}
+	}
+	if _, ok := stats["db.1"]; ok {
+		t.Fatalf("MEMORY STATS reports the empty db.1")
+	}
+}
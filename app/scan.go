@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// globMatch reports whether str matches the glob-style pattern, supporting
+// `*` (any run of characters), `?` (a single character), `[abc]`, `[^abc]`
+// and `[a-z]` character classes and `\` to escape the next character.
+//
+// Every token other than `*` matches exactly one character, so on a mismatch
+// it is enough to go back to the last `*` and let it take one more character:
+// the match runs in O(len(pattern)*len(str)) instead of backtracking into
+// every earlier star.
+func globMatch(pattern, str string) bool {
+	p, s := 0, 0
+	// where to resume after the last star, -1 before any
+	starP, starS := -1, 0
+	for {
+		if p < len(pattern) && pattern[p] == '*' {
+			p++
+			starP, starS = p, s
+			continue
+		}
+		if s == len(str) {
+			break
+		}
+		if p < len(pattern) {
+			if matched, n := matchToken(pattern[p:], str[s]); matched {
+				p += n
+				s++
+				continue
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, s = starP, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchToken matches c against the token at the start of pattern, which is
+// not a `*`. It returns whether c matched and the length of the token.
+func matchToken(pattern string, c byte) (bool, int) {
+	switch pattern[0] {
+	case '?':
+		return true, 1
+	case '[':
+		matched, rest, ok := matchClass(pattern[1:], c)
+		if !ok {
+			// unterminated class, treat '[' literally
+			return c == '[', 1
+		}
+		return matched, len(pattern) - len(rest)
+	case '\\':
+		if len(pattern) > 1 {
+			return pattern[1] == c, 2
+		}
+	}
+	return pattern[0] == c, 1
+}
+
+// matchClass matches c against the character class at the start of pattern
+// (just after the opening '['). It returns whether c matched, the pattern
+// following the closing ']' and false if the class is unterminated.
+func matchClass(pattern string, c byte) (bool, string, bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+	matched := false
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			return matched != negate, pattern[i+1:], true
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				matched = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			i += 2
+		default:
+			if pattern[i] == c {
+				matched = true
+			}
+		}
+	}
+	return false, "", false
+}
+
+// scanOpts holds the arguments shared by the *SCAN commands
+type scanOpts struct {
+	cursor   int
+	match    string
+	count    int
+	noValues bool
+	typ      string
+}
+
+// parseScanArgs parses "cursor [MATCH pattern] [COUNT count] [NOVALUES]
+// [TYPE type]"
+func parseScanArgs(args []string) (scanOpts, error) {
+	opts := scanOpts{count: 10}
+	if len(args) < 1 {
+		return opts, errors.New("wrong number of arguments")
+	}
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		return opts, errors.New("invalid cursor")
+	}
+	opts.cursor = cursor
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			if i+1 >= len(args) {
+				return opts, errors.New("syntax error")
+			}
+			opts.match = args[i+1]
+			i++
+		case "COUNT":
+			if i+1 >= len(args) {
+				return opts, errors.New("syntax error")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return opts, errors.New("value is not an integer or out of range")
+			}
+			opts.count = n
+			i++
+		case "NOVALUES":
+			opts.noValues = true
+		case "TYPE":
+			if i+1 >= len(args) {
+				return opts, errors.New("syntax error")
+			}
+			opts.typ = strings.ToLower(args[i+1])
+			i++
+		default:
+			return opts, errors.New("syntax error")
+		}
+	}
+	return opts, nil
+}
+
+// scanBounds returns the positions [lo, hi) of the page of a sorted
+// collection of n items starting at offset cursor and holding at most count
+// of them, along with the cursor of the next page (0 once the iteration is
+// complete).
+func scanBounds(n, cursor, count int) (next, lo, hi int) {
+	if cursor >= n {
+		return 0, n, n
+	}
+	if count >= n-cursor {
+		return 0, cursor, n
+	}
+	end := cursor + count
+	return end, cursor, end
+}
+
+// scanReply formats a *SCAN result as [cursor, [elements...]]
+func scanReply(next int, elems []string) RespValue {
+	return Array{BulkString(strconv.Itoa(next)), bulkArray(elems)}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, str string
+		want         bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"h*llo", "hello", true},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hallo!", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"user:*:name", "user:42:name", true},
+		{"*:name", "user:42:name:name", true},
+		{"a*", "a", true},
+		{"a*b", "a", false},
+		{"*?", "", false},
+		{"*[0-9]", "key9", true},
+		{`*\*`, "key*", true},
+		{"[abc", "[abc", true},
+		{"**x**", "x", true},
+		// pathological for a backtracking matcher (CVE-2022-36021)
+		{"*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 100), false},
+	}
+	for _, c := range cases {
+		if got := globMatch(c.pattern, c.str); got != c.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", c.pattern, c.str, got, c.want)
+		}
+	}
+}
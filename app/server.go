@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// numDBs is the number of databases clients can SELECT
+const numDBs = 16
+
+var errDBRange = errors.New("DB index is out of range")
+
+// Server holds the databases and settings shared by all connections
+type Server struct {
+	dbs     [numDBs]*Kv
+	cfg     *Config
+	stats   ServerStats
+	slowlog slowLog
+	latency LatencyMonitor
+}
+
+// constructor function for Server
+func NewServer(cfg *Config) *Server {
+	s := &Server{cfg: cfg}
+	s.stats.startTime = time.Now()
+	for i := range s.dbs {
+		s.dbs[i] = NewKv()
+	}
+	return s
+}
+
+// parseDB parses a database index, checking it is in range
+func parseDB(arg string) (int, error) {
+	db, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, errors.New("value is not an integer or out of range")
+	}
+	if db < 0 || db >= numDBs {
+		return 0, errDBRange
+	}
+	return db, nil
+}
+
+// lockDBs locks databases i and j, in index order so concurrent callers
+// cannot deadlock, and returns the function unlocking them
+func (s *Server) lockDBs(i, j int) func() {
+	if i == j {
+		s.dbs[i].mu.Lock()
+		return s.dbs[i].mu.Unlock
+	}
+	if i > j {
+		i, j = j, i
+	}
+	s.dbs[i].mu.Lock()
+	s.dbs[j].mu.Lock()
+	return func() {
+		s.dbs[j].mu.Unlock()
+		s.dbs[i].mu.Unlock()
+	}
+}
+
+// Copy: copy the value at src in database srcDB to dst in database dstDB,
+// replacing an existing dst only when replace is set
+func (s *Server) Copy(srcDB, dstDB int, src, dst string, replace bool) bool {
+	defer s.lockDBs(srcDB, dstDB)()
+	return copyLocked(s.dbs[srcDB], src, s.dbs[dstDB], dst, replace)
+}
+
+// Move: move key from database srcDB to dstDB, unless it already exists
+// there
+func (s *Server) Move(srcDB, dstDB int, key string) bool {
+	defer s.lockDBs(srcDB, dstDB)()
+	from, to := s.dbs[srcDB], s.dbs[dstDB]
+	typ := from.typeOf(key)
+	if typ == "none" || to.typeOf(key) != "none" {
+		return false
+	}
+	switch typ {
+	case "string":
+		to.data[key] = from.data[key]
+	case "list":
+		to.lists[key] = from.lists[key]
+	case "hash":
+		to.hashes[key] = from.hashes[key]
+	case "set":
+		to.sets[key] = from.sets[key]
+	case "zset":
+		to.zsets[key] = from.zsets[key]
+	case "stream":
+		to.streams[key] = from.streams[key]
+	}
+	if expTime, ok := from.exp[key]; ok {
+		to.exp[key] = expTime
+	}
+	if at, ok := from.accessed[key]; ok {
+		to.accessed[key] = at
+	}
+	from.deleteLocked(key)
+	to.wake(key)
+	return true
+}
+
+// FlushAll: delete every key in every database
+func (s *Server) FlushAll() {
+	for _, kv := range s.dbs {
+		kv.FlushDB()
+	}
+}
+
+// expire deletes the keys of every database whose TTL has passed
+func (s *Server) expire() {
+	now := time.Now()
+	defer func() { s.recordLatency("expire-cycle", time.Since(now)) }()
+	for _, kv := range s.dbs {
+		kv.mu.Lock()
+		for k, exp := range kv.exp {
+			if now.After(exp) {
+				kv.deleteLocked(k)
+			}
+		}
+		kv.mu.Unlock()
+	}
+}
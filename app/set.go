@@ -0,0 +1,585 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// set operations:
+// SAdd: add members to the set stored at key. Returns the number of members
+// that were not already present.
+func (k *Kv) SAdd(key string, members ...string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "set"); err != nil {
+		return 0, err
+	}
+	set, ok := k.sets[key]
+	if !ok {
+		set = make(map[string]struct{})
+		k.sets[key] = set
+	}
+	added := 0
+	for _, m := range members {
+		if _, exists := set[m]; !exists {
+			set[m] = struct{}{}
+			added++
+		}
+	}
+	return added, nil
+}
+
+// SRem: remove members from the set stored at key, deleting the key once the
+// set is empty. Returns the number of removed members.
+func (k *Kv) SRem(key string, members ...string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "set"); err != nil {
+		return 0, err
+	}
+	set, ok := k.sets[key]
+	if !ok {
+		return 0, nil
+	}
+	removed := 0
+	for _, m := range members {
+		if _, exists := set[m]; exists {
+			delete(set, m)
+			removed++
+		}
+	}
+	if len(set) == 0 {
+		k.deleteLocked(key)
+	}
+	return removed, nil
+}
+
+// SMembers: get all members of the set stored at key in sorted order
+func (k *Kv) SMembers(key string) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "set"); err != nil {
+		return nil, err
+	}
+	return sortedMembers(k.sets[key]), nil
+}
+
+// SCard: get the number of members of the set stored at key
+func (k *Kv) SCard(key string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "set"); err != nil {
+		return 0, err
+	}
+	return len(k.sets[key]), nil
+}
+
+// SIsMember: report whether member belongs to the set stored at key
+func (k *Kv) SIsMember(key, member string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "set"); err != nil {
+		return false, err
+	}
+	_, ok := k.sets[key][member]
+	return ok, nil
+}
+
+// SMIsMember: report for each of members whether it belongs to the set
+// stored at key
+func (k *Kv) SMIsMember(key string, members []string) ([]bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "set"); err != nil {
+		return nil, err
+	}
+	set := k.sets[key]
+	res := make([]bool, len(members))
+	for i, m := range members {
+		_, res[i] = set[m]
+	}
+	return res, nil
+}
+
+// SUnion: get the members of the union of the sets stored at keys
+func (k *Kv) SUnion(keys []string) ([]string, error) {
+	return k.setAlgebra(keys, (*Kv).unionLocked)
+}
+
+// SInter: get the members of the intersection of the sets stored at keys
+func (k *Kv) SInter(keys []string) ([]string, error) {
+	return k.setAlgebra(keys, (*Kv).interLocked)
+}
+
+// SDiff: get the members of the first set that are in none of the others
+func (k *Kv) SDiff(keys []string) ([]string, error) {
+	return k.setAlgebra(keys, (*Kv).diffLocked)
+}
+
+// setAlgebra type checks keys and applies op to them under a single lock,
+// returning the sorted result
+func (k *Kv) setAlgebra(keys []string, op func(*Kv, []string) map[string]struct{}) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range keys {
+		if err := k.checkType(key, "set"); err != nil {
+			return nil, err
+		}
+	}
+	return sortedMembers(op(k, keys)), nil
+}
+
+// SUnionStore: store the union of the sets at keys in dst, overwriting it,
+// and return its cardinality
+func (k *Kv) SUnionStore(dst string, keys []string) (int, error) {
+	return k.setAlgebraStore(dst, keys, (*Kv).unionLocked)
+}
+
+// SInterStore: store the intersection of the sets at keys in dst
+func (k *Kv) SInterStore(dst string, keys []string) (int, error) {
+	return k.setAlgebraStore(dst, keys, (*Kv).interLocked)
+}
+
+// SDiffStore: store the difference of the sets at keys in dst
+func (k *Kv) SDiffStore(dst string, keys []string) (int, error) {
+	return k.setAlgebraStore(dst, keys, (*Kv).diffLocked)
+}
+
+// setAlgebraStore applies op to keys and replaces dst with the result under
+// a single lock. An empty result deletes dst.
+func (k *Kv) setAlgebraStore(dst string, keys []string, op func(*Kv, []string) map[string]struct{}) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range keys {
+		if err := k.checkType(key, "set"); err != nil {
+			return 0, err
+		}
+	}
+	res := op(k, keys)
+	k.deleteLocked(dst)
+	if len(res) > 0 {
+		k.sets[dst] = res
+	}
+	return len(res), nil
+}
+
+// unionLocked computes the union of the sets at keys, missing keys being
+// empty sets. Callers must hold k.mu.
+func (k *Kv) unionLocked(keys []string) map[string]struct{} {
+	res := make(map[string]struct{})
+	for _, key := range keys {
+		for m := range k.sets[key] {
+			res[m] = struct{}{}
+		}
+	}
+	return res
+}
+
+// interLocked computes the intersection of the sets at keys.
+// Callers must hold k.mu.
+func (k *Kv) interLocked(keys []string) map[string]struct{} {
+	res := make(map[string]struct{})
+	if len(keys) == 0 {
+		return res
+	}
+	for m := range k.sets[keys[0]] {
+		inAll := true
+		for _, key := range keys[1:] {
+			if _, ok := k.sets[key][m]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			res[m] = struct{}{}
+		}
+	}
+	return res
+}
+
+// diffLocked computes the members of the first set at keys that are in none
+// of the following ones. Callers must hold k.mu.
+func (k *Kv) diffLocked(keys []string) map[string]struct{} {
+	res := make(map[string]struct{})
+	if len(keys) == 0 {
+		return res
+	}
+	for m := range k.sets[keys[0]] {
+		res[m] = struct{}{}
+	}
+	for _, key := range keys[1:] {
+		for m := range k.sets[key] {
+			delete(res, m)
+		}
+	}
+	return res
+}
+
+// SPop: remove and return up to count random members of the set stored at
+// key, deleting the key once the set is empty
+func (k *Kv) SPop(key string, count int) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "set"); err != nil {
+		return nil, err
+	}
+	set := k.sets[key]
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	if count >= len(members) {
+		k.deleteLocked(key)
+		return members, nil
+	}
+	// partial Fisher-Yates shuffle: the first count slots become the sample
+	for i := 0; i < count; i++ {
+		j := i + rand.Intn(len(members)-i)
+		members[i], members[j] = members[j], members[i]
+		delete(set, members[i])
+	}
+	return members[:count], nil
+}
+
+// maxRandMembers is the largest reply of SRANDMEMBER with a negative count,
+// whose members may repeat so the size of the set does not bound it
+const maxRandMembers = 1 << 24
+
+// SRandMember: return random members of the set stored at key without
+// removing them. A positive count returns up to count distinct members, a
+// negative count returns exactly -count members that may repeat.
+func (k *Kv) SRandMember(key string, count int) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "set"); err != nil {
+		return nil, err
+	}
+	set := k.sets[key]
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	if len(members) == 0 || count == 0 {
+		return []string{}, nil
+	}
+	if count < 0 {
+		// sampling with replacement, growing the reply rather than sizing it
+		// up front from the client's count
+		var out []string
+		for i := count; i < 0; i++ {
+			out = append(out, members[rand.Intn(len(members))])
+		}
+		return out, nil
+	}
+	if count > len(members) {
+		count = len(members)
+	}
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	return members[:count], nil
+}
+
+// SMove: atomically move member from the set at src to the set at dst,
+// creating dst if needed. Reports whether member was in src.
+func (k *Kv) SMove(src, dst, member string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(src, "set"); err != nil {
+		return false, err
+	}
+	if err := k.checkType(dst, "set"); err != nil {
+		return false, err
+	}
+	from := k.sets[src]
+	if _, ok := from[member]; !ok {
+		return false, nil
+	}
+	delete(from, member)
+	if len(from) == 0 {
+		k.deleteLocked(src)
+	}
+	to, ok := k.sets[dst]
+	if !ok {
+		to = make(map[string]struct{})
+		k.sets[dst] = to
+	}
+	to[member] = struct{}{}
+	return true, nil
+}
+
+// SInterCard: count the members of the intersection of the sets at keys,
+// stopping once limit is reached (0 = no limit)
+func (k *Kv) SInterCard(keys []string, limit int) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	smallest := ""
+	for i, key := range keys {
+		if err := k.checkType(key, "set"); err != nil {
+			return 0, err
+		}
+		if i == 0 || len(k.sets[key]) < len(k.sets[smallest]) {
+			smallest = key
+		}
+	}
+	count := 0
+	for m := range k.sets[smallest] {
+		inAll := true
+		for _, key := range keys {
+			if _, ok := k.sets[key][m]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if !inAll {
+			continue
+		}
+		count++
+		if limit > 0 && count >= limit {
+			break
+		}
+	}
+	return count, nil
+}
+
+// sortedMembers returns the members of set in sorted order
+func sortedMembers(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Handlers for set commands
+
+func sadd(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("SADD requires at least two arguments")
+	}
+	n, err := kv.SAdd(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func srem(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("SREM requires at least two arguments")
+	}
+	n, err := kv.SRem(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func smembers(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("SMEMBERS requires exactly one argument")
+	}
+	members, err := kv.SMembers(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(members), nil
+}
+
+func scard(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("SCARD requires exactly one argument")
+	}
+	n, err := kv.SCard(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func sismember(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("SISMEMBER requires exactly two arguments")
+	}
+	ok, err := kv.SIsMember(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func smismember(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("SMISMEMBER requires at least two arguments")
+	}
+	res, err := kv.SMIsMember(args[0], args[1:])
+	if err != nil {
+		return nil, err
+	}
+	respArray := make(Array, len(res))
+	for i, ok := range res {
+		respArray[i] = boolInt(ok)
+	}
+	return respArray, nil
+}
+
+func sunion(args []string, kv *Kv) (RespValue, error) {
+	return setAlgebraCmd(args, kv.SUnion)
+}
+
+func sinter(args []string, kv *Kv) (RespValue, error) {
+	return setAlgebraCmd(args, kv.SInter)
+}
+
+func sdiff(args []string, kv *Kv) (RespValue, error) {
+	return setAlgebraCmd(args, kv.SDiff)
+}
+
+// setAlgebraCmd runs one of SUNION, SINTER or SDIFF
+func setAlgebraCmd(args []string, op func([]string) ([]string, error)) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	members, err := op(args)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(members), nil
+}
+
+func sunionstore(args []string, kv *Kv) (RespValue, error) {
+	return setAlgebraStoreCmd(args, kv.SUnionStore)
+}
+
+func sinterstore(args []string, kv *Kv) (RespValue, error) {
+	return setAlgebraStoreCmd(args, kv.SInterStore)
+}
+
+func sdiffstore(args []string, kv *Kv) (RespValue, error) {
+	return setAlgebraStoreCmd(args, kv.SDiffStore)
+}
+
+// setAlgebraStoreCmd runs one of SUNIONSTORE, SINTERSTORE or SDIFFSTORE
+func setAlgebraStoreCmd(args []string, op func(string, []string) (int, error)) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	n, err := op(args[0], args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func spop(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, errors.New("SPOP requires one or two arguments")
+	}
+	if len(args) == 1 {
+		members, err := kv.SPop(args[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(members) == 0 {
+			return nil, nil
+		}
+		return BulkString(members[0]), nil
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count < 0 {
+		return nil, errors.New("value is out of range, must be positive")
+	}
+	members, err := kv.SPop(args[0], count)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(members), nil
+}
+
+func srandmember(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, errors.New("SRANDMEMBER requires one or two arguments")
+	}
+	if len(args) == 1 {
+		members, err := kv.SRandMember(args[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(members) == 0 {
+			return nil, nil
+		}
+		return BulkString(members[0]), nil
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	if count < -maxRandMembers {
+		return nil, errors.New("value is out of range")
+	}
+	members, err := kv.SRandMember(args[0], count)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(members), nil
+}
+
+func smove(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("SMOVE requires exactly three arguments")
+	}
+	ok, err := kv.SMove(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+// parseNumKeys parses the "numkeys key [key ...]" prefix used by multi-key
+// commands and returns the keys along with the remaining arguments
+func parseNumKeys(args []string) ([]string, []string, error) {
+	if len(args) < 1 {
+		return nil, nil, errors.New("wrong number of arguments")
+	}
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys <= 0 {
+		return nil, nil, errors.New("numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, errors.New("Number of keys can't be greater than number of args")
+	}
+	return args[1 : numKeys+1], args[numKeys+1:], nil
+}
+
+// parseLimit parses an optional trailing "LIMIT limit" option
+func parseLimit(rest []string) (int, error) {
+	if len(rest) == 0 {
+		return 0, nil
+	}
+	if len(rest) != 2 || !strings.EqualFold(rest[0], "LIMIT") {
+		return 0, errors.New("syntax error")
+	}
+	limit, err := strconv.Atoi(rest[1])
+	if err != nil || limit < 0 {
+		return 0, errors.New("LIMIT can't be negative")
+	}
+	return limit, nil
+}
+
+func sintercard(args []string, kv *Kv) (RespValue, error) {
+	keys, rest, err := parseNumKeys(args)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := parseLimit(rest)
+	if err != nil {
+		return nil, err
+	}
+	n, err := kv.SInterCard(keys, limit)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// equalStrings reports whether a and b hold the same elements in order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSAddSRem(t *testing.T) {
+	kv := NewKv()
+	if n, err := kv.SAdd("s", "b", "a", "b", "c"); err != nil || n != 3 {
+		t.Fatalf("SAdd = %d, %v; want 3", n, err)
+	}
+	if n, _ := kv.SAdd("s", "a", "d"); n != 1 {
+		t.Fatalf("expected 1 new member, got %d", n)
+	}
+	if got, _ := kv.SMembers("s"); !equalStrings(got, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("SMembers = %v", got)
+	}
+	if n, _ := kv.SCard("s"); n != 4 {
+		t.Fatalf("expected SCard 4, got %d", n)
+	}
+	if n, _ := kv.SRem("s", "a", "zz"); n != 1 {
+		t.Fatalf("expected 1 removed member, got %d", n)
+	}
+	kv.SRem("s", "b", "c", "d")
+	if _, ok := kv.sets["s"]; ok {
+		t.Fatalf("expected empty set to be deleted")
+	}
+	if n, _ := kv.SCard("s"); n != 0 {
+		t.Fatalf("expected SCard 0 for missing key, got %d", n)
+	}
+}
+
+func TestSetWrongType(t *testing.T) {
+	kv := NewKv()
+	kv.Set("str", "v")
+	if _, err := kv.SAdd("str", "a"); !errors.Is(err, errWrongType) {
+		t.Fatalf("expected WRONGTYPE, got %v", err)
+	}
+}
+
+func TestSIsMember(t *testing.T) {
+	kv := NewKv()
+	kv.SAdd("s", "a", "b")
+	if ok, _ := kv.SIsMember("s", "a"); !ok {
+		t.Fatalf("expected a to be a member")
+	}
+	if ok, _ := kv.SIsMember("missing", "a"); ok {
+		t.Fatalf("expected member of missing key to be absent")
+	}
+	got, err := kv.SMIsMember("s", []string{"a", "x", "b", "y"})
+	if err != nil {
+		t.Fatalf("SMIsMember error: %v", err)
+	}
+	want := []bool{true, false, true, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("SMIsMember = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	kv := NewKv()
+	kv.SAdd("a", "1", "2", "3", "4")
+	kv.SAdd("b", "3", "4", "5")
+	kv.SAdd("c", "4", "6")
+	if got, _ := kv.SUnion([]string{"a", "b", "missing"}); !equalStrings(got, []string{"1", "2", "3", "4", "5"}) {
+		t.Fatalf("SUnion = %v", got)
+	}
+	if got, _ := kv.SInter([]string{"a", "b", "c"}); !equalStrings(got, []string{"4"}) {
+		t.Fatalf("SInter = %v", got)
+	}
+	if got, _ := kv.SInter([]string{"a", "missing"}); len(got) != 0 {
+		t.Fatalf("SInter with missing key = %v, want empty", got)
+	}
+	if got, _ := kv.SDiff([]string{"a", "b", "c"}); !equalStrings(got, []string{"1", "2"}) {
+		t.Fatalf("SDiff = %v", got)
+	}
+	if got, _ := kv.SDiff([]string{"missing", "a"}); len(got) != 0 {
+		t.Fatalf("SDiff of missing key = %v, want empty", got)
+	}
+}
+
+func TestSetAlgebraStore(t *testing.T) {
+	kv := NewKv()
+	kv.SAdd("a", "1", "2", "3")
+	kv.SAdd("b", "2", "3", "4")
+	kv.RPush("dst", "old")
+	if n, err := kv.SUnionStore("dst", []string{"a", "b"}); err != nil || n != 4 {
+		t.Fatalf("SUnionStore = %d, %v; want 4", n, err)
+	}
+	if got, _ := kv.SMembers("dst"); !equalStrings(got, []string{"1", "2", "3", "4"}) {
+		t.Fatalf("stored union = %v", got)
+	}
+	if _, ok := kv.lists["dst"]; ok {
+		t.Fatalf("expected previous destination value to be overwritten")
+	}
+	if n, _ := kv.SInterStore("dst", []string{"a", "b"}); n != 2 {
+		t.Fatalf("SInterStore = %d, want 2", n)
+	}
+	if n, _ := kv.SDiffStore("dst", []string{"a", "b"}); n != 1 {
+		t.Fatalf("SDiffStore = %d, want 1", n)
+	}
+	if got, _ := kv.SMembers("dst"); !equalStrings(got, []string{"1"}) {
+		t.Fatalf("stored diff = %v", got)
+	}
+	// an empty result deletes the destination, even when it is also a source
+	if n, _ := kv.SInterStore("a", []string{"a", "missing"}); n != 0 {
+		t.Fatalf("SInterStore with missing key = %d, want 0", n)
+	}
+	if _, ok := kv.sets["a"]; ok {
+		t.Fatalf("expected empty result to delete the destination")
+	}
+}
+
+func TestSPop(t *testing.T) {
+	kv := NewKv()
+	kv.SAdd("s", "a", "b", "c", "d", "e")
+	popped, err := kv.SPop("s", 2)
+	if err != nil || len(popped) != 2 {
+		t.Fatalf("SPop = %v, %v; want 2 members", popped, err)
+	}
+	if n, _ := kv.SCard("s"); n != 3 {
+		t.Fatalf("expected 3 members left, got %d", n)
+	}
+	for _, m := range popped {
+		if ok, _ := kv.SIsMember("s", m); ok {
+			t.Fatalf("popped member %q still in set", m)
+		}
+	}
+	rest, _ := kv.SPop("s", 10)
+	if len(rest) != 3 {
+		t.Fatalf("expected remaining 3 members, got %v", rest)
+	}
+	if _, ok := kv.sets["s"]; ok {
+		t.Fatalf("expected emptied set to be deleted")
+	}
+	if got, _ := kv.SPop("s", 1); len(got) != 0 {
+		t.Fatalf("expected nothing popped from missing key, got %v", got)
+	}
+}
+
+func TestSRandMember(t *testing.T) {
+	kv := NewKv()
+	kv.SAdd("s", "a", "b", "c")
+
+	got, _ := kv.SRandMember("s", 5)
+	if len(got) != 3 {
+		t.Fatalf("positive count larger than the set should return all members, got %v", got)
+	}
+	seen := make(map[string]bool)
+	for _, m := range got {
+		if seen[m] {
+			t.Fatalf("positive count returned duplicate member %q", m)
+		}
+		seen[m] = true
+	}
+
+	got, _ = kv.SRandMember("s", -10)
+	if len(got) != 10 {
+		t.Fatalf("negative count should return exactly 10 members, got %d", len(got))
+	}
+	for _, m := range got {
+		if ok, _ := kv.SIsMember("s", m); !ok {
+			t.Fatalf("returned non-member %q", m)
+		}
+	}
+	if n, _ := kv.SCard("s"); n != 3 {
+		t.Fatalf("SRandMember should not remove members, got SCard %d", n)
+	}
+	for _, count := range []string{"-9223372036854775808", "-9223372036854775807", "-16777217"} {
+		if _, err := srandmember([]string{"s", count}, kv); err == nil || err.Error() != "value is out of range" {
+			t.Fatalf("SRANDMEMBER with count %s = %v, want out of range", count, err)
+		}
+	}
+}
+
+func TestSMove(t *testing.T) {
+	kv := NewKv()
+	kv.SAdd("pending", "job1", "job2")
+	if ok, err := kv.SMove("pending", "processing", "job1"); err != nil || !ok {
+		t.Fatalf("SMove = %v, %v; want true", ok, err)
+	}
+	if got, _ := kv.SMembers("pending"); !equalStrings(got, []string{"job2"}) {
+		t.Fatalf("pending = %v", got)
+	}
+	if got, _ := kv.SMembers("processing"); !equalStrings(got, []string{"job1"}) {
+		t.Fatalf("processing = %v", got)
+	}
+	if ok, _ := kv.SMove("pending", "processing", "job1"); ok {
+		t.Fatalf("expected moving a non-member to fail")
+	}
+	if ok, _ := kv.SMove("missing", "processing", "job2"); ok {
+		t.Fatalf("expected moving from a missing key to fail")
+	}
+}
+
+func TestSInterCard(t *testing.T) {
+	kv := NewKv()
+	kv.SAdd("a", "1", "2", "3", "4", "5")
+	kv.SAdd("b", "2", "3", "4", "5", "6")
+	if n, err := kv.SInterCard([]string{"a", "b"}, 0); err != nil || n != 4 {
+		t.Fatalf("SInterCard = %d, %v; want 4", n, err)
+	}
+	if n, _ := kv.SInterCard([]string{"a", "b"}, 2); n != 2 {
+		t.Fatalf("SInterCard with LIMIT 2 = %d, want 2", n)
+	}
+	if n, _ := kv.SInterCard([]string{"a", "missing"}, 0); n != 0 {
+		t.Fatalf("SInterCard with missing key = %d, want 0", n)
+	}
+	resp, err := sintercard([]string{"2", "a", "b", "LIMIT", "3"}, kv)
+	if err != nil || resp != integer(3) {
+		t.Fatalf("SINTERCARD reply = %v, %v; want 3", resp, err)
+	}
+	if _, err := sintercard([]string{"9223372036854775807", "a"}, kv); err == nil {
+		t.Fatalf("expected error for numkeys overflowing the argument count")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// slowlogMaxArgs and slowlogMaxArgLen bound the arguments logged for a
+	// command, so huge commands do not bloat the slow log
+	slowlogMaxArgs   = 32
+	slowlogMaxArgLen = 128
+	// slowlogDefaultCount is the number of entries SLOWLOG GET returns
+	// without a count
+	slowlogDefaultCount = 128
+)
+
+// SlowLogEntry is a command that ran slower than slowlog-log-slower-than
+type SlowLogEntry struct {
+	ID       int64
+	Time     time.Time
+	Duration time.Duration
+	Args     []string
+	Addr     string
+	Name     string
+}
+
+// slowLog is a ring buffer of the most recent slow commands
+type slowLog struct {
+	mu sync.Mutex
+	// entries grows up to maxLen, the slowlog-max-len at the time of the
+	// last add, and then wraps: the newest entry is at entries[head-1]
+	entries []SlowLogEntry
+	head    int
+	maxLen  int
+	nextID  int64
+}
+
+// add appends e to the log, dropping the oldest entries beyond maxLen
+func (l *slowLog) add(e SlowLogEntry, maxLen int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.ID = l.nextID
+	l.nextID++
+	if l.maxLen != maxLen {
+		l.resize(maxLen)
+	}
+	if maxLen == 0 {
+		return
+	}
+	// the buffer is only allocated as entries come in, so a large
+	// slowlog-max-len costs nothing until the log fills up
+	if len(l.entries) < maxLen {
+		l.entries = append(l.entries, e)
+		return
+	}
+	l.entries[l.head] = e
+	l.head = (l.head + 1) % maxLen
+}
+
+// resize sets the capacity of the ring buffer to size entries, keeping the
+// newest ones. Callers must hold l.mu.
+func (l *slowLog) resize(size int) {
+	kept := l.newest(size)
+	l.entries = make([]SlowLogEntry, len(kept))
+	// copy oldest first, so the newest entry ends up last
+	for i := range kept {
+		l.entries[i] = kept[len(kept)-1-i]
+	}
+	l.head = 0
+	l.maxLen = size
+}
+
+// newest returns up to count entries, newest first. Callers must hold l.mu.
+func (l *slowLog) newest(count int) []SlowLogEntry {
+	n := len(l.entries)
+	count = min(count, n)
+	out := make([]SlowLogEntry, count)
+	for i := range out {
+		out[i] = l.entries[(l.head-1-i+2*n)%n]
+	}
+	return out
+}
+
+// get returns up to count entries, newest first, or every entry when count
+// is negative
+func (l *slowLog) get(count int) []SlowLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if count < 0 {
+		count = len(l.entries)
+	}
+	return l.newest(count)
+}
+
+// len returns the number of entries in the log
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// reset empties the log. Entry ids keep increasing.
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries, l.head = nil, 0
+}
+
+// slowlogArgs returns the args logged for a command, truncated to the
+// slow log limits the way Redis does
+func slowlogArgs(args []string) []string {
+	n := min(len(args), slowlogMaxArgs)
+	out := make([]string, n)
+	for i := range out {
+		if i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs {
+			out[i] = fmt.Sprintf("... (%d more arguments)", len(args)-slowlogMaxArgs+1)
+			break
+		}
+		out[i] = args[i]
+		if len(out[i]) > slowlogMaxArgLen {
+			out[i] = fmt.Sprintf("%s... (%d more bytes)", out[i][:slowlogMaxArgLen], len(out[i])-slowlogMaxArgLen)
+		}
+	}
+	return out
+}
+
+// logSlow adds the command args run by c in d to the slow log, if it ran
+// slower than the configured threshold
+func (s *Server) logSlow(c *client, args []string, d time.Duration) {
+	threshold, maxLen := s.cfg.slowlogSettings()
+	if threshold < 0 || d < threshold {
+		return
+	}
+	s.slowlog.add(SlowLogEntry{
+		Time:     time.Now(),
+		Duration: d,
+		Args:     slowlogArgs(redactArgs(args)),
+		Addr:     c.addr,
+		Name:     c.name,
+	}, maxLen)
+}
+
+var slowlogHelp = []string{
+	"SLOWLOG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"GET [<count>]",
+	"    Return top <count> entries from the slowlog (default: 128, -1 mean all).",
+	"    Entries are made of:",
+	"    id, timestamp, time in microseconds, arguments array, client IP and port,",
+	"    client name",
+	"LEN",
+	"    Return the length of the slowlog.",
+	"RESET",
+	"    Reset the slowlog.",
+	"HELP",
+	"    Print this help.",
+}
+
+// Handlers for slow log commands
+
+func slowlog(args []string, c *client) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("SLOWLOG requires a subcommand")
+	}
+	sub := strings.ToUpper(args[0])
+	if sub == "GET" && len(args) <= 2 {
+		return slowlogGet(args[1:], c)
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments for 'slowlog|%s' command", strings.ToLower(sub))
+	}
+	switch sub {
+	case "HELP":
+		return bulkArray(slowlogHelp), nil
+	case "LEN":
+		return integer(c.srv.slowlog.len()), nil
+	case "RESET":
+		c.srv.slowlog.reset()
+		return SimpleString("OK"), nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try SLOWLOG HELP.", args[0])
+	}
+}
+
+func slowlogGet(args []string, c *client) (RespValue, error) {
+	count := slowlogDefaultCount
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < -1 {
+			return nil, errors.New("count should be greater than or equal to -1")
+		}
+		count = n
+	}
+	entries := c.srv.slowlog.get(count)
+	reply := make(Array, len(entries))
+	for i, e := range entries {
+		reply[i] = Array{
+			integer(e.ID),
+			integer(e.Time.Unix()),
+			integer(e.Duration.Microseconds()),
+			bulkArray(e.Args),
+			BulkString(e.Addr),
+			BulkString(e.Name),
+		}
+	}
+	return reply, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowlogIDs returns the ids of the SLOWLOG GET reply entries
+func slowlogIDs(resp RespValue) []int64 {
+	var ids []int64
+	for _, e := range resp.(Array) {
+		ids = append(ids, int64(e.(Array)[0].(integer)))
+	}
+	return ids
+}
+
+func equalIDs(got, want []int64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSlowLogRing(t *testing.T) {
+	var l slowLog
+	for i := 0; i < 5; i++ {
+		l.add(SlowLogEntry{}, 3)
+	}
+	got := l.get(-1)
+	if len(got) != 3 || got[0].ID != 4 || got[2].ID != 2 {
+		t.Fatalf("entries = %v, want ids 4 3 2", got)
+	}
+	if got := l.get(2); len(got) != 2 || got[0].ID != 4 || got[1].ID != 3 {
+		t.Fatalf("get(2) = %v, want ids 4 3", got)
+	}
+
+	// growing the log keeps the entries, shrinking it drops the oldest
+	l.add(SlowLogEntry{}, 5)
+	if got := l.get(-1); len(got) != 4 || got[0].ID != 5 || got[3].ID != 2 {
+		t.Fatalf("after growing: %v, want ids 5 4 3 2", got)
+	}
+	l.add(SlowLogEntry{}, 2)
+	if got := l.get(-1); len(got) != 2 || got[0].ID != 6 || got[1].ID != 5 {
+		t.Fatalf("after shrinking: %v, want ids 6 5", got)
+	}
+	l.add(SlowLogEntry{}, 0)
+	if n := l.len(); n != 0 {
+		t.Fatalf("len = %d with max-len 0, want 0", n)
+	}
+
+	// the buffer grows with the entries rather than with max-len
+	l.add(SlowLogEntry{}, math.MaxInt32)
+	if n := cap(l.entries); n > 16 {
+		t.Fatalf("cap = %d after one entry with the largest max-len", n)
+	}
+}
+
+func TestSlowLogArgs(t *testing.T) {
+	long := strings.Repeat("x", 130)
+	got := slowlogArgs([]string{"SET", "k", long})
+	if got[2] != strings.Repeat("x", 128)+"... (2 more bytes)" {
+		t.Fatalf("long argument logged as %q", got[2])
+	}
+	args := make([]string, 40)
+	for i := range args {
+		args[i] = strconv.Itoa(i)
+	}
+	got = slowlogArgs(args)
+	if len(got) != 32 || got[30] != "30" || got[31] != "... (9 more arguments)" {
+		t.Fatalf("40 arguments logged as %v", got)
+	}
+}
+
+func TestSlowLogCommands(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	c := newClient(srv)
+	c.addr, c.name = "127.0.0.1:5000", "worker"
+
+	// every command is slow with a zero threshold
+	srv.cfg.Set([]string{"slowlog-log-slower-than", "0"})
+	srv.logSlow(c, []string{"SET", "k", "v"}, time.Millisecond)
+	srv.logSlow(c, []string{"GET", "k"}, 2*time.Millisecond)
+	resp, err := slowlog([]string{"GET"}, c)
+	if err != nil {
+		t.Fatalf("SLOWLOG GET: %v", err)
+	}
+	if ids := slowlogIDs(resp); !equalIDs(ids, []int64{1, 0}) {
+		t.Fatalf("SLOWLOG GET ids = %v, want [1 0]", ids)
+	}
+	entry := resp.(Array)[0].(Array)
+	if entry[2] != integer(2000) || entry[4] != BulkString("127.0.0.1:5000") || entry[5] != BulkString("worker") {
+		t.Fatalf("SLOWLOG entry = %v", entry)
+	}
+	if args := entry[3].(Array); len(args) != 2 || args[0] != BulkString("GET") {
+		t.Fatalf("SLOWLOG entry args = %v, want [GET k]", args)
+	}
+	if ids := slowlogIDs(mustSlowlog(t, c, "GET", "1")); !equalIDs(ids, []int64{1}) {
+		t.Fatalf("SLOWLOG GET 1 ids = %v, want [1]", ids)
+	}
+	if n := mustSlowlog(t, c, "LEN"); n != integer(2) {
+		t.Fatalf("SLOWLOG LEN = %v, want 2", n)
+	}
+	// passwords are not exposed to the clients reading the log
+	srv.logSlow(c, []string{"AUTH", "secret"}, time.Millisecond)
+	if args := mustSlowlog(t, c, "GET", "1").(Array)[0].(Array)[3].(Array); args[1] != BulkString("(redacted)") {
+		t.Fatalf("SLOWLOG entry of AUTH = %v, want the password redacted", args)
+	}
+
+	// commands faster than the threshold, or any with a negative one, are
+	// not logged
+	srv.cfg.Set([]string{"slowlog-log-slower-than", "10000"})
+	srv.logSlow(c, []string{"PING"}, time.Millisecond)
+	srv.cfg.Set([]string{"slowlog-log-slower-than", "-1"})
+	srv.logSlow(c, []string{"PING"}, time.Minute)
+	if n := mustSlowlog(t, c, "LEN"); n != integer(3) {
+		t.Fatalf("SLOWLOG LEN = %v, want 3", n)
+	}
+
+	if resp := mustSlowlog(t, c, "RESET"); resp != SimpleString("OK") {
+		t.Fatalf("SLOWLOG RESET = %v, want OK", resp)
+	}
+	if n := mustSlowlog(t, c, "LEN"); n != integer(0) {
+		t.Fatalf("SLOWLOG LEN after RESET = %v, want 0", n)
+	}
+	for _, args := range [][]string{{"GET", "-2"}, {"GET", "x"}, {"LEN", "1"}, {"NOSUCH"}} {
+		if _, err := slowlog(args, c); err == nil {
+			t.Fatalf("SLOWLOG %v succeeded", args)
+		}
+	}
+}
+
+func mustSlowlog(t *testing.T, c *client, args ...string) RespValue {
+	t.Helper()
+	resp, err := slowlog(args, c)
+	if err != nil {
+		t.Fatalf("SLOWLOG %v: %v", args, err)
+	}
+	return resp
+}
+
+func TestSlowLogHandleClient(t *testing.T) {
+	srv := NewServer(newConfig(""))
+	srv.cfg.Set([]string{"slowlog-log-slower-than", "0"})
+	server, conn := net.Pipe()
+	defer conn.Close()
+	go handleClient(server, srv)
+	conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+	bufio.NewReader(conn).ReadString('\n')
+
+	entries := srv.slowlog.get(-1)
+	if len(entries) != 1 || !equalStrings(entries[0].Args, []string{"PING"}) || entries[0].Addr != "pipe" {
+		t.Fatalf("slow log = %v, want the PING", entries)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortOpts holds the options of SORT
+type SortOpts struct {
+	// By is a pattern whose lookups are used as weights instead of the
+	// elements themselves. A pattern without '*' skips sorting.
+	By string
+	// Offset and Count limit the result, a Count of -1 meaning all elements
+	Offset, Count int
+	// Get lists the patterns looked up for each element, "#" standing for
+	// the element itself. The elements are returned when empty.
+	Get   []string
+	Desc  bool
+	Alpha bool
+	// Store saves the result as a list at this key when not empty
+	Store string
+}
+
+// sortItem is an element being sorted along with its weight
+type sortItem struct {
+	elem   string
+	weight string
+	score  float64
+	// missing is set when the BY lookup found nothing, which weighs 0 in
+	// numeric mode
+	missing bool
+}
+
+// Sort: sort the elements of the list, set or sorted set at key according to
+// opts. Each element of the result is a string, or nil when a GET lookup
+// found nothing. With opts.Store the result is saved to that key as well.
+func (k *Kv) Sort(key string, opts SortOpts) ([]interface{}, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var elems []string
+	switch k.typeOf(key) {
+	case "list":
+		elems = append(elems, k.lists[key]...)
+	case "set":
+		elems = sortedMembers(k.sets[key])
+	case "zset":
+		for _, e := range k.zsets[key].index {
+			elems = append(elems, e.member)
+		}
+	case "none":
+	default:
+		return nil, errWrongType
+	}
+
+	noSort := opts.By != "" && !strings.Contains(opts.By, "*")
+	items := make([]sortItem, len(elems))
+	for i, elem := range elems {
+		items[i] = sortItem{elem: elem, weight: elem}
+		if noSort {
+			continue
+		}
+		if opts.By != "" {
+			w, ok := k.lookupLocked(opts.By, elem)
+			items[i].weight, items[i].missing = w, !ok
+		}
+		if !opts.Alpha && !items[i].missing {
+			score, err := strconv.ParseFloat(items[i].weight, 64)
+			if err != nil {
+				return nil, errors.New("One or more scores can't be converted into double")
+			}
+			items[i].score = score
+		}
+	}
+	if !noSort {
+		sort.SliceStable(items, func(i, j int) bool {
+			c := compareSortItems(items[i], items[j], opts.Alpha)
+			if opts.Desc {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	lo, hi := 0, len(items)
+	if opts.Offset > 0 {
+		lo = min(opts.Offset, len(items))
+	}
+	if opts.Count >= 0 && opts.Count < len(items)-lo {
+		hi = lo + opts.Count
+	}
+	var out []interface{}
+	for _, it := range items[lo:hi] {
+		if len(opts.Get) == 0 {
+			out = append(out, it.elem)
+			continue
+		}
+		for _, pattern := range opts.Get {
+			if v, ok := k.lookupLocked(pattern, it.elem); ok {
+				out = append(out, v)
+			} else {
+				out = append(out, nil)
+			}
+		}
+	}
+
+	if opts.Store != "" {
+		k.deleteLocked(opts.Store)
+		if len(out) > 0 {
+			list := make([]string, len(out))
+			for i, v := range out {
+				if v != nil {
+					list[i] = v.(string)
+				}
+			}
+			k.lists[opts.Store] = list
+			k.wake(opts.Store)
+		}
+	}
+	return out, nil
+}
+
+// compareSortItems orders items by weight (numerically unless alpha), ties
+// being broken by the elements. With alpha, items whose BY lookup found
+// nothing come first.
+func compareSortItems(a, b sortItem, alpha bool) int {
+	c := 0
+	switch {
+	case alpha && (a.missing || b.missing):
+		if a.missing != b.missing {
+			if a.missing {
+				c = -1
+			} else {
+				c = 1
+			}
+		}
+	case alpha:
+		c = strings.Compare(a.weight, b.weight)
+	case a.score < b.score:
+		c = -1
+	case a.score > b.score:
+		c = 1
+	}
+	if c == 0 {
+		c = strings.Compare(a.elem, b.elem)
+	}
+	return c
+}
+
+// lookupLocked resolves a SORT BY or GET pattern for elem: the first '*' is
+// replaced by elem to get a key holding a string, or with "key->field" a
+// field of the hash at key. "#" resolves to elem itself. Callers must hold
+// k.mu.
+func (k *Kv) lookupLocked(pattern, elem string) (string, bool) {
+	if pattern == "#" {
+		return elem, true
+	}
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return "", false
+	}
+	key, field := pattern, ""
+	if arrow := strings.Index(pattern[star+1:], "->"); arrow >= 0 && star+1+arrow+2 < len(pattern) {
+		key, field = pattern[:star+1+arrow], pattern[star+1+arrow+2:]
+	}
+	key = key[:star] + elem + key[star+1:]
+	switch k.typeOf(key) {
+	case "string":
+		if field != "" {
+			return "", false
+		}
+		return k.data[key], true
+	case "hash":
+		if field == "" {
+			return "", false
+		}
+		v, ok := k.hashes[key][field]
+		return v, ok
+	}
+	return "", false
+}
+
+// parseSortArgs parses "[BY pattern] [LIMIT offset count] [GET pattern ...]
+// [ASC|DESC] [ALPHA] [STORE destination]"
+func parseSortArgs(args []string) (SortOpts, error) {
+	opts := SortOpts{Count: -1}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "ASC":
+			opts.Desc = false
+		case "DESC":
+			opts.Desc = true
+		case "ALPHA":
+			opts.Alpha = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return opts, errors.New("syntax error")
+			}
+			offset, err1 := strconv.Atoi(args[i+1])
+			count, err2 := strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return opts, errors.New("value is not an integer or out of range")
+			}
+			opts.Offset, opts.Count = offset, count
+			i += 2
+		case "BY", "GET", "STORE":
+			if i+1 >= len(args) {
+				return opts, errors.New("syntax error")
+			}
+			switch strings.ToUpper(args[i]) {
+			case "BY":
+				opts.By = args[i+1]
+			case "GET":
+				opts.Get = append(opts.Get, args[i+1])
+			case "STORE":
+				opts.Store = args[i+1]
+			}
+			i++
+		default:
+			return opts, errors.New("syntax error")
+		}
+	}
+	return opts, nil
+}
+
+// Handlers for sort commands
+
+func sortCmd(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("SORT requires at least one argument")
+	}
+	opts, err := parseSortArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return sortReply(args[0], opts, kv)
+}
+
+func sortRO(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("SORT_RO requires at least one argument")
+	}
+	opts, err := parseSortArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if opts.Store != "" {
+		return nil, errors.New("syntax error")
+	}
+	return sortReply(args[0], opts, kv)
+}
+
+func sortReply(key string, opts SortOpts, kv *Kv) (RespValue, error) {
+	vals, err := kv.Sort(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Store != "" {
+		return integer(len(vals)), nil
+	}
+	respArray := make(Array, len(vals))
+	for i, v := range vals {
+		if v != nil {
+			respArray[i] = BulkString(v.(string))
+		}
+	}
+	return respArray, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// sortStrings runs Sort and converts the result to strings, nil becoming "<nil>"
+func sortStrings(t *testing.T, kv *Kv, key string, opts SortOpts) []string {
+	t.Helper()
+	vals, err := kv.Sort(key, opts)
+	if err != nil {
+		t.Fatalf("Sort error: %v", err)
+	}
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		if v == nil {
+			out[i] = "<nil>"
+		} else {
+			out[i] = v.(string)
+		}
+	}
+	return out
+}
+
+func TestSortNumeric(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("nums", "3", "10", "1", "2.5")
+	if got := sortStrings(t, kv, "nums", SortOpts{Count: -1}); !equalStrings(got, []string{"1", "2.5", "3", "10"}) {
+		t.Fatalf("SORT = %v", got)
+	}
+	if got := sortStrings(t, kv, "nums", SortOpts{Count: 2, Offset: 1, Desc: true}); !equalStrings(got, []string{"3", "2.5"}) {
+		t.Fatalf("SORT LIMIT 1 2 DESC = %v", got)
+	}
+	if got := sortStrings(t, kv, "nums", SortOpts{Count: math.MaxInt, Offset: 1}); !equalStrings(got, []string{"2.5", "3", "10"}) {
+		t.Fatalf("SORT LIMIT 1 MaxInt = %v", got)
+	}
+	kv.RPush("words", "b")
+	if _, err := kv.Sort("words", SortOpts{Count: -1}); err == nil {
+		t.Fatalf("expected error sorting non-numeric elements")
+	}
+}
+
+func TestSortAlpha(t *testing.T) {
+	kv := NewKv()
+	kv.SAdd("s", "banana", "apple", "cherry")
+	resp, err := sortCmd([]string{"s", "ALPHA", "DESC"}, kv)
+	if err != nil {
+		t.Fatalf("SORT error: %v", err)
+	}
+	arr := resp.(Array)
+	if len(arr) != 3 || arr[0] != BulkString("cherry") || arr[2] != BulkString("apple") {
+		t.Fatalf("SORT ALPHA DESC = %v", arr)
+	}
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1, "20"}, zsetEntry{2, "3"})
+	// sorted set members are sorted by value, not score
+	if got := sortStrings(t, kv, "z", SortOpts{Count: -1}); !equalStrings(got, []string{"3", "20"}) {
+		t.Fatalf("SORT zset = %v", got)
+	}
+}
+
+func TestSortByGet(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("ids", "1", "2", "3")
+	kv.Set("weight_1", "30")
+	kv.Set("weight_2", "10")
+	kv.Set("weight_3", "20")
+	kv.HSet("user:1", "name", "ada")
+	kv.HSet("user:2", "name", "bob")
+	opts := SortOpts{By: "weight_*", Get: []string{"#", "user:*->name"}, Count: -1}
+	want := []string{"2", "bob", "3", "<nil>", "1", "ada"}
+	if got := sortStrings(t, kv, "ids", opts); !equalStrings(got, want) {
+		t.Fatalf("SORT BY GET = %v, want %v", got, want)
+	}
+	// a missing weight counts as 0, and sorts first only with ALPHA
+	kv.RPush("ab", "a", "b")
+	kv.Set("w_a", "-5")
+	if got := sortStrings(t, kv, "ab", SortOpts{By: "w_*", Count: -1}); !equalStrings(got, []string{"a", "b"}) {
+		t.Fatalf("SORT BY with a missing weight = %v, want [a b]", got)
+	}
+	if got := sortStrings(t, kv, "ab", SortOpts{By: "w_*", Alpha: true, Count: -1}); !equalStrings(got, []string{"b", "a"}) {
+		t.Fatalf("SORT BY ALPHA with a missing weight = %v, want [b a]", got)
+	}
+	// BY without '*' keeps the original order
+	if got := sortStrings(t, kv, "ids", SortOpts{By: "nosort", Count: -1, Desc: true}); !equalStrings(got, []string{"1", "2", "3"}) {
+		t.Fatalf("SORT BY nosort = %v", got)
+	}
+	if got := sortStrings(t, kv, "ids", SortOpts{By: "user:*->name", Alpha: true, Count: -1}); !equalStrings(got, []string{"3", "1", "2"}) {
+		t.Fatalf("SORT BY hash field = %v", got)
+	}
+}
+
+func TestSortStore(t *testing.T) {
+	kv := NewKv()
+	kv.RPush("l", "3", "1", "2")
+	resp, err := sortCmd([]string{"l", "STORE", "dst"}, kv)
+	if err != nil || resp != integer(3) {
+		t.Fatalf("SORT STORE = %v, %v; want 3", resp, err)
+	}
+	if got, _ := kv.LRange("dst", 0, -1); !equalStrings(got, []string{"1", "2", "3"}) {
+		t.Fatalf("stored list = %v", got)
+	}
+	if _, err := sortRO([]string{"l", "STORE", "dst"}, kv); err == nil {
+		t.Fatalf("expected SORT_RO to reject STORE")
+	}
+	kv.Set("str", "v")
+	if _, err := sortRO([]string{"str"}, kv); !errors.Is(err, errWrongType) {
+		t.Fatalf("SORT_RO on string err = %v, want WRONGTYPE", err)
+	}
+}
@@ -0,0 +1,1077 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamID identifies a stream entry: the creation time in milliseconds,
+// then a sequence number telling apart entries created the same millisecond
+type StreamID struct {
+	ms, seq uint64
+}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+// Less reports whether id sorts before other
+func (id StreamID) Less(other StreamID) bool {
+	if id.ms != other.ms {
+		return id.ms < other.ms
+	}
+	return id.seq < other.seq
+}
+
+// maxStreamID is the greatest possible ID
+var maxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+// parseStreamID parses an ID given as ms-seq, or as ms alone in which case
+// the sequence number is missingSeq
+func parseStreamID(s string, missingSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, errInvalidStreamID
+	}
+	if !hasSeq {
+		return StreamID{ms, missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, errInvalidStreamID
+	}
+	return StreamID{ms, seq}, nil
+}
+
+var errInvalidStreamID = errors.New("Invalid stream ID specified as stream command argument")
+
+// StreamEntry is a stream entry: its ID and its field-value pairs, flattened
+// in the order they were added
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// Stream holds entries ordered by ID. Unlike other types, streams are kept
+// when they become empty, so that the last ID is never reused.
+type Stream struct {
+	entries []StreamEntry
+	// lastID is the ID of the last entry ever added
+	lastID StreamID
+	// entriesAdded counts the entries ever added
+	entriesAdded int64
+	// maxDeletedID is the greatest ID removed by XDEL
+	maxDeletedID StreamID
+	// groups maps a name to its consumer group
+	groups map[string]*ConsumerGroup
+}
+
+// constructor function for Stream
+func NewStream() *Stream {
+	return &Stream{groups: make(map[string]*ConsumerGroup)}
+}
+
+// Clone returns a deep copy of s
+func (s *Stream) Clone() *Stream {
+	c := *s
+	c.entries = make([]StreamEntry, len(s.entries))
+	for i, e := range s.entries {
+		c.entries[i] = StreamEntry{ID: e.ID, Fields: append([]string(nil), e.Fields...)}
+	}
+	c.groups = make(map[string]*ConsumerGroup, len(s.groups))
+	for name, g := range s.groups {
+		c.groups[name] = g.Clone()
+	}
+	return &c
+}
+
+// Len returns the number of entries
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+// search returns the position of the first entry whose ID is not less
+// than id
+func (s *Stream) search(id StreamID) int {
+	return sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].ID.Less(id) })
+}
+
+// entry returns the entry with the given ID
+func (s *Stream) entry(id StreamID) (StreamEntry, bool) {
+	if i := s.search(id); i < s.Len() && s.entries[i].ID == id {
+		return s.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// rangeEntries returns the entries with IDs in [start, end], in descending
+// order when rev is set, at most count of them (all when count is negative)
+func (s *Stream) rangeEntries(start, end StreamID, count int, rev bool) []StreamEntry {
+	lo := s.search(start)
+	hi := sort.Search(len(s.entries), func(i int) bool { return end.Less(s.entries[i].ID) })
+	if hi <= lo {
+		return nil
+	}
+	if count >= 0 && hi-lo > count {
+		if rev {
+			lo = hi - count
+		} else {
+			hi = lo + count
+		}
+	}
+	entries := make([]StreamEntry, 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		entries = append(entries, s.entries[i])
+	}
+	if rev {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	return entries
+}
+
+// streamNodeSize is the number of entries approximate trimming removes at a
+// time, standing for the entries per node of the Redis radix tree
+const streamNodeSize = 100
+
+// TrimOpts describes how to trim a stream: down to MaxLen entries for the
+// "MAXLEN" strategy, or of the entries older than MinID for "MINID". With
+// Approx, entries are only removed streamNodeSize at a time and at most
+// Limit of them (all when 0).
+type TrimOpts struct {
+	Strategy string
+	MaxLen   int
+	MinID    StreamID
+	Approx   bool
+	Limit    int
+}
+
+// trim trims s according to opts, returning the number of removed entries
+func (s *Stream) trim(opts TrimOpts) int {
+	var n int
+	switch opts.Strategy {
+	case "MAXLEN":
+		n = max(len(s.entries)-opts.MaxLen, 0)
+	case "MINID":
+		n = s.search(opts.MinID)
+	default:
+		return 0
+	}
+	if opts.Approx {
+		if opts.Limit > 0 {
+			n = min(n, opts.Limit)
+		}
+		n -= n % streamNodeSize
+	}
+	s.entries = append(s.entries[:0:0], s.entries[n:]...)
+	return n
+}
+
+// XAddOpts holds the options of an XADD. AutoID generates the whole entry
+// ID, AutoSeq only its sequence number.
+type XAddOpts struct {
+	NoMkStream bool
+	AutoID     bool
+	AutoSeq    bool
+	Trim       TrimOpts
+}
+
+// nextID returns the ID of the entry being added to s, which must be greater
+// than the last one
+func (s *Stream) nextID(id StreamID, opts XAddOpts) (StreamID, error) {
+	last := s.lastID
+	switch {
+	case opts.AutoID:
+		if last == maxStreamID {
+			return StreamID{}, errors.New("The stream has exhausted the last possible ID, unable to add more items")
+		}
+		id = StreamID{ms: uint64(time.Now().UnixMilli())}
+		if id.ms <= last.ms {
+			// the clock is behind the last entry, carrying into the next
+			// millisecond once its sequence numbers are exhausted
+			id = last.next()
+		}
+	case opts.AutoSeq:
+		if id.ms < last.ms || (id.ms == last.ms && last.seq == math.MaxUint64) {
+			return StreamID{}, errStreamIDTooSmall
+		}
+		if id.ms == last.ms {
+			// 0-0 is never a valid ID, so a new stream starts at 0-1
+			id.seq = last.seq + 1
+		}
+	case id == StreamID{}:
+		return StreamID{}, errors.New("The ID specified in XADD must be greater than 0-0")
+	case !last.Less(id):
+		return StreamID{}, errStreamIDTooSmall
+	}
+	return id, nil
+}
+
+var errStreamIDTooSmall = errors.New("The ID specified in XADD is equal or smaller than the target stream top item")
+
+// XAdd: append an entry holding fields to the stream at key, creating it
+// unless opts.NoMkStream is set, then trim the stream. Returns the ID of
+// the new entry, or false when the stream does not exist and was not
+// created.
+func (k *Kv) XAdd(key string, id StreamID, opts XAddOpts, fields []string) (StreamID, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return StreamID{}, false, err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		if opts.NoMkStream {
+			return StreamID{}, false, nil
+		}
+		s = NewStream()
+	}
+	id, err := s.nextID(id, opts)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	k.streams[key] = s
+	s.entries = append(s.entries, StreamEntry{ID: id, Fields: append([]string(nil), fields...)})
+	s.lastID = id
+	s.entriesAdded++
+	s.trim(opts.Trim)
+	k.wake(key)
+	return id, true, nil
+}
+
+// XLen: get the number of entries of the stream at key
+func (k *Kv) XLen(key string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return 0, err
+	}
+	if s, ok := k.streams[key]; ok {
+		return s.Len(), nil
+	}
+	return 0, nil
+}
+
+// XRange: get the entries of the stream at key with IDs between start and
+// end inclusive, at most count of them (all when count is negative)
+func (k *Kv) XRange(key string, start, end StreamID, count int) ([]StreamEntry, error) {
+	return k.xrange(key, start, end, count, false)
+}
+
+// XRevRange: like XRange, listing the entries from end down to start
+func (k *Kv) XRevRange(key string, start, end StreamID, count int) ([]StreamEntry, error) {
+	return k.xrange(key, start, end, count, true)
+}
+
+func (k *Kv) xrange(key string, start, end StreamID, count int, rev bool) ([]StreamEntry, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return nil, err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		return nil, nil
+	}
+	return s.rangeEntries(start, end, count, rev), nil
+}
+
+// XTrim: trim the stream at key according to opts, returning the number of
+// removed entries
+func (k *Kv) XTrim(key string, opts TrimOpts) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return 0, err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		return 0, nil
+	}
+	return s.trim(opts), nil
+}
+
+// XDel: remove the entries with the given IDs from the stream at key,
+// returning the number of removed entries. Unknown IDs are ignored.
+func (k *Kv) XDel(key string, ids []StreamID) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return 0, err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		return 0, nil
+	}
+	n := 0
+	for _, id := range ids {
+		i := s.search(id)
+		if i == len(s.entries) || s.entries[i].ID != id {
+			continue
+		}
+		s.entries = append(s.entries[:i], s.entries[i+1:]...)
+		if s.maxDeletedID.Less(id) {
+			s.maxDeletedID = id
+		}
+		n++
+	}
+	return n, nil
+}
+
+// StreamInfo describes a stream for XINFO STREAM. Entries and GroupInfos
+// are only filled in for the FULL form.
+type StreamInfo struct {
+	Length       int
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded int64
+	FirstID      StreamID
+	FirstEntry   *StreamEntry
+	LastEntry    *StreamEntry
+	Groups       int
+	Entries      []StreamEntry
+	GroupInfos   []GroupInfo
+}
+
+// XInfoStream: describe the stream at key, listing up to count of its first
+// entries when full is set (all when count is negative). Returns false when
+// there is no such stream.
+func (k *Kv) XInfoStream(key string, full bool, count int) (StreamInfo, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return StreamInfo{}, false, err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		return StreamInfo{}, false, nil
+	}
+	info := StreamInfo{
+		Length:       s.Len(),
+		LastID:       s.lastID,
+		MaxDeletedID: s.maxDeletedID,
+		EntriesAdded: s.entriesAdded,
+		Groups:       len(s.groups),
+	}
+	if s.Len() > 0 {
+		first, last := s.entries[0], s.entries[s.Len()-1]
+		info.FirstID = first.ID
+		info.FirstEntry, info.LastEntry = &first, &last
+	}
+	if full {
+		info.Entries = s.rangeEntries(StreamID{}, maxStreamID, count, false)
+		info.GroupInfos = s.groupInfos(true, count)
+	}
+	return info, true, nil
+}
+
+// XSetID: set the last ID of the stream at key, creating it empty if needed,
+// along with its count of added entries and the greatest deleted ID when not
+// nil. The ID may not be smaller than that of the last entry.
+func (k *Kv) XSetID(key string, id StreamID, entriesAdded *int64, maxDeletedID *StreamID) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		s = NewStream()
+	}
+	if s.Len() > 0 && id.Less(s.entries[s.Len()-1].ID) {
+		return errors.New("The ID specified in XSETID is smaller than the target stream top item")
+	}
+	if entriesAdded != nil && *entriesAdded < int64(s.Len()) {
+		return errors.New("The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	if maxDeletedID != nil && id.Less(*maxDeletedID) {
+		return errors.New("The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+	}
+	k.streams[key] = s
+	s.lastID = id
+	if entriesAdded != nil {
+		s.entriesAdded = *entriesAdded
+	}
+	if maxDeletedID != nil {
+		s.maxDeletedID = *maxDeletedID
+	}
+	return nil
+}
+
+// StreamRead holds the entries read from the stream at Key
+type StreamRead struct {
+	Key     string
+	Entries []StreamEntry
+}
+
+// XRead: get up to count entries (all when negative) following the given
+// ID from each of the streams at keys, skipping streams with no new entries
+func (k *Kv) XRead(keys []string, ids []StreamID, count int) ([]StreamRead, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range keys {
+		if err := k.checkType(key, "stream"); err != nil {
+			return nil, err
+		}
+	}
+	var reads []StreamRead
+	for i, key := range keys {
+		if entries := k.readAfterLocked(key, ids[i], count); len(entries) > 0 {
+			reads = append(reads, StreamRead{Key: key, Entries: entries})
+		}
+	}
+	return reads, nil
+}
+
+// readAfterLocked returns up to count entries of the stream at key with IDs
+// greater than id. Callers must hold k.mu.
+func (k *Kv) readAfterLocked(key string, id StreamID, count int) []StreamEntry {
+	s, ok := k.streams[key]
+	if !ok || id == maxStreamID {
+		return nil
+	}
+	return s.rangeEntries(id.next(), maxStreamID, count, false)
+}
+
+// XLastID: get the ID of the last entry added to the stream at key, 0-0 when
+// there is no such stream
+func (k *Kv) XLastID(key string) (StreamID, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return StreamID{}, err
+	}
+	if s, ok := k.streams[key]; ok {
+		return s.lastID, nil
+	}
+	return StreamID{}, nil
+}
+
+// parseRangeID parses an XRANGE interval bound: "-" and "+" stand for the
+// smallest and greatest IDs and a "(" prefix makes the bound exclusive. A
+// missing sequence number selects the whole millisecond.
+func parseRangeID(s string, isEnd bool) (StreamID, error) {
+	switch s {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return maxStreamID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	var missingSeq uint64
+	if isEnd {
+		missingSeq = math.MaxUint64
+	}
+	id, err := parseStreamID(s, missingSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+	switch {
+	case !isEnd && id == maxStreamID:
+		return id, errors.New("invalid start ID for the interval")
+	case isEnd && id == StreamID{}:
+		return id, errors.New("invalid end ID for the interval")
+	case !isEnd:
+		return id.next(), nil
+	default:
+		return id.prev(), nil
+	}
+}
+
+// next returns the ID following id, which must not be maxStreamID
+func (id StreamID) next() StreamID {
+	if id.seq == math.MaxUint64 {
+		return StreamID{id.ms + 1, 0}
+	}
+	return StreamID{id.ms, id.seq + 1}
+}
+
+// prev returns the ID preceding id, which must not be 0-0
+func (id StreamID) prev() StreamID {
+	if id.seq == 0 {
+		return StreamID{id.ms - 1, math.MaxUint64}
+	}
+	return StreamID{id.ms, id.seq - 1}
+}
+
+// streamReply formats entries as an array of [id, [field, value, ...]], the
+// fields being nil for entries without any
+func streamReply(entries []StreamEntry) Array {
+	respArray := make(Array, len(entries))
+	for i, e := range entries {
+		if e.Fields == nil {
+			// a pending entry deleted from the stream
+			respArray[i] = Array{BulkString(e.ID.String()), nil}
+			continue
+		}
+		respArray[i] = Array{BulkString(e.ID.String()), bulkArray(e.Fields)}
+	}
+	return respArray
+}
+
+// streamReadReply formats the result of XREAD as an array of [key, entries]
+func streamReadReply(reads []StreamRead) Array {
+	respArray := make(Array, len(reads))
+	for i, r := range reads {
+		respArray[i] = Array{BulkString(r.Key), streamReply(r.Entries)}
+	}
+	return respArray
+}
+
+// parseBlockTimeout parses the BLOCK timeout of XREAD, in milliseconds
+func parseBlockTimeout(s string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("timeout is not an integer or out of range")
+	}
+	if ms < 0 {
+		return 0, errors.New("timeout is negative")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// parseTrimOpts parses MAXLEN|MINID [=|~] threshold [LIMIT count] at the
+// start of args, returning the number of arguments used
+func parseTrimOpts(args []string) (TrimOpts, int, error) {
+	var opts TrimOpts
+	opts.Strategy = strings.ToUpper(args[0])
+	i := 1
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		opts.Approx = args[i] == "~"
+		i++
+	}
+	if i >= len(args) {
+		return opts, 0, errors.New("syntax error")
+	}
+	if opts.Strategy == "MAXLEN" {
+		n, err := strconv.Atoi(args[i])
+		if err != nil {
+			return opts, 0, errors.New("value is not an integer or out of range")
+		}
+		if n < 0 {
+			return opts, 0, errors.New("The MAXLEN argument must be >= 0.")
+		}
+		opts.MaxLen = n
+	} else {
+		id, err := parseStreamID(args[i], 0)
+		if err != nil {
+			return opts, 0, err
+		}
+		opts.MinID = id
+	}
+	i++
+	if i < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+		if i+1 >= len(args) {
+			return opts, 0, errors.New("syntax error")
+		}
+		limit, err := strconv.Atoi(args[i+1])
+		if err != nil || limit < 0 {
+			return opts, 0, errors.New("The LIMIT argument must be >= 0.")
+		}
+		if !opts.Approx {
+			return opts, 0, errors.New("syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		opts.Limit = limit
+		i += 2
+	}
+	return opts, i, nil
+}
+
+// Handlers for stream commands
+
+func xadd(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 4 {
+		return nil, errors.New("wrong number of arguments for 'xadd' command")
+	}
+	var opts XAddOpts
+	i := 1
+options:
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			opts.NoMkStream = true
+			i++
+		case "MAXLEN", "MINID":
+			trim, n, err := parseTrimOpts(args[i:])
+			if err != nil {
+				return nil, err
+			}
+			opts.Trim = trim
+			i += n
+		default:
+			break options
+		}
+	}
+	if i >= len(args) {
+		return nil, errors.New("syntax error")
+	}
+	var id StreamID
+	switch arg := args[i]; {
+	case arg == "*":
+		opts.AutoID = true
+	case strings.HasSuffix(arg, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(arg, "-*"), 10, 64)
+		if err != nil {
+			return nil, errInvalidStreamID
+		}
+		id, opts.AutoSeq = StreamID{ms: ms}, true
+	default:
+		var err error
+		if id, err = parseStreamID(arg, 0); err != nil {
+			return nil, err
+		}
+	}
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return nil, errors.New("wrong number of arguments for 'xadd' command")
+	}
+	id, ok, err := kv.XAdd(args[0], id, opts, fields)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return BulkString(id.String()), nil
+}
+
+func xlen(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("XLEN requires exactly one argument")
+	}
+	n, err := kv.XLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func xrange(args []string, kv *Kv) (RespValue, error) {
+	return xrangeCmd(args, kv, false)
+}
+
+// XREVRANGE takes the end of the interval first
+func xrevrange(args []string, kv *Kv) (RespValue, error) {
+	return xrangeCmd(args, kv, true)
+}
+
+func xrangeCmd(args []string, kv *Kv, rev bool) (RespValue, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return nil, errors.New("syntax error")
+	}
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := parseRangeID(startArg, false)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseRangeID(endArg, true)
+	if err != nil {
+		return nil, err
+	}
+	count := -1
+	if len(args) == 5 {
+		if !strings.EqualFold(args[3], "COUNT") {
+			return nil, errors.New("syntax error")
+		}
+		if count, err = strconv.Atoi(args[4]); err != nil {
+			return nil, errors.New("value is not an integer or out of range")
+		}
+		// a negative count selects nothing
+		count = max(count, 0)
+	}
+	entries, err := kv.xrange(args[0], start, end, count, rev)
+	if err != nil {
+		return nil, err
+	}
+	return streamReply(entries), nil
+}
+
+func xtrim(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("XTRIM requires at least three arguments")
+	}
+	strategy := strings.ToUpper(args[1])
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return nil, errors.New("syntax error")
+	}
+	opts, n, err := parseTrimOpts(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if 1+n != len(args) {
+		return nil, errors.New("syntax error")
+	}
+	removed, err := kv.XTrim(args[0], opts)
+	if err != nil {
+		return nil, err
+	}
+	return integer(removed), nil
+}
+
+func xdel(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("XDEL requires at least two arguments")
+	}
+	ids := make([]StreamID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	n, err := kv.XDel(args[0], ids)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+// xreadArgs holds the parsed arguments of XREAD and XREADGROUP
+type xreadArgs struct {
+	count           int // -1 for no limit
+	timeout         time.Duration
+	blocking        bool
+	noAck           bool
+	group, consumer string
+	keys, ids       []string
+}
+
+// parseXReadArgs parses the arguments of XREAD, or of XREADGROUP when group
+// is set
+func parseXReadArgs(args []string, group bool) (xreadArgs, error) {
+	parsed := xreadArgs{count: -1}
+	cmd := "xread"
+	if group {
+		cmd = "xreadgroup"
+	}
+	i := 0
+options:
+	for ; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return parsed, errors.New("value is not an integer or out of range")
+			}
+			// COUNT 0 or less means no limit
+			if n > 0 {
+				parsed.count = n
+			}
+			i++
+		case opt == "BLOCK" && i+1 < len(args):
+			d, err := parseBlockTimeout(args[i+1])
+			if err != nil {
+				return parsed, err
+			}
+			parsed.timeout, parsed.blocking = d, true
+			i++
+		case opt == "GROUP" && group && i+2 < len(args):
+			parsed.group, parsed.consumer = args[i+1], args[i+2]
+			i += 2
+		case opt == "NOACK" && group:
+			parsed.noAck = true
+		case opt == "STREAMS":
+			break options
+		default:
+			return parsed, errors.New("syntax error")
+		}
+	}
+	streams := args[min(i+1, len(args)):]
+	if i == len(args) || len(streams) == 0 {
+		return parsed, errors.New("syntax error")
+	}
+	if group && parsed.group == "" {
+		return parsed, errors.New("Missing GROUP option for XREADGROUP")
+	}
+	if len(streams)%2 != 0 {
+		return parsed, fmt.Errorf("Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", cmd)
+	}
+	parsed.keys, parsed.ids = streams[:len(streams)/2], streams[len(streams)/2:]
+	return parsed, nil
+}
+
+func xread(args []string, kv *Kv) (RespValue, error) {
+	parsed, err := parseXReadArgs(args, false)
+	if err != nil {
+		return nil, err
+	}
+	keys, count := parsed.keys, parsed.count
+	ids := make([]StreamID, len(keys))
+	for j, arg := range parsed.ids {
+		var err error
+		if arg == "$" {
+			// only entries added from now on
+			ids[j], err = kv.XLastID(keys[j])
+		} else {
+			ids[j], err = parseStreamID(arg, 0)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	reads, err := kv.XRead(keys, ids, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(reads) > 0 {
+		return streamReadReply(reads), nil
+	}
+	if !parsed.blocking {
+		return nil, nil
+	}
+	after := make(map[string]StreamID, len(keys))
+	for j := len(keys) - 1; j >= 0; j-- {
+		after[keys[j]] = ids[j]
+	}
+	return kv.block(keys, "stream", parsed.timeout, func(key string) (RespValue, bool, error) {
+		entries := kv.readAfterLocked(key, after[key], count)
+		if len(entries) == 0 {
+			return nil, false, nil
+		}
+		return streamReadReply([]StreamRead{{Key: key, Entries: entries}}), true, nil
+	})
+}
+
+var xinfoHelp = []string{
+	"XINFO <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CONSUMERS <key> <groupname>",
+	"    Show consumers of <groupname>.",
+	"GROUPS <key>",
+	"    Show the stream consumer groups.",
+	"STREAM <key> [FULL [COUNT <count>]",
+	"    Show information about the stream.",
+	"HELP",
+	"    Print this help.",
+}
+
+func xinfo(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("XINFO requires a subcommand")
+	}
+	switch sub := strings.ToUpper(args[0]); sub {
+	case "HELP":
+		if len(args) != 1 {
+			return nil, errors.New("XINFO HELP takes no arguments")
+		}
+		return bulkArray(xinfoHelp), nil
+	case "STREAM":
+		return xinfoStream(args[1:], kv)
+	case "GROUPS":
+		if len(args) != 2 {
+			return nil, errors.New("XINFO GROUPS requires exactly one argument")
+		}
+		groups, ok, err := kv.XInfoGroups(args[1])
+		if err != nil || !ok {
+			return nil, xinfoKeyErr(err)
+		}
+		respArray := make(Array, len(groups))
+		for i, g := range groups {
+			respArray[i] = Array{
+				BulkString("name"), BulkString(g.Name),
+				BulkString("consumers"), integer(g.Consumers),
+				BulkString("pending"), integer(g.Pending),
+				BulkString("last-delivered-id"), BulkString(g.LastID.String()),
+				BulkString("entries-read"), entriesReadReply(g.EntriesRead),
+				BulkString("lag"), integer(g.Lag),
+			}
+		}
+		return respArray, nil
+	case "CONSUMERS":
+		if len(args) != 3 {
+			return nil, errors.New("XINFO CONSUMERS requires exactly two arguments")
+		}
+		consumers, ok, err := kv.XInfoConsumers(args[1], args[2])
+		if err != nil || !ok {
+			return nil, xinfoKeyErr(err)
+		}
+		now := time.Now()
+		respArray := make(Array, len(consumers))
+		for i, c := range consumers {
+			inactive := integer(-1)
+			if !c.ActiveTime.IsZero() {
+				inactive = integer(now.Sub(c.ActiveTime).Milliseconds())
+			}
+			respArray[i] = Array{
+				BulkString("name"), BulkString(c.Name),
+				BulkString("pending"), integer(c.Pending),
+				BulkString("idle"), integer(now.Sub(c.SeenTime).Milliseconds()),
+				BulkString("inactive"), inactive,
+			}
+		}
+		return respArray, nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try XINFO HELP.", args[0])
+	}
+}
+
+// entriesReadReply formats the entries read by a group, nil when unknown
+func entriesReadReply(n int64) RespValue {
+	if n < 0 {
+		return nil
+	}
+	return integer(n)
+}
+
+// pelReply formats pending entries as [id, consumer, delivery time, count]
+// arrays, leaving out the consumer when withConsumer is unset
+func pelReply(pel []PendingInfo, withConsumer bool) Array {
+	respArray := make(Array, len(pel))
+	for i, p := range pel {
+		item := Array{BulkString(p.ID.String())}
+		if withConsumer {
+			item = append(item, BulkString(p.Consumer))
+		}
+		respArray[i] = append(item, integer(p.LastDelivered.UnixMilli()), integer(p.Deliveries))
+	}
+	return respArray
+}
+
+// xinfoKeyErr returns err, or the error XINFO replies with for missing keys
+func xinfoKeyErr(err error) error {
+	if err != nil {
+		return err
+	}
+	return errors.New("no such key")
+}
+
+func xinfoStream(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("XINFO STREAM requires a key")
+	}
+	full, count := false, 10
+	if len(args) > 1 {
+		if !strings.EqualFold(args[1], "FULL") || (len(args) != 2 && len(args) != 4) {
+			return nil, errors.New("syntax error")
+		}
+		full = true
+		if len(args) == 4 {
+			if !strings.EqualFold(args[2], "COUNT") {
+				return nil, errors.New("syntax error")
+			}
+			n, err := strconv.Atoi(args[3])
+			if err != nil {
+				return nil, errors.New("value is not an integer or out of range")
+			}
+			// COUNT 0 lists all entries
+			if count = n; count <= 0 {
+				count = -1
+			}
+		}
+	}
+	info, ok, err := kv.XInfoStream(args[0], full, count)
+	if err != nil || !ok {
+		return nil, xinfoKeyErr(err)
+	}
+	reply := Array{
+		BulkString("length"), integer(info.Length),
+		BulkString("last-generated-id"), BulkString(info.LastID.String()),
+		BulkString("max-deleted-entry-id"), BulkString(info.MaxDeletedID.String()),
+		BulkString("entries-added"), integer(info.EntriesAdded),
+		BulkString("recorded-first-entry-id"), BulkString(info.FirstID.String()),
+	}
+	if full {
+		return append(reply,
+			BulkString("entries"), streamReply(info.Entries),
+			BulkString("groups"), fullGroupsReply(info.GroupInfos),
+		), nil
+	}
+	entryReply := func(e *StreamEntry) RespValue {
+		if e == nil {
+			return nil
+		}
+		return streamReply([]StreamEntry{*e})[0]
+	}
+	return append(reply,
+		BulkString("groups"), integer(info.Groups),
+		BulkString("first-entry"), entryReply(info.FirstEntry),
+		BulkString("last-entry"), entryReply(info.LastEntry),
+	), nil
+}
+
+// fullGroupsReply formats the groups of XINFO STREAM FULL
+func fullGroupsReply(groups []GroupInfo) Array {
+	respArray := make(Array, len(groups))
+	for i, g := range groups {
+		consumers := make(Array, len(g.ConsumerInfos))
+		for j, c := range g.ConsumerInfos {
+			consumers[j] = Array{
+				BulkString("name"), BulkString(c.Name),
+				BulkString("seen-time"), integer(c.SeenTime.UnixMilli()),
+				BulkString("active-time"), integer(activeTimeMilli(c.ActiveTime)),
+				BulkString("pel-count"), integer(c.Pending),
+				BulkString("pending"), pelReply(c.PEL, false),
+			}
+		}
+		respArray[i] = Array{
+			BulkString("name"), BulkString(g.Name),
+			BulkString("last-delivered-id"), BulkString(g.LastID.String()),
+			BulkString("entries-read"), entriesReadReply(g.EntriesRead),
+			BulkString("lag"), integer(g.Lag),
+			BulkString("pel-count"), integer(g.Pending),
+			BulkString("pending"), pelReply(g.PEL, true),
+			BulkString("consumers"), consumers,
+		}
+	}
+	return respArray
+}
+
+// activeTimeMilli returns t as a Unix time in milliseconds, -1 for consumers
+// never delivered any entry
+func activeTimeMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return -1
+	}
+	return t.UnixMilli()
+}
+
+func xsetid(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("XSETID requires at least two arguments")
+	}
+	id, err := parseStreamID(args[1], 0)
+	if err != nil {
+		return nil, err
+	}
+	var entriesAdded *int64
+	var maxDeletedID *StreamID
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, errors.New("syntax error")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "ENTRIESADDED":
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, errors.New("value is not an integer or out of range")
+			}
+			if n < 0 {
+				return nil, errors.New("entries_added must be positive")
+			}
+			entriesAdded = &n
+		case "MAXDELETEDID":
+			deleted, err := parseStreamID(args[i+1], 0)
+			if err != nil {
+				return nil, err
+			}
+			maxDeletedID = &deleted
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	if err := kv.XSetID(args[0], id, entriesAdded, maxDeletedID); err != nil {
+		return nil, err
+	}
+	return SimpleString("OK"), nil
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXAddIDs(t *testing.T) {
+	kv := NewKv()
+	resp, err := xadd([]string{"s", "1-1", "f", "v"}, kv)
+	if err != nil || resp != BulkString("1-1") {
+		t.Fatalf("XADD 1-1 = %v, %v", resp, err)
+	}
+	if resp, _ := xadd([]string{"s", "1-*", "f", "v"}, kv); resp != BulkString("1-2") {
+		t.Fatalf("XADD 1-* = %v, want 1-2", resp)
+	}
+	if resp, _ := xadd([]string{"s", "5-*", "f", "v"}, kv); resp != BulkString("5-0") {
+		t.Fatalf("XADD 5-* = %v, want 5-0", resp)
+	}
+	if resp, _ := xadd([]string{"s", "7", "f", "v"}, kv); resp != BulkString("7-0") {
+		t.Fatalf("XADD 7 = %v, want 7-0", resp)
+	}
+	resp, _ = xadd([]string{"s", "*", "f", "v"}, kv)
+	id, _ := parseStreamID(string(resp.(BulkString)), 0)
+	if now := uint64(time.Now().UnixMilli()); id.ms > now || now-id.ms > 1000 || id.seq != 0 {
+		t.Fatalf("XADD * = %v, want the current time", resp)
+	}
+	for _, args := range [][]string{
+		{"s", "7-0", "f", "v"},
+		{"s", "6-*", "f", "v"},
+		{"new", "0-0", "f", "v"},
+		{"s", "x-1", "f", "v"},
+		{"s", "*", "f"},
+		{"s", "MAXLEN", "-1", "*", "f", "v"},
+		{"s", "MAXLEN", "10", "LIMIT", "5", "*", "f", "v"},
+	} {
+		if _, err := xadd(args, kv); err == nil {
+			t.Fatalf("expected error for XADD %v", args)
+		}
+	}
+	if resp, _ := xadd([]string{"zero", "0-*", "f", "v"}, kv); resp != BulkString("0-1") {
+		t.Fatalf("XADD 0-* on new stream = %v, want 0-1", resp)
+	}
+	// an auto ID behind the clock carries into the next millisecond
+	xadd([]string{"future", "99999999999999-18446744073709551615", "f", "v"}, kv)
+	if resp, _ := xadd([]string{"future", "*", "f", "v"}, kv); resp != BulkString("100000000000000-0") {
+		t.Fatalf("XADD * after the last sequence number = %v, want 100000000000000-0", resp)
+	}
+	if typ := kv.Type("s"); typ != "stream" {
+		t.Fatalf("type = %q, want stream", typ)
+	}
+	kv.Set("str", "x")
+	if _, err := xadd([]string{"str", "*", "f", "v"}, kv); err != errWrongType {
+		t.Fatalf("XADD on string = %v, want WRONGTYPE", err)
+	}
+}
+
+func TestXAddNoMkStream(t *testing.T) {
+	kv := NewKv()
+	resp, err := xadd([]string{"s", "NOMKSTREAM", "*", "f", "v"}, kv)
+	if err != nil || resp != nil || kv.Type("s") != "none" {
+		t.Fatalf("XADD NOMKSTREAM = %v, %v; want nil and no stream", resp, err)
+	}
+	xadd([]string{"s", "1-1", "f", "v"}, kv)
+	if resp, _ := xadd([]string{"s", "nomkstream", "*", "f", "v"}, kv); resp == nil {
+		t.Fatalf("XADD NOMKSTREAM on existing stream = nil")
+	}
+}
+
+func TestXAddTrim(t *testing.T) {
+	kv := NewKv()
+	for i := 1; i <= 5; i++ {
+		xadd([]string{"s", "MAXLEN", "3", "*", "n", strings.Repeat("x", i)}, kv)
+	}
+	s := kv.streams["s"]
+	if s.Len() != 3 || s.entries[0].Fields[1] != "xxx" || s.entriesAdded != 5 {
+		t.Fatalf("stream after MAXLEN 3 has %d entries starting with %v", s.Len(), s.entries[0].Fields)
+	}
+	xadd([]string{"s", "MINID", "=", s.entries[2].ID.String(), "*", "n", "last"}, kv)
+	if s.Len() != 2 {
+		t.Fatalf("stream after MINID has %d entries, want 2", s.Len())
+	}
+	// approximate trimming only removes whole nodes
+	for i := 0; i < 150; i++ {
+		xadd([]string{"big", "MAXLEN", "~", "10", "*", "f", "v"}, kv)
+	}
+	if n := kv.streams["big"].Len(); n != 50 {
+		t.Fatalf("stream after MAXLEN ~ 10 has %d entries, want 50", n)
+	}
+	xadd([]string{"big", "MAXLEN", "~", "0", "LIMIT", "50", "*", "f", "v"}, kv)
+	if n := kv.streams["big"].Len(); n != 51 {
+		t.Fatalf("stream after LIMIT 50 has %d entries, want 51", n)
+	}
+}
+
+// streamIDs returns the IDs of entries as strings
+func streamIDs(entries []StreamEntry) []string {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID.String()
+	}
+	return ids
+}
+
+func TestXRange(t *testing.T) {
+	kv := NewKv()
+	for _, id := range []string{"1-0", "1-1", "2-0", "3-5"} {
+		xadd([]string{"s", id, "id", id}, kv)
+	}
+	if n, _ := kv.XLen("s"); n != 4 {
+		t.Fatalf("XLen = %d, want 4", n)
+	}
+	if resp, _ := xlen([]string{"missing"}, kv); resp != integer(0) {
+		t.Fatalf("XLEN of missing key = %v, want 0", resp)
+	}
+	for _, c := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"s", "-", "+"}, []string{"1-0", "1-1", "2-0", "3-5"}},
+		{[]string{"s", "1", "2"}, []string{"1-0", "1-1", "2-0"}},
+		{[]string{"s", "(1-0", "(3-5"}, []string{"1-1", "2-0"}},
+		{[]string{"s", "-", "+", "COUNT", "2"}, []string{"1-0", "1-1"}},
+		{[]string{"s", "-", "+", "COUNT", "-1"}, []string{}},
+		{[]string{"s", "3", "1"}, []string{}},
+		{[]string{"missing", "-", "+"}, []string{}},
+	} {
+		entries, err := xrange(c.args, kv)
+		if err != nil {
+			t.Fatalf("XRANGE %v error: %v", c.args, err)
+		}
+		var got []string
+		for _, e := range entries.(Array) {
+			got = append(got, string(e.(Array)[0].(BulkString)))
+		}
+		if !equalStrings(got, c.want) {
+			t.Fatalf("XRANGE %v = %v, want %v", c.args, got, c.want)
+		}
+	}
+	resp, _ := xrange([]string{"s", "2-0", "2-0"}, kv)
+	if entry := resp.(Array)[0].(Array); entry[1].(Array)[1] != BulkString("2-0") {
+		t.Fatalf("XRANGE entry = %v", entry)
+	}
+
+	resp, _ = xrevrange([]string{"s", "+", "(1-0", "COUNT", "2"}, kv)
+	if arr := resp.(Array); len(arr) != 2 || arr[0].(Array)[0] != BulkString("3-5") || arr[1].(Array)[0] != BulkString("2-0") {
+		t.Fatalf("XREVRANGE = %v, want [3-5 2-0]", arr)
+	}
+	if entries, _ := kv.XRevRange("s", StreamID{1, 0}, StreamID{2, 0}, -1); !equalStrings(streamIDs(entries), []string{"2-0", "1-1", "1-0"}) {
+		t.Fatalf("XRevRange = %v", streamIDs(entries))
+	}
+
+	for _, args := range [][]string{
+		{"s", "x", "+"},
+		{"s", "-", "+", "COUNT"},
+		{"s", "-", "+", "LIMIT", "1"},
+		{"s", "(18446744073709551615-18446744073709551615", "+"},
+		{"s", "-", "(0-0"},
+	} {
+		if _, err := xrange(args, kv); err == nil {
+			t.Fatalf("expected error for XRANGE %v", args)
+		}
+	}
+}
+
+func TestXRead(t *testing.T) {
+	kv := NewKv()
+	xadd([]string{"a", "1-0", "f", "1"}, kv)
+	xadd([]string{"a", "2-0", "f", "2"}, kv)
+	xadd([]string{"b", "1-0", "f", "3"}, kv)
+
+	resp, err := xread([]string{"COUNT", "1", "STREAMS", "a", "b", "missing", "1-0", "0", "0"}, kv)
+	if err != nil {
+		t.Fatalf("XREAD error: %v", err)
+	}
+	arr := resp.(Array)
+	if len(arr) != 2 || arr[0].(Array)[0] != BulkString("a") || arr[1].(Array)[0] != BulkString("b") {
+		t.Fatalf("XREAD = %v, want entries of a and b", arr)
+	}
+	if entries := arr[0].(Array)[1].(Array); len(entries) != 1 || entries[0].(Array)[0] != BulkString("2-0") {
+		t.Fatalf("XREAD entries of a = %v, want [2-0]", entries)
+	}
+	if resp, err := xread([]string{"STREAMS", "a", "$"}, kv); resp != nil || err != nil {
+		t.Fatalf("XREAD $ = %v, %v; want nil", resp, err)
+	}
+	if resp, _ := xread([]string{"BLOCK", "10", "STREAMS", "a", "2-0"}, kv); resp != nil {
+		t.Fatalf("XREAD BLOCK timeout = %v, want nil", resp)
+	}
+	for _, args := range [][]string{
+		{"STREAMS", "a"},
+		{"STREAMS", "a", "b", "0"},
+		{"COUNT", "x", "STREAMS", "a", "0"},
+		{"BLOCK", "-1", "STREAMS", "a", "0"},
+		{"a", "0"},
+		{"STREAMS", "a", "bad"},
+	} {
+		if _, err := xread(args, kv); err == nil {
+			t.Fatalf("expected error for XREAD %v", args)
+		}
+	}
+}
+
+func TestXReadBlock(t *testing.T) {
+	kv := NewKv()
+	xadd([]string{"a", "1-0", "f", "old"}, kv)
+	done := make(chan RespValue, 1)
+	go func() {
+		resp, _ := xread([]string{"BLOCK", "0", "STREAMS", "a", "b", "$", "$"}, kv)
+		done <- resp
+	}()
+	waitBlocked(t, kv, "b", 1)
+	xadd([]string{"b", "5-0", "f", "new"}, kv)
+	arr := (<-done).(Array)
+	read := arr[0].(Array)
+	if len(arr) != 1 || read[0] != BulkString("b") || read[1].(Array)[0].(Array)[0] != BulkString("5-0") {
+		t.Fatalf("XREAD BLOCK = %v, want the new entry of b", arr)
+	}
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if len(kv.waiters) != 0 {
+		t.Fatalf("served client should be removed from all keys")
+	}
+}
+
+func TestXTrim(t *testing.T) {
+	kv := NewKv()
+	for i := 1; i <= 250; i++ {
+		kv.XAdd("s", StreamID{uint64(i), 0}, XAddOpts{}, []string{"f", "v"})
+	}
+	// approximate trimming keeps at least the threshold
+	resp, err := xtrim([]string{"s", "MAXLEN", "~", "120"}, kv)
+	if err != nil || resp != integer(100) {
+		t.Fatalf("XTRIM MAXLEN ~ 120 = %v, %v; want 100", resp, err)
+	}
+	if n, _ := kv.XLen("s"); n < 120 {
+		t.Fatalf("XLen after approximate trim = %d, want at least 120", n)
+	}
+	if resp, _ := xtrim([]string{"s", "MAXLEN", "~", "100", "LIMIT", "10"}, kv); resp != integer(0) {
+		t.Fatalf("XTRIM with LIMIT below a node = %v, want 0", resp)
+	}
+	if resp, _ := xtrim([]string{"s", "MINID", "200"}, kv); resp != integer(99) {
+		t.Fatalf("XTRIM MINID 200 = %v, want 99", resp)
+	}
+	if resp, _ := xtrim([]string{"s", "MAXLEN", "=", "10"}, kv); resp != integer(41) {
+		t.Fatalf("XTRIM MAXLEN = 10 = %v, want 41", resp)
+	}
+	// trimming never deletes the stream
+	xtrim([]string{"s", "MAXLEN", "0"}, kv)
+	if n, _ := kv.XLen("s"); n != 0 || kv.Type("s") != "stream" {
+		t.Fatalf("stream trimmed to 0 has %d entries and type %s", n, kv.Type("s"))
+	}
+	if resp, _ := xtrim([]string{"missing", "MAXLEN", "0"}, kv); resp != integer(0) {
+		t.Fatalf("XTRIM of missing key = %v, want 0", resp)
+	}
+	for _, args := range [][]string{
+		{"s", "COUNT", "1"},
+		{"s", "MAXLEN", "1", "extra"},
+		{"s", "MAXLEN", "=", "1", "LIMIT", "1"},
+	} {
+		if _, err := xtrim(args, kv); err == nil {
+			t.Fatalf("expected error for XTRIM %v", args)
+		}
+	}
+}
+
+func TestXDel(t *testing.T) {
+	kv := NewKv()
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		xadd([]string{"s", id, "f", "v"}, kv)
+	}
+	resp, err := xdel([]string{"s", "3-0", "1", "9-9"}, kv)
+	if err != nil || resp != integer(2) {
+		t.Fatalf("XDEL = %v, %v; want 2", resp, err)
+	}
+	entries, _ := kv.XRange("s", StreamID{}, maxStreamID, -1)
+	if !equalStrings(streamIDs(entries), []string{"2-0"}) {
+		t.Fatalf("entries after XDEL = %v, want [2-0]", streamIDs(entries))
+	}
+	s := kv.streams["s"]
+	if s.maxDeletedID != (StreamID{3, 0}) || s.lastID != (StreamID{3, 0}) {
+		t.Fatalf("max deleted ID = %v, last ID = %v; want 3-0", s.maxDeletedID, s.lastID)
+	}
+	// the last ID is not reused after deleting the last entry
+	if _, err := xadd([]string{"s", "3-0", "f", "v"}, kv); err == nil {
+		t.Fatalf("expected error adding a deleted ID")
+	}
+	if _, err := xdel([]string{"s", "x"}, kv); err == nil {
+		t.Fatalf("expected error for invalid ID")
+	}
+}
+
+// infoField returns the value following name in a flat XINFO reply
+func infoField(t *testing.T, reply Array, name string) RespValue {
+	t.Helper()
+	for i := 0; i+1 < len(reply); i += 2 {
+		if reply[i] == BulkString(name) {
+			return reply[i+1]
+		}
+	}
+	t.Fatalf("XINFO reply has no %q field: %v", name, reply)
+	return nil
+}
+
+func TestXInfoStream(t *testing.T) {
+	kv := NewKv()
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		xadd([]string{"s", id, "f", id}, kv)
+	}
+	xdel([]string{"s", "3-0"}, kv)
+	resp, err := xinfo([]string{"STREAM", "s"}, kv)
+	if err != nil {
+		t.Fatalf("XINFO STREAM error: %v", err)
+	}
+	reply := resp.(Array)
+	for name, want := range map[string]RespValue{
+		"length":                  integer(2),
+		"last-generated-id":       BulkString("3-0"),
+		"max-deleted-entry-id":    BulkString("3-0"),
+		"entries-added":           integer(3),
+		"recorded-first-entry-id": BulkString("1-0"),
+		"groups":                  integer(0),
+	} {
+		if got := infoField(t, reply, name); got != want {
+			t.Fatalf("XINFO STREAM %s = %v, want %v", name, got, want)
+		}
+	}
+	if last := infoField(t, reply, "last-entry").(Array); last[0] != BulkString("2-0") {
+		t.Fatalf("XINFO STREAM last-entry = %v, want 2-0", last)
+	}
+
+	resp, _ = xinfo([]string{"STREAM", "s", "FULL", "COUNT", "1"}, kv)
+	if entries := infoField(t, resp.(Array), "entries").(Array); len(entries) != 1 {
+		t.Fatalf("XINFO STREAM FULL COUNT 1 entries = %v", entries)
+	}
+
+	kv.XAdd("empty", StreamID{1, 0}, XAddOpts{Trim: TrimOpts{Strategy: "MAXLEN"}}, []string{"f", "v"})
+	resp, _ = xinfo([]string{"STREAM", "empty"}, kv)
+	if first := infoField(t, resp.(Array), "first-entry"); first != nil {
+		t.Fatalf("first-entry of empty stream = %v, want nil", first)
+	}
+
+	if resp, err := xinfo([]string{"GROUPS", "s"}, kv); err != nil || len(resp.(Array)) != 0 {
+		t.Fatalf("XINFO GROUPS = %v, %v; want empty", resp, err)
+	}
+	for _, args := range [][]string{
+		{"STREAM", "missing"},
+		{"STREAM", "s", "COUNT", "1"},
+		{"GROUPS", "missing"},
+		{"CONSUMERS", "s", "g"},
+		{"BOGUS", "s"},
+	} {
+		if _, err := xinfo(args, kv); err == nil {
+			t.Fatalf("expected error for XINFO %v", args)
+		}
+	}
+	if resp, _ := xinfo([]string{"HELP"}, kv); len(resp.(Array)) == 0 {
+		t.Fatalf("XINFO HELP returned nothing")
+	}
+}
+
+func TestXSetID(t *testing.T) {
+	kv := NewKv()
+	xadd([]string{"s", "1-0", "f", "v"}, kv)
+	xadd([]string{"s", "2-0", "f", "v"}, kv)
+	xdel([]string{"s", "2-0"}, kv)
+	// the last ID may go back down to that of the last entry
+	if resp, err := xsetid([]string{"s", "1-0"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("XSETID = %v, %v", resp, err)
+	}
+	if _, err := xsetid([]string{"s", "0-5"}, kv); err == nil {
+		t.Fatalf("expected error for an ID below the last entry")
+	}
+
+	if _, err := xsetid([]string{"s", "100-7", "ENTRIESADDED", "42", "MAXDELETEDID", "50-0"}, kv); err != nil {
+		t.Fatalf("XSETID with options error: %v", err)
+	}
+	resp, _ := xadd([]string{"s", "*", "f", "v"}, kv)
+	id, _ := parseStreamID(string(resp.(BulkString)), 0)
+	if !(StreamID{100, 7}).Less(id) {
+		t.Fatalf("ID generated after XSETID = %v, want greater than 100-7", id)
+	}
+	s := kv.streams["s"]
+	if s.entriesAdded != 43 || s.maxDeletedID != (StreamID{50, 0}) {
+		t.Fatalf("stream after XSETID has %d entries added and max deleted ID %v", s.entriesAdded, s.maxDeletedID)
+	}
+
+	xsetid([]string{"fresh", "5-5"}, kv)
+	if resp, _ := xadd([]string{"fresh", "5-*", "f", "v"}, kv); resp != BulkString("5-6") {
+		t.Fatalf("XADD 5-* after XSETID 5-5 = %v, want 5-6", resp)
+	}
+	for _, args := range [][]string{
+		{"s", "x"},
+		{"s", "999999999999999-0", "ENTRIESADDED", "0"},
+		{"s", "999999999999999-0", "MAXDELETEDID", "9999999999999999-0"},
+		{"s", "999999999999999-0", "ENTRIESADDED"},
+		{"s", "999999999999999-0", "BOGUS", "1"},
+	} {
+		if _, err := xsetid(args, kv); err == nil {
+			t.Fatalf("expected error for XSETID %v", args)
+		}
+	}
+}
@@ -0,0 +1,1061 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsumerGroup tracks the delivery of the entries of a stream to a set of
+// consumers. Entries delivered but not acknowledged yet are pending, kept in
+// the pending entry list (PEL) of the group as well as that of the consumer
+// they were delivered to.
+type ConsumerGroup struct {
+	// lastID is the ID of the last entry delivered to the group
+	lastID StreamID
+	// entriesRead counts the entries delivered to the group, -1 when unknown
+	entriesRead int64
+	pending     map[StreamID]*pendingEntry
+	consumers   map[string]*consumer
+}
+
+// pendingEntry is a delivered entry waiting to be acknowledged
+type pendingEntry struct {
+	consumer      string
+	lastDelivered time.Time
+	deliveries    int
+}
+
+// consumer is a member of a consumer group
+type consumer struct {
+	// seenTime is the last time the consumer issued a command, activeTime
+	// the last time it was delivered entries (zero until then)
+	seenTime   time.Time
+	activeTime time.Time
+	pending    map[StreamID]struct{}
+}
+
+// constructor function for ConsumerGroup
+func NewConsumerGroup(lastID StreamID, entriesRead int64) *ConsumerGroup {
+	return &ConsumerGroup{
+		lastID:      lastID,
+		entriesRead: entriesRead,
+		pending:     make(map[StreamID]*pendingEntry),
+		consumers:   make(map[string]*consumer),
+	}
+}
+
+// Clone returns a deep copy of g
+func (g *ConsumerGroup) Clone() *ConsumerGroup {
+	c := NewConsumerGroup(g.lastID, g.entriesRead)
+	for id, p := range g.pending {
+		entry := *p
+		c.pending[id] = &entry
+	}
+	for name, cons := range g.consumers {
+		cc := &consumer{seenTime: cons.seenTime, activeTime: cons.activeTime, pending: make(map[StreamID]struct{}, len(cons.pending))}
+		for id := range cons.pending {
+			cc.pending[id] = struct{}{}
+		}
+		c.consumers[name] = cc
+	}
+	return c
+}
+
+// createConsumer adds the consumer name unless it exists, reporting whether
+// it did
+func (g *ConsumerGroup) createConsumer(name string) bool {
+	if _, ok := g.consumers[name]; ok {
+		return false
+	}
+	g.consumers[name] = &consumer{seenTime: time.Now(), pending: make(map[StreamID]struct{})}
+	return true
+}
+
+// ack removes id from the PEL, reporting whether it was pending
+func (g *ConsumerGroup) ack(id StreamID) bool {
+	p, ok := g.pending[id]
+	if !ok {
+		return false
+	}
+	delete(g.consumers[p.consumer].pending, id)
+	delete(g.pending, id)
+	return true
+}
+
+// claim hands the pending entry id over to the consumer name, as delivered
+// at deliveredAt. Unless justID is set it counts as a new delivery.
+func (g *ConsumerGroup) claim(id StreamID, name string, deliveredAt time.Time, justID bool) {
+	p := g.pending[id]
+	delete(g.consumers[p.consumer].pending, id)
+	p.consumer = name
+	p.lastDelivered = deliveredAt
+	if !justID {
+		p.deliveries++
+	}
+	g.consumers[name].pending[id] = struct{}{}
+}
+
+// pendingIDs returns the IDs of the given PEL in ascending order
+func pendingIDs[V any](pel map[StreamID]V) []StreamID {
+	ids := make([]StreamID, 0, len(pel))
+	for id := range pel {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+// PendingInfo describes a pending entry
+type PendingInfo struct {
+	ID            StreamID
+	Consumer      string
+	LastDelivered time.Time
+	Deliveries    int
+}
+
+// ConsumerInfo describes a consumer for XINFO. PEL is only filled in for
+// XINFO STREAM FULL.
+type ConsumerInfo struct {
+	Name       string
+	Pending    int
+	SeenTime   time.Time
+	ActiveTime time.Time
+	PEL        []PendingInfo
+}
+
+// GroupInfo describes a consumer group for XINFO. PEL and ConsumerInfos are
+// only filled in for XINFO STREAM FULL.
+type GroupInfo struct {
+	Name          string
+	Consumers     int
+	Pending       int
+	LastID        StreamID
+	EntriesRead   int64
+	Lag           int
+	PEL           []PendingInfo
+	ConsumerInfos []ConsumerInfo
+}
+
+// pendingInfo describes the first count entries of pel (all when count is
+// negative)
+func (g *ConsumerGroup) pendingInfo(pel []StreamID, count int) []PendingInfo {
+	if count >= 0 && len(pel) > count {
+		pel = pel[:count]
+	}
+	infos := make([]PendingInfo, len(pel))
+	for i, id := range pel {
+		p := g.pending[id]
+		infos[i] = PendingInfo{ID: id, Consumer: p.consumer, LastDelivered: p.lastDelivered, Deliveries: p.deliveries}
+	}
+	return infos
+}
+
+// consumerInfos describes the consumers of g sorted by name, along with up
+// to count of their pending entries when full is set
+func (g *ConsumerGroup) consumerInfos(full bool, count int) []ConsumerInfo {
+	names := make([]string, 0, len(g.consumers))
+	for name := range g.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infos := make([]ConsumerInfo, len(names))
+	for i, name := range names {
+		c := g.consumers[name]
+		infos[i] = ConsumerInfo{Name: name, Pending: len(c.pending), SeenTime: c.seenTime, ActiveTime: c.activeTime}
+		if full {
+			infos[i].PEL = g.pendingInfo(pendingIDs(c.pending), count)
+		}
+	}
+	return infos
+}
+
+// groupInfos describes the consumer groups of s sorted by name, along with
+// up to count of their pending entries when full is set
+func (s *Stream) groupInfos(full bool, count int) []GroupInfo {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infos := make([]GroupInfo, len(names))
+	for i, name := range names {
+		g := s.groups[name]
+		infos[i] = GroupInfo{
+			Name:        name,
+			Consumers:   len(g.consumers),
+			Pending:     len(g.pending),
+			LastID:      g.lastID,
+			EntriesRead: g.entriesRead,
+			// the entries not delivered to the group yet
+			Lag: len(s.rangeEntries(g.lastID.next(), maxStreamID, -1, false)),
+		}
+		if g.lastID == maxStreamID {
+			infos[i].Lag = 0
+		}
+		if full {
+			infos[i].PEL = g.pendingInfo(pendingIDs(g.pending), count)
+			infos[i].ConsumerInfos = g.consumerInfos(true, count)
+		}
+	}
+	return infos
+}
+
+// XInfoGroups: describe the consumer groups of the stream at key. Returns
+// false when there is no such stream.
+func (k *Kv) XInfoGroups(key string) ([]GroupInfo, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return nil, false, err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return s.groupInfos(false, 0), true, nil
+}
+
+// XInfoConsumers: describe the consumers of group. Returns false when there
+// is no stream at key.
+func (k *Kv) XInfoConsumers(key, group string) ([]ConsumerInfo, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	s, g, err := k.groupLocked(key, group)
+	if err != nil || s == nil {
+		return nil, false, err
+	}
+	if g == nil {
+		return nil, false, errNoGroup(key, group)
+	}
+	return g.consumerInfos(false, 0), true, nil
+}
+
+// errNoStream is returned by XGROUP subcommands targeting a missing key
+var errNoStream = errors.New("The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+
+// errStreamDeleted fails the clients blocked in XREADGROUP on a stream that
+// is deleted
+var errStreamDeleted = respErr("UNBLOCKED the stream key no longer exists")
+
+// errNoGroup returns the error replied when group does not exist at key
+func errNoGroup(key, group string) error {
+	return respErr(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+}
+
+// groupLocked returns the stream at key and its consumer group group, nil
+// when they do not exist. Callers must hold k.mu.
+func (k *Kv) groupLocked(key, group string) (*Stream, *ConsumerGroup, error) {
+	if err := k.checkType(key, "stream"); err != nil {
+		return nil, nil, err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		return nil, nil, nil
+	}
+	return s, s.groups[group], nil
+}
+
+// xgroupLocked is groupLocked for XGROUP subcommands, failing when the
+// stream or the group does not exist. Callers must hold k.mu.
+func (k *Kv) xgroupLocked(key, group string) (*Stream, *ConsumerGroup, error) {
+	s, g, err := k.groupLocked(key, group)
+	switch {
+	case err != nil:
+		return nil, nil, err
+	case s == nil:
+		return nil, nil, errNoStream
+	case g == nil:
+		return nil, nil, errNoGroup(key, group)
+	}
+	return s, g, nil
+}
+
+// XGroupCreate: create the consumer group group of the stream at key, having
+// been delivered the entries up to lastID. With mkStream a missing stream is
+// created empty. entriesRead is the number of entries the group has read,
+// -1 when unknown.
+func (k *Kv) XGroupCreate(key, group string, lastID StreamID, mkStream bool, entriesRead int64) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "stream"); err != nil {
+		return err
+	}
+	s, ok := k.streams[key]
+	if !ok {
+		if !mkStream {
+			return errNoStream
+		}
+		s = NewStream()
+		k.streams[key] = s
+	}
+	if _, ok := s.groups[group]; ok {
+		return respErr("BUSYGROUP Consumer Group name already exists")
+	}
+	s.groups[group] = NewConsumerGroup(lastID, entriesRead)
+	return nil
+}
+
+// XGroupSetID: set the ID of the last entry delivered to group
+func (k *Kv) XGroupSetID(key, group string, lastID StreamID, entriesRead int64) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, g, err := k.xgroupLocked(key, group)
+	if err != nil {
+		return err
+	}
+	g.lastID, g.entriesRead = lastID, entriesRead
+	return nil
+}
+
+// XGroupDestroy: delete group along with its consumers and PEL, reporting
+// whether it existed
+func (k *Kv) XGroupDestroy(key, group string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	s, g, err := k.groupLocked(key, group)
+	if err != nil {
+		return false, err
+	}
+	if s == nil {
+		return false, errNoStream
+	}
+	if g == nil {
+		return false, nil
+	}
+	delete(s.groups, group)
+	k.wake(key)
+	return true, nil
+}
+
+// XGroupCreateConsumer: add consumer to group, reporting whether it did not
+// exist yet
+func (k *Kv) XGroupCreateConsumer(key, group, consumer string) (bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, g, err := k.xgroupLocked(key, group)
+	if err != nil {
+		return false, err
+	}
+	return g.createConsumer(consumer), nil
+}
+
+// XGroupDelConsumer: remove consumer from group, dropping its pending
+// entries. Returns the number of entries it had pending.
+func (k *Kv) XGroupDelConsumer(key, group, consumer string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, g, err := k.xgroupLocked(key, group)
+	if err != nil {
+		return 0, err
+	}
+	c, ok := g.consumers[consumer]
+	if !ok {
+		return 0, nil
+	}
+	for id := range c.pending {
+		delete(g.pending, id)
+	}
+	delete(g.consumers, consumer)
+	return len(c.pending), nil
+}
+
+// XReadGroupOpts holds the options of an XREADGROUP. For each of Keys, the
+// new entries of the stream are delivered when its ID is nil (">"), and
+// otherwise the entries pending for the consumer with greater IDs. NoAck
+// delivers new entries without adding them to the PEL.
+type XReadGroupOpts struct {
+	Keys  []string
+	IDs   []*StreamID
+	Count int // all when negative
+	NoAck bool
+}
+
+// XReadGroup: read entries from the streams at opts.Keys on behalf of
+// consumer, a member of group which is created if needed. New entries are
+// only returned for streams that have some, pending ones for every stream.
+func (k *Kv) XReadGroup(group, consumer string, opts XReadGroupOpts) ([]StreamRead, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	groups := make([]*ConsumerGroup, len(opts.Keys))
+	for i, key := range opts.Keys {
+		g, err := k.readGroupLocked(key, group)
+		if err != nil {
+			return nil, err
+		}
+		groups[i] = g
+	}
+	var reads []StreamRead
+	for i, key := range opts.Keys {
+		s := k.streams[key]
+		entries := s.deliver(groups[i], consumer, opts.IDs[i], opts.Count, opts.NoAck)
+		if len(entries) > 0 || opts.IDs[i] != nil {
+			reads = append(reads, StreamRead{Key: key, Entries: entries})
+		}
+	}
+	return reads, nil
+}
+
+// readGroupLocked returns group of the stream at key for XREADGROUP.
+// Callers must hold k.mu.
+func (k *Kv) readGroupLocked(key, group string) (*ConsumerGroup, error) {
+	_, g, err := k.groupLocked(key, group)
+	if err == nil && g == nil {
+		return nil, respErr(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group))
+	}
+	return g, err
+}
+
+// deliver returns up to count entries of s to consumer, a member of g: the
+// new entries when after is nil, adding them to the PEL unless noAck is set,
+// and otherwise the entries pending for the consumer with IDs greater than
+// after. Pending entries deleted from the stream have nil fields.
+func (s *Stream) deliver(g *ConsumerGroup, name string, after *StreamID, count int, noAck bool) []StreamEntry {
+	g.createConsumer(name)
+	c := g.consumers[name]
+	now := time.Now()
+	c.seenTime = now
+	if after != nil {
+		var entries []StreamEntry
+		for _, id := range pendingIDs(c.pending) {
+			if !after.Less(id) {
+				continue
+			}
+			if count >= 0 && len(entries) == count {
+				break
+			}
+			entry, ok := s.entry(id)
+			if !ok {
+				entry = StreamEntry{ID: id}
+			}
+			p := g.pending[id]
+			p.lastDelivered = now
+			p.deliveries++
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+	if g.lastID == maxStreamID {
+		return nil
+	}
+	entries := s.rangeEntries(g.lastID.next(), maxStreamID, count, false)
+	if len(entries) == 0 {
+		return nil
+	}
+	c.activeTime = now
+	g.lastID = entries[len(entries)-1].ID
+	if g.entriesRead >= 0 {
+		g.entriesRead += int64(len(entries))
+	}
+	if noAck {
+		return entries
+	}
+	for _, e := range entries {
+		// an entry delivered again after XGROUP SETID changes hands
+		if p, ok := g.pending[e.ID]; ok {
+			delete(g.consumers[p.consumer].pending, e.ID)
+		}
+		g.pending[e.ID] = &pendingEntry{consumer: name, lastDelivered: now, deliveries: 1}
+		c.pending[e.ID] = struct{}{}
+	}
+	return entries
+}
+
+// XAck: acknowledge the given entries of group, removing them from its PEL.
+// Returns the number of entries that were pending.
+func (k *Kv) XAck(key, group string, ids []StreamID) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, g, err := k.groupLocked(key, group)
+	if err != nil || g == nil {
+		return 0, err
+	}
+	n := 0
+	for _, id := range ids {
+		if g.ack(id) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// XClaimOpts holds the options of an XCLAIM. DeliveredAt sets the last
+// delivery time of the claimed entries (IDLE and TIME), now when zero, and
+// RetryCount their delivery count. Force claims entries that are not
+// pending yet and JustID claims entries without counting a delivery. The
+// last delivered ID of the group is raised to LastID.
+type XClaimOpts struct {
+	DeliveredAt time.Time
+	RetryCount  *int
+	Force       bool
+	JustID      bool
+	LastID      *StreamID
+}
+
+// errNoClaimGroup returns the error of XCLAIM and XAUTOCLAIM for a missing
+// key or group
+func errNoClaimGroup(key, group string) error {
+	return respErr(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, group))
+}
+
+// XClaim: hand the entries of group with the given IDs over to consumer,
+// for those that have been idle for at least minIdle. Returns the claimed
+// entries. Pending entries deleted from the stream are dropped from the PEL.
+func (k *Kv) XClaim(key, group, consumer string, minIdle time.Duration, ids []StreamID, opts XClaimOpts) ([]StreamEntry, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	s, g, err := k.groupLocked(key, group)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errNoClaimGroup(key, group)
+	}
+	if opts.LastID != nil && g.lastID.Less(*opts.LastID) {
+		g.lastID = *opts.LastID
+	}
+	g.createConsumer(consumer)
+	now := time.Now()
+	deliveredAt := opts.DeliveredAt
+	if deliveredAt.IsZero() {
+		deliveredAt = now
+	}
+	var claimed []StreamEntry
+	for _, id := range ids {
+		entry, exists := s.entry(id)
+		p, pending := g.pending[id]
+		if !exists {
+			g.ack(id)
+			continue
+		}
+		if !pending {
+			if !opts.Force {
+				continue
+			}
+			p = &pendingEntry{consumer: consumer}
+			g.pending[id] = p
+			g.consumers[consumer].pending[id] = struct{}{}
+		} else if now.Sub(p.lastDelivered) < minIdle {
+			continue
+		}
+		g.claim(id, consumer, deliveredAt, opts.JustID)
+		if opts.RetryCount != nil {
+			p.deliveries = *opts.RetryCount
+		}
+		claimed = append(claimed, entry)
+	}
+	c := g.consumers[consumer]
+	c.seenTime = now
+	if len(claimed) > 0 {
+		c.activeTime = now
+	}
+	return claimed, nil
+}
+
+// XAutoClaim: like XClaim, scanning the PEL of group from start for up to
+// count entries idle for at least minIdle, examining at most ten times as
+// many. Returns the ID to resume the scan from (0-0 once done), the claimed
+// entries and the IDs of pending entries that were deleted from the stream.
+func (k *Kv) XAutoClaim(key, group, consumer string, minIdle time.Duration, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	s, g, err := k.groupLocked(key, group)
+	if err != nil {
+		return StreamID{}, nil, nil, err
+	}
+	if g == nil {
+		return StreamID{}, nil, nil, errNoClaimGroup(key, group)
+	}
+	g.createConsumer(consumer)
+	now := time.Now()
+	var claimed []StreamEntry
+	var deleted []StreamID
+	ids := pendingIDs(g.pending)
+	i := sort.Search(len(ids), func(i int) bool { return !ids[i].Less(start) })
+	for attempts := count * 10; i < len(ids) && len(claimed) < count && attempts > 0; i, attempts = i+1, attempts-1 {
+		id := ids[i]
+		entry, exists := s.entry(id)
+		if !exists {
+			g.ack(id)
+			deleted = append(deleted, id)
+			continue
+		}
+		if now.Sub(g.pending[id].lastDelivered) < minIdle {
+			continue
+		}
+		g.claim(id, consumer, now, justID)
+		claimed = append(claimed, entry)
+	}
+	var next StreamID
+	if i < len(ids) {
+		next = ids[i]
+	}
+	c := g.consumers[consumer]
+	c.seenTime = now
+	if len(claimed) > 0 {
+		c.activeTime = now
+	}
+	return next, claimed, deleted, nil
+}
+
+// PendingSummary sums up the PEL of a group: the number of pending entries,
+// the lowest and highest pending IDs, and the number of entries pending for
+// each consumer that has some, by consumer name
+type PendingSummary struct {
+	Count       int
+	First, Last StreamID
+	Consumers   []ConsumerInfo
+}
+
+// XPendingSummary: sum up the PEL of group
+func (k *Kv) XPendingSummary(key, group string) (PendingSummary, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, g, err := k.groupLocked(key, group)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+	if g == nil {
+		return PendingSummary{}, errNoClaimGroup(key, group)
+	}
+	ids := pendingIDs(g.pending)
+	summary := PendingSummary{Count: len(ids)}
+	if len(ids) == 0 {
+		return summary, nil
+	}
+	summary.First, summary.Last = ids[0], ids[len(ids)-1]
+	for _, c := range g.consumerInfos(false, 0) {
+		if c.Pending > 0 {
+			summary.Consumers = append(summary.Consumers, c)
+		}
+	}
+	return summary, nil
+}
+
+// XPendingOpts selects pending entries for XPENDING: up to Count of those
+// with IDs between Start and End inclusive, idle for at least MinIdle, and
+// pending for Consumer unless it is empty
+type XPendingOpts struct {
+	Start, End StreamID
+	Count      int
+	MinIdle    time.Duration
+	Consumer   string
+}
+
+// XPending: list the pending entries of group selected by opts in ID order
+func (k *Kv) XPending(key, group string, opts XPendingOpts) ([]PendingInfo, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, g, err := k.groupLocked(key, group)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errNoClaimGroup(key, group)
+	}
+	var ids []StreamID
+	if opts.Consumer == "" {
+		ids = pendingIDs(g.pending)
+	} else if c, ok := g.consumers[opts.Consumer]; ok {
+		ids = pendingIDs(c.pending)
+	}
+	var selected []StreamID
+	for _, id := range ids {
+		if len(selected) == opts.Count {
+			break
+		}
+		if id.Less(opts.Start) || opts.End.Less(id) || time.Since(g.pending[id].lastDelivered) < opts.MinIdle {
+			continue
+		}
+		selected = append(selected, id)
+	}
+	return g.pendingInfo(selected, -1), nil
+}
+
+// Handlers for consumer group commands
+
+var xgroupHelp = []string{
+	"XGROUP <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CREATE <key> <groupname> <id|$> [option]",
+	"    Create a new consumer group. Options are:",
+	"    * MKSTREAM",
+	"      Create the empty stream if it does not exist.",
+	"    * ENTRIESREAD entries_read",
+	"      Set the group's entries_read counter (internal use).",
+	"CREATECONSUMER <key> <groupname> <consumer>",
+	"    Create a new consumer in the specified group.",
+	"DELCONSUMER <key> <groupname> <consumer>",
+	"    Remove the specified consumer.",
+	"DESTROY <key> <groupname>",
+	"    Remove the specified group.",
+	"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+	"    Set the current group ID and entries_read counter.",
+	"HELP",
+	"    Print this help.",
+}
+
+func xgroup(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("XGROUP requires a subcommand")
+	}
+	sub := strings.ToUpper(args[0])
+	var arity int
+	switch sub {
+	case "HELP":
+		if len(args) != 1 {
+			return nil, errors.New("XGROUP HELP takes no arguments")
+		}
+		return bulkArray(xgroupHelp), nil
+	case "DESTROY":
+		arity = 2
+	case "CREATE", "SETID", "CREATECONSUMER", "DELCONSUMER":
+		arity = 3
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try XGROUP HELP.", args[0])
+	}
+	// CREATE and SETID take options after their arguments
+	if n := len(args) - 1; n < arity || (n > arity && sub != "CREATE" && sub != "SETID") {
+		return nil, fmt.Errorf("wrong number of arguments for 'xgroup|%s' command", strings.ToLower(sub))
+	}
+	key, group := args[1], args[2]
+	switch sub {
+	case "CREATE", "SETID":
+		return xgroupSetID(sub, key, group, args[3], args[4:], kv)
+	case "DESTROY":
+		ok, err := kv.XGroupDestroy(key, group)
+		if err != nil {
+			return nil, err
+		}
+		return boolInt(ok), nil
+	case "CREATECONSUMER":
+		ok, err := kv.XGroupCreateConsumer(key, group, args[3])
+		if err != nil {
+			return nil, err
+		}
+		return boolInt(ok), nil
+	default:
+		n, err := kv.XGroupDelConsumer(key, group, args[3])
+		if err != nil {
+			return nil, err
+		}
+		return integer(n), nil
+	}
+}
+
+// xgroupSetID implements XGROUP CREATE and XGROUP SETID, which share the
+// last delivered ID argument and the ENTRIESREAD option
+func xgroupSetID(sub, key, group, idArg string, opts []string, kv *Kv) (RespValue, error) {
+	mkStream := false
+	entriesRead := int64(-1)
+	for i := 0; i < len(opts); i++ {
+		switch opt := strings.ToUpper(opts[i]); {
+		case opt == "MKSTREAM" && sub == "CREATE":
+			mkStream = true
+		case opt == "ENTRIESREAD" && i+1 < len(opts):
+			n, err := strconv.ParseInt(opts[i+1], 10, 64)
+			if err != nil {
+				return nil, errors.New("value is not an integer or out of range")
+			}
+			if n < 0 && n != -1 {
+				return nil, errors.New("value for ENTRIESREAD must be positive or -1")
+			}
+			entriesRead = n
+			i++
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	var id StreamID
+	var err error
+	if idArg == "$" {
+		// the group starts past the entries already in the stream
+		info, _, err := kv.XInfoStream(key, false, 0)
+		if err != nil {
+			return nil, err
+		}
+		if entriesRead == -1 {
+			entriesRead = info.EntriesAdded
+		}
+		id = info.LastID
+	} else if id, err = parseStreamID(idArg, 0); err != nil {
+		return nil, err
+	}
+	if sub == "CREATE" {
+		err = kv.XGroupCreate(key, group, id, mkStream, entriesRead)
+	} else {
+		err = kv.XGroupSetID(key, group, id, entriesRead)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return SimpleString("OK"), nil
+}
+
+func xreadgroup(args []string, kv *Kv) (RespValue, error) {
+	parsed, err := parseXReadArgs(args, true)
+	if err != nil {
+		return nil, err
+	}
+	opts := XReadGroupOpts{Keys: parsed.keys, IDs: make([]*StreamID, len(parsed.keys)), Count: parsed.count, NoAck: parsed.noAck}
+	history := false
+	for i, arg := range parsed.ids {
+		switch arg {
+		case ">":
+		case "$":
+			return nil, errors.New("The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		default:
+			id, err := parseStreamID(arg, 0)
+			if err != nil {
+				return nil, err
+			}
+			opts.IDs[i] = &id
+			history = true
+		}
+	}
+	reads, err := kv.XReadGroup(parsed.group, parsed.consumer, opts)
+	if err != nil {
+		return nil, err
+	}
+	// reading pending entries never blocks
+	if len(reads) > 0 || history {
+		return streamReadReply(reads), nil
+	}
+	if !parsed.blocking {
+		return nil, nil
+	}
+	// the client fails if the stream or the group goes away while it is
+	// blocked, rather than waiting on a group that can no longer be served
+	return kv.block(parsed.keys, "stream", parsed.timeout, func(key string) (RespValue, bool, error) {
+		s, ok := kv.streams[key]
+		if !ok {
+			return nil, false, errStreamDeleted
+		}
+		g, err := kv.readGroupLocked(key, parsed.group)
+		if err != nil {
+			return nil, false, err
+		}
+		entries := s.deliver(g, parsed.consumer, nil, parsed.count, parsed.noAck)
+		if len(entries) == 0 {
+			return nil, false, nil
+		}
+		return streamReadReply([]StreamRead{{Key: key, Entries: entries}}), true, nil
+	})
+}
+
+func xack(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("XACK requires at least three arguments")
+	}
+	ids := make([]StreamID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	n, err := kv.XAck(args[0], args[1], ids)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+// parseMinIdle parses the min-idle-time argument of XCLAIM and XAUTOCLAIM,
+// in milliseconds
+func parseMinIdle(s, cmd string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid min-idle-time argument for %s", cmd)
+	}
+	return time.Duration(max(ms, 0)) * time.Millisecond, nil
+}
+
+// claimReply formats claimed entries, as bare IDs when justID is set
+func claimReply(entries []StreamEntry, justID bool) Array {
+	if !justID {
+		return streamReply(entries)
+	}
+	respArray := make(Array, len(entries))
+	for i, e := range entries {
+		respArray[i] = BulkString(e.ID.String())
+	}
+	return respArray
+}
+
+func xclaim(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 5 {
+		return nil, errors.New("XCLAIM requires at least five arguments")
+	}
+	minIdle, err := parseMinIdle(args[3], "XCLAIM")
+	if err != nil {
+		return nil, err
+	}
+	// the IDs run until the first option
+	var ids []StreamID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := parseStreamID(args[i], 0)
+		if err != nil {
+			if i == 4 {
+				return nil, err
+			}
+			break
+		}
+		ids = append(ids, id)
+	}
+	var opts XClaimOpts
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "FORCE":
+			opts.Force = true
+		case opt == "JUSTID":
+			opts.JustID = true
+		case (opt == "IDLE" || opt == "TIME" || opt == "RETRYCOUNT") && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s option argument for XCLAIM", opt)
+			}
+			switch opt {
+			case "IDLE":
+				opts.DeliveredAt = time.Now().Add(-time.Duration(n) * time.Millisecond)
+			case "TIME":
+				opts.DeliveredAt = time.UnixMilli(n)
+			default:
+				retries := int(n)
+				opts.RetryCount = &retries
+			}
+			i++
+		case opt == "LASTID" && i+1 < len(args):
+			id, err := parseStreamID(args[i+1], 0)
+			if err != nil {
+				return nil, err
+			}
+			opts.LastID = &id
+			i++
+		default:
+			return nil, fmt.Errorf("Unrecognized XCLAIM option '%s'", args[i])
+		}
+	}
+	claimed, err := kv.XClaim(args[0], args[1], args[2], minIdle, ids, opts)
+	if err != nil {
+		return nil, err
+	}
+	return claimReply(claimed, opts.JustID), nil
+}
+
+func xautoclaim(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 5 {
+		return nil, errors.New("XAUTOCLAIM requires at least five arguments")
+	}
+	minIdle, err := parseMinIdle(args[3], "XAUTOCLAIM")
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseRangeID(args[4], false)
+	if err != nil {
+		return nil, err
+	}
+	count, justID := 100, false
+	for i := 5; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 || n > math.MaxInt32 {
+				return nil, errors.New("COUNT must be > 0")
+			}
+			count = n
+			i++
+		case opt == "JUSTID":
+			justID = true
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	next, claimed, deleted, err := kv.XAutoClaim(args[0], args[1], args[2], minIdle, start, count, justID)
+	if err != nil {
+		return nil, err
+	}
+	deletedIDs := make(Array, len(deleted))
+	for i, id := range deleted {
+		deletedIDs[i] = BulkString(id.String())
+	}
+	return Array{BulkString(next.String()), claimReply(claimed, justID), deletedIDs}, nil
+}
+
+func xpending(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("XPENDING requires at least two arguments")
+	}
+	key, group := args[0], args[1]
+	if len(args) == 2 {
+		summary, err := kv.XPendingSummary(key, group)
+		if err != nil {
+			return nil, err
+		}
+		if summary.Count == 0 {
+			return Array{integer(0), nil, nil, nil}, nil
+		}
+		consumers := make(Array, len(summary.Consumers))
+		for i, c := range summary.Consumers {
+			consumers[i] = Array{BulkString(c.Name), BulkString(strconv.Itoa(c.Pending))}
+		}
+		return Array{
+			integer(summary.Count),
+			BulkString(summary.First.String()),
+			BulkString(summary.Last.String()),
+			consumers,
+		}, nil
+	}
+
+	var opts XPendingOpts
+	rest := args[2:]
+	if strings.EqualFold(rest[0], "IDLE") {
+		if len(rest) < 2 {
+			return nil, errors.New("syntax error")
+		}
+		minIdle, err := parseMinIdle(rest[1], "XPENDING")
+		if err != nil {
+			return nil, err
+		}
+		opts.MinIdle = minIdle
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return nil, errors.New("syntax error")
+	}
+	var err error
+	if opts.Start, err = parseRangeID(rest[0], false); err != nil {
+		return nil, err
+	}
+	if opts.End, err = parseRangeID(rest[1], true); err != nil {
+		return nil, err
+	}
+	if opts.Count, err = strconv.Atoi(rest[2]); err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	// a negative count selects nothing
+	opts.Count = max(opts.Count, 0)
+	if len(rest) == 4 {
+		opts.Consumer = rest[3]
+	}
+	pending, err := kv.XPending(key, group, opts)
+	if err != nil {
+		return nil, err
+	}
+	respArray := make(Array, len(pending))
+	for i, p := range pending {
+		respArray[i] = Array{
+			BulkString(p.ID.String()),
+			BulkString(p.Consumer),
+			integer(time.Since(p.LastDelivered).Milliseconds()),
+			integer(p.Deliveries),
+		}
+	}
+	return respArray, nil
+}
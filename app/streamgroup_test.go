@@ -0,0 +1,456 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXGroupCreate(t *testing.T) {
+	kv := NewKv()
+	if _, err := xgroup([]string{"CREATE", "s", "g", "$"}, kv); err != errNoStream {
+		t.Fatalf("XGROUP CREATE on missing key = %v, want errNoStream", err)
+	}
+	resp, err := xgroup([]string{"CREATE", "s", "g", "$", "MKSTREAM"}, kv)
+	if err != nil || resp != SimpleString("OK") || kv.Type("s") != "stream" {
+		t.Fatalf("XGROUP CREATE MKSTREAM = %v, %v", resp, err)
+	}
+	if _, err := xgroup([]string{"CREATE", "s", "g", "0"}, kv); err == nil || err.Error()[:9] != "BUSYGROUP" {
+		t.Fatalf("XGROUP CREATE of existing group = %v, want BUSYGROUP", err)
+	}
+	xadd([]string{"s", "1-0", "f", "v"}, kv)
+	xadd([]string{"s", "2-0", "f", "v"}, kv)
+	xgroup([]string{"CREATE", "s", "late", "$"}, kv)
+	xgroup([]string{"CREATE", "s", "early", "0", "ENTRIESREAD", "0"}, kv)
+
+	resp, _ = xinfo([]string{"GROUPS", "s"}, kv)
+	groups := resp.(Array)
+	if len(groups) != 3 {
+		t.Fatalf("XINFO GROUPS = %v, want 3 groups", groups)
+	}
+	for i, want := range []struct {
+		name, last string
+		read       RespValue
+		lag        integer
+	}{
+		{"early", "0-0", integer(0), 2},
+		{"g", "0-0", integer(0), 2},
+		{"late", "2-0", integer(2), 0},
+	} {
+		g := groups[i].(Array)
+		if infoField(t, g, "name") != BulkString(want.name) || infoField(t, g, "last-delivered-id") != BulkString(want.last) ||
+			infoField(t, g, "entries-read") != want.read || infoField(t, g, "lag") != want.lag {
+			t.Fatalf("XINFO GROUPS entry %d = %v, want %+v", i, g, want)
+		}
+	}
+	if resp, _ := xinfo([]string{"STREAM", "s"}, kv); infoField(t, resp.(Array), "groups") != integer(3) {
+		t.Fatalf("XINFO STREAM groups = %v, want 3", infoField(t, resp.(Array), "groups"))
+	}
+}
+
+func TestXGroupSetIDAndDestroy(t *testing.T) {
+	kv := NewKv()
+	xadd([]string{"s", "1-0", "f", "v"}, kv)
+	xgroup([]string{"CREATE", "s", "g", "0"}, kv)
+	if resp, err := xgroup([]string{"SETID", "s", "g", "$"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("XGROUP SETID = %v, %v", resp, err)
+	}
+	if g := kv.streams["s"].groups["g"]; g.lastID != (StreamID{1, 0}) || g.entriesRead != 1 {
+		t.Fatalf("group after SETID $ = %+v", g)
+	}
+	if _, err := xgroup([]string{"SETID", "s", "missing", "0"}, kv); err == nil {
+		t.Fatalf("expected NOGROUP error for XGROUP SETID")
+	}
+	if _, err := xgroup([]string{"SETID", "s", "g", "0", "MKSTREAM"}, kv); err == nil {
+		t.Fatalf("expected error for XGROUP SETID MKSTREAM")
+	}
+	if resp, _ := xgroup([]string{"DESTROY", "s", "g"}, kv); resp != integer(1) {
+		t.Fatalf("XGROUP DESTROY = %v, want 1", resp)
+	}
+	if resp, _ := xgroup([]string{"DESTROY", "s", "g"}, kv); resp != integer(0) {
+		t.Fatalf("XGROUP DESTROY of missing group = %v, want 0", resp)
+	}
+}
+
+func TestXGroupConsumers(t *testing.T) {
+	kv := NewKv()
+	xgroup([]string{"CREATE", "s", "g", "$", "MKSTREAM"}, kv)
+	if resp, _ := xgroup([]string{"CREATECONSUMER", "s", "g", "alice"}, kv); resp != integer(1) {
+		t.Fatalf("XGROUP CREATECONSUMER = %v, want 1", resp)
+	}
+	if resp, _ := xgroup([]string{"CREATECONSUMER", "s", "g", "alice"}, kv); resp != integer(0) {
+		t.Fatalf("XGROUP CREATECONSUMER of existing consumer = %v, want 0", resp)
+	}
+	xgroup([]string{"CREATECONSUMER", "s", "g", "bob"}, kv)
+
+	// give bob a pending entry
+	g := kv.streams["s"].groups["g"]
+	g.pending[StreamID{1, 0}] = &pendingEntry{consumer: "bob", deliveries: 1}
+	g.consumers["bob"].pending[StreamID{1, 0}] = struct{}{}
+
+	resp, _ := xinfo([]string{"CONSUMERS", "s", "g"}, kv)
+	consumers := resp.(Array)
+	if len(consumers) != 2 || infoField(t, consumers[1].(Array), "pending") != integer(1) || infoField(t, consumers[0].(Array), "inactive") != integer(-1) {
+		t.Fatalf("XINFO CONSUMERS = %v", consumers)
+	}
+	resp, _ = xinfo([]string{"STREAM", "s", "FULL"}, kv)
+	full := infoField(t, resp.(Array), "groups").(Array)[0].(Array)
+	if infoField(t, full, "pel-count") != integer(1) || len(infoField(t, full, "consumers").(Array)) != 2 {
+		t.Fatalf("XINFO STREAM FULL group = %v", full)
+	}
+
+	if resp, _ := xgroup([]string{"DELCONSUMER", "s", "g", "bob"}, kv); resp != integer(1) {
+		t.Fatalf("XGROUP DELCONSUMER = %v, want 1", resp)
+	}
+	if len(g.pending) != 0 || len(g.consumers) != 1 {
+		t.Fatalf("group after DELCONSUMER has %d pending and %d consumers", len(g.pending), len(g.consumers))
+	}
+	if resp, _ := xgroup([]string{"DELCONSUMER", "s", "g", "bob"}, kv); resp != integer(0) {
+		t.Fatalf("XGROUP DELCONSUMER of missing consumer = %v, want 0", resp)
+	}
+	for _, args := range [][]string{
+		{"CREATECONSUMER", "s", "missing", "c"},
+		{"DELCONSUMER", "s", "g"},
+		{"DESTROY", "s", "g", "extra"},
+		{"BOGUS", "s", "g"},
+	} {
+		if _, err := xgroup(args, kv); err == nil {
+			t.Fatalf("expected error for XGROUP %v", args)
+		}
+	}
+}
+
+func TestXGroupCopyAndDump(t *testing.T) {
+	kv := NewKv()
+	xadd([]string{"s", "1-0", "f", "v"}, kv)
+	xgroup([]string{"CREATE", "s", "g", "0"}, kv)
+	xgroup([]string{"CREATECONSUMER", "s", "g", "alice"}, kv)
+	g := kv.streams["s"].groups["g"]
+	g.pending[StreamID{1, 0}] = &pendingEntry{consumer: "alice", deliveries: 2}
+	g.consumers["alice"].pending[StreamID{1, 0}] = struct{}{}
+
+	kv.Copy("s", "copy", false)
+	payload, _ := kv.Dump("s")
+	if err := kv.Restore("restored", 0, payload, false); err != nil {
+		t.Fatalf("Restore error: %v", err)
+	}
+	// the copies are independent of the original
+	g.pending[StreamID{1, 0}].deliveries = 5
+	for _, key := range []string{"copy", "restored"} {
+		c := kv.streams[key].groups["g"]
+		if p := c.pending[StreamID{1, 0}]; p == nil || p.consumer != "alice" || p.deliveries != 2 {
+			t.Fatalf("pending entry of %s = %+v", key, p)
+		}
+		if _, ok := c.consumers["alice"].pending[StreamID{1, 0}]; !ok {
+			t.Fatalf("consumer PEL of %s lost its entry", key)
+		}
+	}
+}
+
+// readIDs returns the entry IDs of each stream of an XREAD or XREADGROUP
+// reply, by key
+func readIDs(resp RespValue) map[string][]string {
+	ids := make(map[string][]string)
+	arr, _ := resp.(Array)
+	for _, read := range arr {
+		key := string(read.(Array)[0].(BulkString))
+		ids[key] = []string{}
+		for _, e := range read.(Array)[1].(Array) {
+			ids[key] = append(ids[key], string(e.(Array)[0].(BulkString)))
+		}
+	}
+	return ids
+}
+
+func TestXReadGroup(t *testing.T) {
+	kv := NewKv()
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		xadd([]string{"s", id, "f", id}, kv)
+	}
+	xgroup([]string{"CREATE", "s", "g", "0"}, kv)
+
+	resp, err := xreadgroup([]string{"GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">"}, kv)
+	if err != nil {
+		t.Fatalf("XREADGROUP error: %v", err)
+	}
+	if got := readIDs(resp)["s"]; !equalStrings(got, []string{"1-0", "2-0"}) {
+		t.Fatalf("XREADGROUP alice = %v, want [1-0 2-0]", got)
+	}
+	resp, _ = xreadgroup([]string{"GROUP", "g", "bob", "STREAMS", "s", ">"}, kv)
+	if got := readIDs(resp)["s"]; !equalStrings(got, []string{"3-0"}) {
+		t.Fatalf("XREADGROUP bob = %v, want [3-0]", got)
+	}
+	if resp, _ := xreadgroup([]string{"GROUP", "g", "bob", "STREAMS", "s", ">"}, kv); resp != nil {
+		t.Fatalf("XREADGROUP with nothing new = %v, want nil", resp)
+	}
+
+	// reading the history returns the consumer's pending entries again
+	resp, _ = xreadgroup([]string{"GROUP", "g", "alice", "STREAMS", "s", "0"}, kv)
+	if got := readIDs(resp)["s"]; !equalStrings(got, []string{"1-0", "2-0"}) {
+		t.Fatalf("XREADGROUP alice history = %v, want [1-0 2-0]", got)
+	}
+	if p := kv.streams["s"].groups["g"].pending[StreamID{1, 0}]; p.deliveries != 2 || p.consumer != "alice" {
+		t.Fatalf("pending entry after history read = %+v", p)
+	}
+
+	if resp, err := xack([]string{"s", "g", "1-0", "3-0", "9-0"}, kv); err != nil || resp != integer(2) {
+		t.Fatalf("XACK = %v, %v; want 2", resp, err)
+	}
+	resp, _ = xreadgroup([]string{"GROUP", "g", "alice", "STREAMS", "s", "0"}, kv)
+	if got := readIDs(resp)["s"]; !equalStrings(got, []string{"2-0"}) {
+		t.Fatalf("XREADGROUP alice history after XACK = %v, want [2-0]", got)
+	}
+	// a deleted pending entry is returned without fields
+	xdel([]string{"s", "2-0"}, kv)
+	resp, _ = xreadgroup([]string{"GROUP", "g", "alice", "STREAMS", "s", "0"}, kv)
+	if entry := resp.(Array)[0].(Array)[1].(Array)[0].(Array); entry[1] != nil {
+		t.Fatalf("deleted pending entry = %v, want nil fields", entry)
+	}
+	if resp, _ := xack([]string{"s", "missing", "2-0"}, kv); resp != integer(0) {
+		t.Fatalf("XACK of missing group = %v, want 0", resp)
+	}
+	resp, _ = xinfo([]string{"GROUPS", "s"}, kv)
+	if g := resp.(Array)[0].(Array); infoField(t, g, "pending") != integer(1) || infoField(t, g, "consumers") != integer(2) || infoField(t, g, "lag") != integer(0) {
+		t.Fatalf("XINFO GROUPS after reads = %v", g)
+	}
+}
+
+func TestXReadGroupNoAck(t *testing.T) {
+	kv := NewKv()
+	xadd([]string{"s", "1-0", "f", "v"}, kv)
+	xgroup([]string{"CREATE", "s", "g", "0"}, kv)
+	resp, _ := xreadgroup([]string{"GROUP", "g", "c", "NOACK", "STREAMS", "s", ">"}, kv)
+	if got := readIDs(resp)["s"]; !equalStrings(got, []string{"1-0"}) {
+		t.Fatalf("XREADGROUP NOACK = %v, want [1-0]", got)
+	}
+	if n := len(kv.streams["s"].groups["g"].pending); n != 0 {
+		t.Fatalf("NOACK left %d pending entries", n)
+	}
+	for _, args := range [][]string{
+		{"STREAMS", "s", ">"},
+		{"GROUP", "missing", "c", "STREAMS", "s", ">"},
+		{"GROUP", "g", "c", "STREAMS", "nosuchkey", ">"},
+		{"GROUP", "g", "c", "STREAMS", "s", "$"},
+		{"GROUP", "g", "c", "STREAMS", "s"},
+	} {
+		if _, err := xreadgroup(args, kv); err == nil {
+			t.Fatalf("expected error for XREADGROUP %v", args)
+		}
+	}
+}
+
+func TestXReadGroupBlock(t *testing.T) {
+	kv := NewKv()
+	xgroup([]string{"CREATE", "s", "g", "$", "MKSTREAM"}, kv)
+	done := make(chan RespValue, 1)
+	go func() {
+		resp, _ := xreadgroup([]string{"GROUP", "g", "c", "BLOCK", "0", "STREAMS", "s", ">"}, kv)
+		done <- resp
+	}()
+	waitBlocked(t, kv, "s", 1)
+	xadd([]string{"s", "1-0", "f", "v"}, kv)
+	if got := readIDs(<-done)["s"]; !equalStrings(got, []string{"1-0"}) {
+		t.Fatalf("XREADGROUP BLOCK = %v, want [1-0]", got)
+	}
+	if _, ok := kv.streams["s"].groups["g"].pending[StreamID{1, 0}]; !ok {
+		t.Fatalf("entry delivered to a blocked consumer is not pending")
+	}
+	if resp, _ := xreadgroup([]string{"GROUP", "g", "c", "BLOCK", "10", "STREAMS", "s", ">"}, kv); resp != nil {
+		t.Fatalf("XREADGROUP BLOCK timeout = %v, want nil", resp)
+	}
+}
+
+func TestXReadGroupBlockUnblocked(t *testing.T) {
+	kv := NewKv()
+	xgroup([]string{"CREATE", "s", "g", "$", "MKSTREAM"}, kv)
+	block := func() chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := xreadgroup([]string{"GROUP", "g", "c", "BLOCK", "0", "STREAMS", "s", ">"}, kv)
+			done <- err
+		}()
+		waitBlocked(t, kv, "s", 1)
+		return done
+	}
+	// blocked clients fail when their group is destroyed, or the stream
+	// deleted, instead of blocking forever
+	done := block()
+	xgroup([]string{"DESTROY", "s", "g"}, kv)
+	if err := <-done; err == nil || !strings.HasPrefix(err.Error(), "NOGROUP") {
+		t.Fatalf("XREADGROUP after XGROUP DESTROY = %v, want NOGROUP", err)
+	}
+	xgroup([]string{"CREATE", "s", "g", "$"}, kv)
+	done = block()
+	kv.Del([]string{"s"})
+	if err := <-done; err != errStreamDeleted {
+		t.Fatalf("XREADGROUP after DEL = %v, want %v", err, errStreamDeleted)
+	}
+	xgroup([]string{"CREATE", "s", "g", "$", "MKSTREAM"}, kv)
+	done = block()
+	kv.FlushDB()
+	if err := <-done; err != errStreamDeleted {
+		t.Fatalf("XREADGROUP after FLUSHDB = %v, want %v", err, errStreamDeleted)
+	}
+}
+
+// pendingFixture returns a stream with entries 1-0 to 4-0 delivered to
+// alice, the first two a minute ago
+func pendingFixture(t *testing.T) (*Kv, *ConsumerGroup) {
+	t.Helper()
+	kv := NewKv()
+	for _, id := range []string{"1-0", "2-0", "3-0", "4-0"} {
+		xadd([]string{"s", id, "f", id}, kv)
+	}
+	xgroup([]string{"CREATE", "s", "g", "0"}, kv)
+	xreadgroup([]string{"GROUP", "g", "alice", "STREAMS", "s", ">"}, kv)
+	g := kv.streams["s"].groups["g"]
+	for _, id := range []StreamID{{1, 0}, {2, 0}} {
+		g.pending[id].lastDelivered = time.Now().Add(-time.Minute)
+	}
+	return kv, g
+}
+
+func TestXClaim(t *testing.T) {
+	kv, g := pendingFixture(t)
+	resp, err := xclaim([]string{"s", "g", "bob", "30000", "1-0", "2-0", "3-0", "9-0"}, kv)
+	if err != nil {
+		t.Fatalf("XCLAIM error: %v", err)
+	}
+	if arr := resp.(Array); len(arr) != 2 || arr[0].(Array)[0] != BulkString("1-0") || arr[1].(Array)[0] != BulkString("2-0") {
+		t.Fatalf("XCLAIM = %v, want entries 1-0 and 2-0", arr)
+	}
+	if p := g.pending[StreamID{1, 0}]; p.consumer != "bob" || p.deliveries != 2 || time.Since(p.lastDelivered) > time.Second {
+		t.Fatalf("claimed entry = %+v", p)
+	}
+	if len(g.consumers["alice"].pending) != 2 || len(g.consumers["bob"].pending) != 2 {
+		t.Fatalf("consumer PELs after XCLAIM: alice %d, bob %d", len(g.consumers["alice"].pending), len(g.consumers["bob"].pending))
+	}
+
+	resp, _ = xclaim([]string{"s", "g", "carol", "0", "3-0", "JUSTID", "RETRYCOUNT", "7", "IDLE", "5000"}, kv)
+	if arr := resp.(Array); len(arr) != 1 || arr[0] != BulkString("3-0") {
+		t.Fatalf("XCLAIM JUSTID = %v, want [3-0]", arr)
+	}
+	if p := g.pending[StreamID{3, 0}]; p.consumer != "carol" || p.deliveries != 7 || time.Since(p.lastDelivered) < 5*time.Second {
+		t.Fatalf("entry claimed with options = %+v", p)
+	}
+
+	// FORCE claims entries that are not pending, LASTID raises the group ID
+	xack([]string{"s", "g", "4-0"}, kv)
+	xclaim([]string{"s", "g", "dave", "0", "4-0", "FORCE", "LASTID", "9-0"}, kv)
+	if p := g.pending[StreamID{4, 0}]; p == nil || p.consumer != "dave" || p.deliveries != 1 {
+		t.Fatalf("entry claimed with FORCE = %+v", p)
+	}
+	if g.lastID != (StreamID{9, 0}) {
+		t.Fatalf("group last ID = %v, want 9-0", g.lastID)
+	}
+
+	// claiming a deleted entry drops it from the PEL
+	xdel([]string{"s", "1-0"}, kv)
+	if resp, _ := xclaim([]string{"s", "g", "bob", "0", "1-0"}, kv); len(resp.(Array)) != 0 {
+		t.Fatalf("XCLAIM of deleted entry = %v, want empty", resp)
+	}
+	if _, ok := g.pending[StreamID{1, 0}]; ok {
+		t.Fatalf("deleted entry still pending")
+	}
+	for _, args := range [][]string{
+		{"s", "missing", "c", "0", "1-0"},
+		{"s", "g", "c", "x", "1-0"},
+		{"s", "g", "c", "0", "bad"},
+		{"s", "g", "c", "0", "1-0", "BOGUS"},
+		{"s", "g", "c", "0", "1-0", "IDLE", "x"},
+	} {
+		if _, err := xclaim(args, kv); err == nil {
+			t.Fatalf("expected error for XCLAIM %v", args)
+		}
+	}
+}
+
+func TestXAutoClaim(t *testing.T) {
+	kv, g := pendingFixture(t)
+	resp, err := xautoclaim([]string{"s", "g", "bob", "30000", "0", "COUNT", "1"}, kv)
+	if err != nil {
+		t.Fatalf("XAUTOCLAIM error: %v", err)
+	}
+	arr := resp.(Array)
+	if arr[0] != BulkString("2-0") || len(arr[1].(Array)) != 1 || arr[1].(Array)[0].(Array)[0] != BulkString("1-0") {
+		t.Fatalf("XAUTOCLAIM COUNT 1 = %v, want cursor 2-0 and entry 1-0", arr)
+	}
+	xdel([]string{"s", "2-0"}, kv)
+	resp, _ = xautoclaim([]string{"s", "g", "bob", "30000", "2-0", "JUSTID"}, kv)
+	arr = resp.(Array)
+	if arr[0] != BulkString("0-0") || len(arr[1].(Array)) != 0 || len(arr[2].(Array)) != 1 || arr[2].(Array)[0] != BulkString("2-0") {
+		t.Fatalf("XAUTOCLAIM over a deleted entry = %v", arr)
+	}
+	resp, _ = xautoclaim([]string{"s", "g", "bob", "0", "-", "JUSTID"}, kv)
+	if ids := resp.(Array)[1].(Array); len(ids) != 3 || ids[0] != BulkString("1-0") {
+		t.Fatalf("XAUTOCLAIM JUSTID = %v, want [1-0 3-0 4-0]", ids)
+	}
+	// JUSTID does not count a delivery
+	if p := g.pending[StreamID{3, 0}]; p.consumer != "bob" || p.deliveries != 1 {
+		t.Fatalf("entry claimed with JUSTID = %+v", p)
+	}
+	for _, args := range [][]string{
+		{"s", "missing", "c", "0", "0"},
+		{"s", "g", "c", "0", "0", "COUNT", "0"},
+		{"s", "g", "c", "0", "bad"},
+	} {
+		if _, err := xautoclaim(args, kv); err == nil {
+			t.Fatalf("expected error for XAUTOCLAIM %v", args)
+		}
+	}
+}
+
+func TestXPending(t *testing.T) {
+	kv, _ := pendingFixture(t)
+	// bob reads without acknowledging
+	xadd([]string{"s", "5-0", "f", "v"}, kv)
+	xreadgroup([]string{"GROUP", "g", "bob", "STREAMS", "s", ">"}, kv)
+
+	resp, err := xpending([]string{"s", "g"}, kv)
+	if err != nil {
+		t.Fatalf("XPENDING error: %v", err)
+	}
+	summary := resp.(Array)
+	if summary[0] != integer(5) || summary[1] != BulkString("1-0") || summary[2] != BulkString("5-0") {
+		t.Fatalf("XPENDING summary = %v", summary)
+	}
+	consumers := summary[3].(Array)
+	if len(consumers) != 2 || consumers[0].(Array)[1] != BulkString("4") || consumers[1].(Array)[0] != BulkString("bob") {
+		t.Fatalf("XPENDING consumers = %v", consumers)
+	}
+
+	resp, _ = xpending([]string{"s", "g", "-", "+", "10"}, kv)
+	if arr := resp.(Array); len(arr) != 5 {
+		t.Fatalf("XPENDING - + 10 = %v, want 5 entries", arr)
+	}
+	resp, _ = xpending([]string{"s", "g", "IDLE", "30000", "-", "+", "10", "alice"}, kv)
+	arr := resp.(Array)
+	if len(arr) != 2 {
+		t.Fatalf("XPENDING IDLE 30000 = %v, want 2 entries", arr)
+	}
+	if entry := arr[0].(Array); entry[0] != BulkString("1-0") || entry[1] != BulkString("alice") || entry[2].(integer) < 60000 || entry[3] != integer(1) {
+		t.Fatalf("XPENDING entry = %v", entry)
+	}
+	resp, _ = xpending([]string{"s", "g", "(1-0", "4", "2", "alice"}, kv)
+	if arr := resp.(Array); len(arr) != 2 || arr[0].(Array)[0] != BulkString("2-0") {
+		t.Fatalf("XPENDING (1-0 4 2 alice = %v, want [2-0 3-0]", arr)
+	}
+	if resp, _ := xpending([]string{"s", "g", "-", "+", "10", "nobody"}, kv); len(resp.(Array)) != 0 {
+		t.Fatalf("XPENDING of unknown consumer = %v, want empty", resp)
+	}
+
+	xgroup([]string{"CREATE", "s", "empty", "$"}, kv)
+	if resp, _ := xpending([]string{"s", "empty"}, kv); resp.(Array)[0] != integer(0) || resp.(Array)[1] != nil {
+		t.Fatalf("XPENDING of empty group = %v", resp)
+	}
+	for _, args := range [][]string{
+		{"s", "missing"},
+		{"s", "g", "-", "+"},
+		{"s", "g", "-", "+", "x"},
+		{"s", "g", "IDLE", "x", "-", "+", "1"},
+	} {
+		if _, err := xpending(args, kv); err == nil {
+			t.Fatalf("expected error for XPENDING %v", args)
+		}
+	}
+}
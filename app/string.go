@@ -0,0 +1,483 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// string operations
+
+// getLocked returns the string stored at key, dropping it first if it has
+// expired, and records the access when it exists. Callers must hold k.mu.
+func (k *Kv) getLocked(key string) (string, bool) {
+	k.expireLocked(key)
+	val, ok := k.data[key]
+	if ok {
+		k.accessed[key] = time.Now()
+	}
+	return val, ok
+}
+
+// setLocked stores value at key, replacing whatever the key held before along
+// with its TTL. Callers must hold k.mu.
+func (k *Kv) setLocked(key, value string) {
+	k.deleteLocked(key)
+	k.data[key] = value
+	k.accessed[key] = time.Now()
+}
+
+// SetNX: set key to value only if the key does not exist. Reports whether
+// it was set.
+func (k *Kv) SetNX(key, value string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.typeOf(key) != "none" {
+		return false
+	}
+	k.setLocked(key, value)
+	return true
+}
+
+// IncrBy: add delta to the integer stored at key, starting from 0 if the key
+// does not exist. Returns the new value.
+func (k *Kv) IncrBy(key string, delta int64) (int64, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return 0, err
+	}
+	var cur int64
+	if v, ok := k.getLocked(key); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, errors.New("value is not an integer or out of range")
+		}
+		cur = n
+	}
+	if (delta > 0 && cur > math.MaxInt64-delta) || (delta < 0 && cur < math.MinInt64-delta) {
+		return 0, errors.New("increment or decrement would overflow")
+	}
+	cur += delta
+	// the TTL of an existing key is kept
+	k.data[key] = strconv.FormatInt(cur, 10)
+	return cur, nil
+}
+
+// Append: append value to the string stored at key, creating it if needed.
+// Returns the length of the resulting string.
+func (k *Kv) Append(key, value string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return 0, err
+	}
+	cur, _ := k.getLocked(key)
+	cur += value
+	k.data[key] = cur
+	return len(cur), nil
+}
+
+// GetSet: set key to value, clearing its TTL, and return the previous value
+func (k *Kv) GetSet(key, value string) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return "", false, err
+	}
+	old, ok := k.getLocked(key)
+	k.data[key] = value
+	delete(k.exp, key)
+	return old, ok, nil
+}
+
+// MSet: set each key-value pair of pairs (key, value, key, value, ...)
+func (k *Kv) MSet(pairs []string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		k.setLocked(pairs[i], pairs[i+1])
+	}
+}
+
+// MSetNX: like MSet, but only when none of the keys exist. Reports whether
+// the pairs were set.
+func (k *Kv) MSetNX(pairs []string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i := 0; i < len(pairs); i += 2 {
+		if k.typeOf(pairs[i]) != "none" {
+			return false
+		}
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		k.setLocked(pairs[i], pairs[i+1])
+	}
+	return true
+}
+
+// MGet: get the values of several keys. Each element is the value as a
+// string, or nil when the key is missing or does not hold a string.
+func (k *Kv) MGet(keys []string) []interface{} {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	vals := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if v, ok := k.getLocked(key); ok {
+			vals[i] = v
+		}
+	}
+	return vals
+}
+
+// TTLOption describes how a command changes the expiry of a key. The zero
+// value leaves it unchanged.
+type TTLOption struct {
+	// At is the new absolute expiry time, used when not zero
+	At time.Time
+	// Persist removes the expiry
+	Persist bool
+}
+
+// GetEx: get the string stored at key and update its expiry according to
+// opt. An expiry time that has already passed deletes the key.
+func (k *Kv) GetEx(key string, opt TTLOption) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return "", false, err
+	}
+	val, ok := k.getLocked(key)
+	if !ok {
+		return "", false, nil
+	}
+	switch {
+	case opt.Persist:
+		delete(k.exp, key)
+	case !opt.At.IsZero():
+		if !opt.At.After(time.Now()) {
+			k.deleteLocked(key)
+		} else {
+			k.exp[key] = opt.At
+		}
+	}
+	return val, true, nil
+}
+
+// GetDel: get the string stored at key and delete the key
+func (k *Kv) GetDel(key string) (string, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return "", false, err
+	}
+	val, ok := k.getLocked(key)
+	if ok {
+		k.deleteLocked(key)
+	}
+	return val, ok, nil
+}
+
+// maxStringLen is the largest string SETRANGE may create (512MB, as Redis)
+const maxStringLen = 512 * 1024 * 1024
+
+// GetRange: get the bytes of the string stored at key between offsets start
+// and end (inclusive, negative offsets count from the end)
+func (k *Kv) GetRange(key string, start, end int) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return "", err
+	}
+	val, _ := k.getLocked(key)
+	start, end, ok := clampRange(len(val), start, end)
+	if !ok {
+		return "", nil
+	}
+	return val[start : end+1], nil
+}
+
+// SetRange: overwrite the string stored at key with value from offset on,
+// padding it with zero bytes if it is shorter than offset. Returns the length
+// of the resulting string.
+func (k *Kv) SetRange(key string, offset int, value string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "string"); err != nil {
+		return 0, err
+	}
+	cur, _ := k.getLocked(key)
+	if value == "" {
+		// nothing to write, and a missing key is not created
+		return len(cur), nil
+	}
+	if offset > maxStringLen-len(value) {
+		return 0, errors.New("string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	buf := []byte(cur)
+	if need := offset + len(value); need > len(buf) {
+		buf = append(buf, make([]byte, need-len(buf))...)
+	}
+	copy(buf[offset:], value)
+	k.data[key] = string(buf)
+	return len(buf), nil
+}
+
+// Handlers for string commands
+
+func setnx(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("SETNX requires exactly two arguments")
+	}
+	return boolInt(kv.SetNX(args[0], args[1])), nil
+}
+
+func setex(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("SETEX requires exactly three arguments")
+	}
+	return setWithUnit(args, kv, time.Second, "setex")
+}
+
+func psetex(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("PSETEX requires exactly three arguments")
+	}
+	return setWithUnit(args, kv, time.Millisecond, "psetex")
+}
+
+// setWithUnit implements SETEX and PSETEX: key ttl value, with ttl counted
+// in unit
+func setWithUnit(args []string, kv *Kv, unit time.Duration, cmd string) (RespValue, error) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	if n <= 0 || n > math.MaxInt64/int64(unit) {
+		return nil, fmt.Errorf("invalid expire time in '%s' command", cmd)
+	}
+	kv.SetWithTTL(args[0], args[2], time.Duration(n)*unit)
+	return SimpleString("OK"), nil
+}
+
+func incr(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("INCR requires exactly one argument")
+	}
+	return incrBy(kv, args[0], 1)
+}
+
+func decr(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("DECR requires exactly one argument")
+	}
+	return incrBy(kv, args[0], -1)
+}
+
+func incrby(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("INCRBY requires exactly two arguments")
+	}
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	return incrBy(kv, args[0], delta)
+}
+
+func decrby(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("DECRBY requires exactly two arguments")
+	}
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	if delta == math.MinInt64 {
+		return nil, errors.New("decrement would overflow")
+	}
+	return incrBy(kv, args[0], -delta)
+}
+
+func incrBy(kv *Kv, key string, delta int64) (RespValue, error) {
+	n, err := kv.IncrBy(key, delta)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func appendCmd(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("APPEND requires exactly two arguments")
+	}
+	n, err := kv.Append(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func getset(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("GETSET requires exactly two arguments")
+	}
+	old, ok, err := kv.GetSet(args[0], args[1])
+	if err != nil || !ok {
+		return nil, err
+	}
+	return BulkString(old), nil
+}
+
+func mset(args []string, kv *Kv) (RespValue, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, errors.New("MSET requires key-value pairs")
+	}
+	kv.MSet(args)
+	return SimpleString("OK"), nil
+}
+
+func msetnx(args []string, kv *Kv) (RespValue, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, errors.New("MSETNX requires key-value pairs")
+	}
+	return boolInt(kv.MSetNX(args)), nil
+}
+
+func mget(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("MGET requires at least one argument")
+	}
+	vals := kv.MGet(args)
+	respArray := make(Array, len(vals))
+	for i, v := range vals {
+		if v != nil {
+			respArray[i] = BulkString(v.(string))
+		}
+	}
+	return respArray, nil
+}
+
+// parseExpireTime converts the argument of an EX, PX, EXAT or PXAT option to
+// an absolute expiry time
+func parseExpireTime(option, arg, cmd string) (time.Time, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("value is not an integer or out of range")
+	}
+	invalid := fmt.Errorf("invalid expire time in '%s' command", cmd)
+	if n <= 0 {
+		return time.Time{}, invalid
+	}
+	switch option {
+	case "EX":
+		if n > math.MaxInt64/int64(time.Second) {
+			return time.Time{}, invalid
+		}
+		return time.Now().Add(time.Duration(n) * time.Second), nil
+	case "PX":
+		if n > math.MaxInt64/int64(time.Millisecond) {
+			return time.Time{}, invalid
+		}
+		return time.Now().Add(time.Duration(n) * time.Millisecond), nil
+	case "EXAT":
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, invalid
+		}
+		return time.Unix(n, 0), nil
+	default: // PXAT
+		return time.UnixMilli(n), nil
+	}
+}
+
+// parseTTLOption parses "[EX seconds | PX ms | EXAT unix-seconds |
+// PXAT unix-ms | PERSIST]"
+func parseTTLOption(args []string, cmd string) (TTLOption, error) {
+	var opt TTLOption
+	if len(args) == 0 {
+		return opt, nil
+	}
+	option := strings.ToUpper(args[0])
+	switch option {
+	case "PERSIST":
+		if len(args) != 1 {
+			return opt, errors.New("syntax error")
+		}
+		opt.Persist = true
+	case "EX", "PX", "EXAT", "PXAT":
+		if len(args) != 2 {
+			return opt, errors.New("syntax error")
+		}
+		at, err := parseExpireTime(option, args[1], cmd)
+		if err != nil {
+			return opt, err
+		}
+		opt.At = at
+	default:
+		return opt, errors.New("syntax error")
+	}
+	return opt, nil
+}
+
+func getex(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("GETEX requires at least one argument")
+	}
+	opt, err := parseTTLOption(args[1:], "getex")
+	if err != nil {
+		return nil, err
+	}
+	val, ok, err := kv.GetEx(args[0], opt)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return BulkString(val), nil
+}
+
+func getdel(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("GETDEL requires exactly one argument")
+	}
+	val, ok, err := kv.GetDel(args[0])
+	if err != nil || !ok {
+		return nil, err
+	}
+	return BulkString(val), nil
+}
+
+func getrange(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("GETRANGE requires exactly three arguments")
+	}
+	start, err1 := strconv.Atoi(args[1])
+	end, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	val, err := kv.GetRange(args[0], start, end)
+	if err != nil {
+		return nil, err
+	}
+	return BulkString(val), nil
+}
+
+func setrange(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("SETRANGE requires exactly three arguments")
+	}
+	offset, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return nil, errors.New("offset is out of range")
+	}
+	n, err := kv.SetRange(args[0], offset, args[2])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIncrBy(t *testing.T) {
+	kv := NewKv()
+	if n, err := kv.IncrBy("counter", 1); err != nil || n != 1 {
+		t.Fatalf("IncrBy on missing key = %d, %v; want 1", n, err)
+	}
+	if n, _ := kv.IncrBy("counter", -5); n != -4 {
+		t.Fatalf("IncrBy -5 = %d, want -4", n)
+	}
+	if val, _, _ := kv.Get("counter"); val != "-4" {
+		t.Fatalf("stored value = %q, want -4", val)
+	}
+	kv.Set("text", "abc")
+	if _, err := kv.IncrBy("text", 1); err == nil {
+		t.Fatalf("expected error incrementing a non-integer")
+	}
+	kv.Set("big", strconv.FormatInt(1<<62, 10))
+	if _, err := kv.IncrBy("big", 1<<62); err == nil {
+		t.Fatalf("expected overflow error")
+	}
+	kv.RPush("list", "x")
+	if _, err := kv.IncrBy("list", 1); !errors.Is(err, errWrongType) {
+		t.Fatalf("IncrBy on list err = %v, want WRONGTYPE", err)
+	}
+}
+
+func TestIncrKeepsTTL(t *testing.T) {
+	kv := NewKv()
+	kv.SetWithTTL("k", "10", time.Hour)
+	kv.IncrBy("k", 1)
+	if _, ok := kv.exp["k"]; !ok {
+		t.Fatalf("expected INCR to keep the TTL")
+	}
+	kv.SetWithTTL("old", "10", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	// an expired key counts as missing
+	if n, _ := kv.IncrBy("old", 1); n != 1 {
+		t.Fatalf("IncrBy on expired key = %d, want 1", n)
+	}
+}
+
+func TestIncrDecrHandlers(t *testing.T) {
+	kv := NewKv()
+	incr([]string{"n"}, kv)
+	incrby([]string{"n", "10"}, kv)
+	decr([]string{"n"}, kv)
+	resp, err := decrby([]string{"n", "3"}, kv)
+	if err != nil || resp != integer(7) {
+		t.Fatalf("DECRBY reply = %v, %v; want 7", resp, err)
+	}
+	if _, err := incrby([]string{"n", "1.5"}, kv); err == nil {
+		t.Fatalf("expected error for non-integer increment")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	kv := NewKv()
+	if n, err := kv.Append("log", "hello"); err != nil || n != 5 {
+		t.Fatalf("Append on missing key = %d, %v; want 5", n, err)
+	}
+	if n, _ := kv.Append("log", " world"); n != 11 {
+		t.Fatalf("Append = %d, want 11", n)
+	}
+	if val, _, _ := kv.Get("log"); val != "hello world" {
+		t.Fatalf("stored value = %q, want %q", val, "hello world")
+	}
+	resp, err := appendCmd([]string{"log", "!"}, kv)
+	if err != nil || resp != integer(12) {
+		t.Fatalf("APPEND reply = %v, %v; want 12", resp, err)
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	kv := NewKv()
+	if old, ok, err := kv.GetSet("k", "v1"); err != nil || ok {
+		t.Fatalf("GetSet on missing key = %q, %v, %v; want no old value", old, ok, err)
+	}
+	if old, ok, _ := kv.GetSet("k", "v2"); !ok || old != "v1" {
+		t.Fatalf("GetSet = %q, %v; want v1", old, ok)
+	}
+	if val, _, _ := kv.Get("k"); val != "v2" {
+		t.Fatalf("stored value = %q, want v2", val)
+	}
+
+	kv.SetWithTTL("ttl", "old", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	resp, err := getset([]string{"ttl", "new"}, kv)
+	if err != nil || resp != nil {
+		t.Fatalf("GETSET on expired key = %v, %v; want nil", resp, err)
+	}
+	if val, ok, _ := kv.Get("ttl"); !ok || val != "new" {
+		t.Fatalf("expected expired key to be set to new, got %q, %v", val, ok)
+	}
+	if _, ok := kv.exp["ttl"]; ok {
+		t.Fatalf("expected GETSET to clear the TTL")
+	}
+}
+
+func TestMSetMGet(t *testing.T) {
+	kv := NewKv()
+	kv.SetWithTTL("a", "old", time.Hour)
+	kv.RPush("list", "x")
+	if resp, err := mset([]string{"a", "1", "b", "2", "list", "3"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("MSET reply = %v, %v; want OK", resp, err)
+	}
+	if _, ok := kv.exp["a"]; ok {
+		t.Fatalf("expected MSET to clear the TTL")
+	}
+	kv.SetWithTTL("gone", "x", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	got := kv.MGet([]string{"a", "missing", "list", "gone", "b"})
+	want := []interface{}{"1", nil, "3", nil, "2"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("MGet = %v, want %v", got, want)
+		}
+	}
+	if _, err := mset([]string{"a", "1", "b"}, kv); err == nil {
+		t.Fatalf("expected error for odd number of arguments")
+	}
+	resp, _ := mget([]string{"b", "missing"}, kv)
+	if arr := resp.(Array); arr[0] != BulkString("2") || arr[1] != nil {
+		t.Fatalf("MGET reply = %v", resp)
+	}
+}
+
+func TestMSetNX(t *testing.T) {
+	kv := NewKv()
+	if !kv.MSetNX([]string{"a", "1", "b", "2"}) {
+		t.Fatalf("expected MSetNX on new keys to succeed")
+	}
+	kv.SAdd("set", "m")
+	// one existing key (of any type) prevents all of them from being set
+	resp, err := msetnx([]string{"c", "3", "a", "x", "d", "4"}, kv)
+	if err != nil || resp != integer(0) {
+		t.Fatalf("MSETNX reply = %v, %v; want 0", resp, err)
+	}
+	if resp, _ := msetnx([]string{"e", "5", "set", "x"}, kv); resp != integer(0) {
+		t.Fatalf("MSETNX over a set reply = %v, want 0", resp)
+	}
+	for _, key := range []string{"c", "d", "e"} {
+		if _, ok, _ := kv.Get(key); ok {
+			t.Fatalf("expected %q not to be set", key)
+		}
+	}
+	if val, _, _ := kv.Get("a"); val != "1" {
+		t.Fatalf("a = %q, want 1", val)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	kv := NewKv()
+	if resp, _ := setnx([]string{"k", "v1"}, kv); resp != integer(1) {
+		t.Fatalf("SETNX on new key = %v, want 1", resp)
+	}
+	if resp, _ := setnx([]string{"k", "v2"}, kv); resp != integer(0) {
+		t.Fatalf("SETNX on existing key = %v, want 0", resp)
+	}
+	if val, _, _ := kv.Get("k"); val != "v1" {
+		t.Fatalf("k = %q, want v1", val)
+	}
+}
+
+func TestSetEx(t *testing.T) {
+	kv := NewKv()
+	if resp, err := setex([]string{"k", "10", "v"}, kv); err != nil || resp != SimpleString("OK") {
+		t.Fatalf("SETEX reply = %v, %v; want OK", resp, err)
+	}
+	if ttl := time.Until(kv.exp["k"]); ttl <= 9*time.Second || ttl > 10*time.Second {
+		t.Fatalf("SETEX ttl = %v, want about 10s", ttl)
+	}
+	psetex([]string{"p", "1500", "v"}, kv)
+	if ttl := time.Until(kv.exp["p"]); ttl <= time.Second || ttl > 1500*time.Millisecond {
+		t.Fatalf("PSETEX ttl = %v, want about 1.5s", ttl)
+	}
+	for _, ttl := range []string{"0", "-5"} {
+		if _, err := setex([]string{"k", ttl, "v"}, kv); err == nil {
+			t.Fatalf("expected error for SETEX ttl %s", ttl)
+		}
+		if _, err := psetex([]string{"k", ttl, "v"}, kv); err == nil {
+			t.Fatalf("expected error for PSETEX ttl %s", ttl)
+		}
+	}
+}
+
+func TestGetEx(t *testing.T) {
+	kv := NewKv()
+	kv.Set("k", "v")
+	resp, err := getex([]string{"k", "EX", "100"}, kv)
+	if err != nil || resp != BulkString("v") {
+		t.Fatalf("GETEX reply = %v, %v; want v", resp, err)
+	}
+	if ttl := time.Until(kv.exp["k"]); ttl <= 99*time.Second || ttl > 100*time.Second {
+		t.Fatalf("GETEX EX ttl = %v, want about 100s", ttl)
+	}
+	// no option leaves the TTL alone
+	getex([]string{"k"}, kv)
+	if _, ok := kv.exp["k"]; !ok {
+		t.Fatalf("expected GETEX without options to keep the TTL")
+	}
+	getex([]string{"k", "PERSIST"}, kv)
+	if _, ok := kv.exp["k"]; ok {
+		t.Fatalf("expected GETEX PERSIST to remove the TTL")
+	}
+
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	getex([]string{"k", "EXAT", strconv.FormatInt(at.Unix(), 10)}, kv)
+	if !kv.exp["k"].Equal(at) {
+		t.Fatalf("GETEX EXAT expiry = %v, want %v", kv.exp["k"], at)
+	}
+	at = time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	getex([]string{"k", "PXAT", strconv.FormatInt(at.UnixMilli(), 10)}, kv)
+	if !kv.exp["k"].Equal(at) {
+		t.Fatalf("GETEX PXAT expiry = %v, want %v", kv.exp["k"], at)
+	}
+
+	// a timestamp in the past deletes the key after returning it
+	if val, ok, _ := kv.GetEx("k", TTLOption{At: time.Now().Add(-time.Second)}); !ok || val != "v" {
+		t.Fatalf("GetEx = %q, %v; want v", val, ok)
+	}
+	if _, ok, _ := kv.Get("k"); ok {
+		t.Fatalf("expected key to be deleted")
+	}
+	if resp, err := getex([]string{"missing", "PERSIST"}, kv); resp != nil || err != nil {
+		t.Fatalf("GETEX on missing key = %v, %v; want nil", resp, err)
+	}
+	for _, args := range [][]string{{"k", "EX"}, {"k", "EX", "0"}, {"k", "PERSIST", "EX", "5"}, {"k", "KEEPTTL"}} {
+		if _, err := getex(args, kv); err == nil {
+			t.Fatalf("expected error for GETEX %v", args)
+		}
+	}
+}
+
+func TestGetDel(t *testing.T) {
+	kv := NewKv()
+	kv.SetWithTTL("k", "v", time.Hour)
+	resp, err := getdel([]string{"k"}, kv)
+	if err != nil || resp != BulkString("v") {
+		t.Fatalf("GETDEL reply = %v, %v; want v", resp, err)
+	}
+	if _, ok, _ := kv.Get("k"); ok {
+		t.Fatalf("expected key to be deleted")
+	}
+	if _, ok := kv.exp["k"]; ok {
+		t.Fatalf("expected expiry to be deleted")
+	}
+	if resp, err := getdel([]string{"k"}, kv); resp != nil || err != nil {
+		t.Fatalf("GETDEL on missing key = %v, %v; want nil", resp, err)
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	kv := NewKv()
+	kv.Set("k", "This is a string")
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{-100, 3, "This"},
+		{5, 2, ""},
+		{20, 30, ""},
+	}
+	for _, tt := range tests {
+		if got, _ := kv.GetRange("k", tt.start, tt.end); got != tt.want {
+			t.Fatalf("GetRange(%d, %d) = %q, want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+	if got, err := kv.GetRange("missing", 0, -1); err != nil || got != "" {
+		t.Fatalf("GetRange on missing key = %q, %v; want empty", got, err)
+	}
+}
+
+func TestSetRange(t *testing.T) {
+	kv := NewKv()
+	kv.Set("k", "Hello World")
+	if n, err := kv.SetRange("k", 6, "Redis"); err != nil || n != 11 {
+		t.Fatalf("SetRange = %d, %v; want 11", n, err)
+	}
+	if val, _, _ := kv.Get("k"); val != "Hello Redis" {
+		t.Fatalf("k = %q, want %q", val, "Hello Redis")
+	}
+	// a missing key is zero-padded up to offset
+	if n, _ := kv.SetRange("pad", 3, "ab"); n != 5 {
+		t.Fatalf("SetRange on missing key = %d, want 5", n)
+	}
+	if val, _, _ := kv.Get("pad"); val != "\x00\x00\x00ab" {
+		t.Fatalf("pad = %q", val)
+	}
+	if n, _ := kv.SetRange("empty", 10, ""); n != 0 {
+		t.Fatalf("SetRange with empty value = %d, want 0", n)
+	}
+	if _, ok, _ := kv.Get("empty"); ok {
+		t.Fatalf("expected empty SETRANGE not to create the key")
+	}
+	if _, err := setrange([]string{"k", "-1", "x"}, kv); err == nil {
+		t.Fatalf("expected error for negative offset")
+	}
+	if _, err := kv.SetRange("k", maxStringLen, "x"); err == nil {
+		t.Fatalf("expected error for oversized string")
+	}
+	// the offset must not overflow the size check
+	if _, err := setrange([]string{"k", "9223372036854775807", "x"}, kv); err == nil {
+		t.Fatalf("expected error for huge offset")
+	}
+}
@@ -0,0 +1,1346 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// zsetEntry is a sorted set member along with its score
+type zsetEntry struct {
+	score  float64
+	member string
+}
+
+// SortedSet holds the members of a sorted set with their scores, plus an
+// index of all entries kept ordered by score, then member.
+type SortedSet struct {
+	members map[string]float64
+	index   []zsetEntry
+}
+
+// constructor function for SortedSet
+func NewSortedSet() *SortedSet {
+	return &SortedSet{members: make(map[string]float64)}
+}
+
+// Clone returns a deep copy of z
+func (z *SortedSet) Clone() *SortedSet {
+	c := &SortedSet{
+		members: make(map[string]float64, len(z.members)),
+		index:   append([]zsetEntry(nil), z.index...),
+	}
+	for m, score := range z.members {
+		c.members[m] = score
+	}
+	return c
+}
+
+// entryLess orders entries by score, ties being broken lexicographically
+func entryLess(a, b zsetEntry) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.member < b.member
+}
+
+// search returns the position of e in the index, or where it would be
+// inserted
+func (z *SortedSet) search(e zsetEntry) int {
+	return sort.Search(len(z.index), func(i int) bool { return !entryLess(z.index[i], e) })
+}
+
+// Len returns the number of members
+func (z *SortedSet) Len() int {
+	return len(z.index)
+}
+
+// Add sets the score of member, moving it within the index if it already
+// exists. Reports whether member was newly added.
+func (z *SortedSet) Add(member string, score float64) bool {
+	old, exists := z.members[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		z.Remove(member)
+	}
+	e := zsetEntry{score: score, member: member}
+	i := z.search(e)
+	z.index = append(z.index, zsetEntry{})
+	copy(z.index[i+1:], z.index[i:])
+	z.index[i] = e
+	z.members[member] = score
+	return !exists
+}
+
+// Remove deletes member, reporting whether it was present
+func (z *SortedSet) Remove(member string) bool {
+	score, ok := z.members[member]
+	if !ok {
+		return false
+	}
+	i := z.search(zsetEntry{score: score, member: member})
+	z.index = append(z.index[:i], z.index[i+1:]...)
+	delete(z.members, member)
+	return true
+}
+
+// Rank returns the zero-based position of member in ascending score order
+func (z *SortedSet) Rank(member string) (int, bool) {
+	score, ok := z.members[member]
+	if !ok {
+		return 0, false
+	}
+	return z.search(zsetEntry{score: score, member: member}), true
+}
+
+// scoreSpan returns the index positions [lo, hi) of the entries whose score
+// lies between min and max, each bound being exclusive when the matching
+// flag is set
+func (z *SortedSet) scoreSpan(min, max float64, minEx, maxEx bool) (int, int) {
+	lo := sort.Search(len(z.index), func(i int) bool {
+		if minEx {
+			return z.index[i].score > min
+		}
+		return z.index[i].score >= min
+	})
+	hi := sort.Search(len(z.index), func(i int) bool {
+		if maxEx {
+			return z.index[i].score >= max
+		}
+		return z.index[i].score > max
+	})
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// slice copies the entries of the index positions [lo, hi), walking them
+// from the highest position down when rev is set
+func (z *SortedSet) slice(lo, hi int, rev bool) []zsetEntry {
+	out := make([]zsetEntry, hi-lo)
+	for i := range out {
+		if rev {
+			out[i] = z.index[hi-1-i]
+		} else {
+			out[i] = z.index[lo+i]
+		}
+	}
+	return out
+}
+
+// rankRange returns the entries within the inclusive, possibly negative,
+// rank range [start, stop]. Ranks count from the highest score when rev is
+// set.
+func (z *SortedSet) rankRange(start, stop int, rev bool) []zsetEntry {
+	n := z.Len()
+	start, stop, ok := clampRange(n, start, stop)
+	if !ok {
+		return nil
+	}
+	if rev {
+		return z.slice(n-1-stop, n-start, true)
+	}
+	return z.slice(start, stop+1, false)
+}
+
+// scoreRange returns the entries with a score between min and max, in
+// descending order when rev is set, skipping offset of them and returning
+// at most count (all when count is negative)
+func (z *SortedSet) scoreRange(min, max float64, minEx, maxEx, rev bool, offset, count int) []zsetEntry {
+	lo, hi := z.scoreSpan(min, max, minEx, maxEx)
+	return z.window(lo, hi, rev, offset, count)
+}
+
+// window returns the entries of the index positions [lo, hi), in descending
+// order when rev is set, skipping offset of them and returning at most count
+// (all when count is negative)
+func (z *SortedSet) window(lo, hi int, rev bool, offset, count int) []zsetEntry {
+	if hi-lo <= offset {
+		return nil
+	}
+	// offset and count apply in iteration order
+	if rev {
+		hi -= offset
+		if count >= 0 && hi-count > lo {
+			lo = hi - count
+		}
+	} else {
+		lo += offset
+		if count >= 0 && count < hi-lo {
+			hi = lo + count
+		}
+	}
+	return z.slice(lo, hi, rev)
+}
+
+// pop removes and returns up to count entries with the lowest scores, or
+// the highest ones when max is set, in pop order
+func (z *SortedSet) pop(count int, max bool) []zsetEntry {
+	if count > z.Len() {
+		count = z.Len()
+	}
+	var out []zsetEntry
+	if max {
+		out = z.slice(z.Len()-count, z.Len(), true)
+		z.index = z.index[:z.Len()-count]
+	} else {
+		out = z.slice(0, count, false)
+		z.index = z.index[count:]
+	}
+	for _, e := range out {
+		delete(z.members, e.member)
+	}
+	return out
+}
+
+// lexBound is a ZRANGEBYLEX style bound: "-" and "+" are the lowest and
+// highest possible strings, "[value" is inclusive and "(value" exclusive
+type lexBound struct {
+	value     string
+	exclusive bool
+	inf       int // -1 for "-", 1 for "+", 0 otherwise
+}
+
+// parseLexBound parses a lexicographic range bound
+func parseLexBound(s string) (lexBound, error) {
+	switch {
+	case s == "-":
+		return lexBound{inf: -1}, nil
+	case s == "+":
+		return lexBound{inf: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, nil
+	}
+	return lexBound{}, errors.New("min or max not valid string range item")
+}
+
+// lexSpan returns the index positions [lo, hi) of the entries whose member
+// lies between min and max. It assumes all members share the same score, as
+// lexicographic ranges are only meaningful then.
+func (z *SortedSet) lexSpan(min, max lexBound) (int, int) {
+	// above reports whether member is past bound b: at or after it for an
+	// inclusive lower bound or strictly after an inclusive upper bound,
+	// and the other way round for exclusive ones
+	above := func(member string, b lexBound, lower bool) bool {
+		switch {
+		case b.inf < 0:
+			return true
+		case b.inf > 0:
+			return false
+		case b.exclusive == lower:
+			return member > b.value
+		}
+		return member >= b.value
+	}
+	lo := sort.Search(len(z.index), func(i int) bool { return above(z.index[i].member, min, true) })
+	hi := sort.Search(len(z.index), func(i int) bool { return above(z.index[i].member, max, false) })
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// ZAddOpts holds the ZADD flags
+type ZAddOpts struct {
+	NX bool // only add new members
+	XX bool // only update existing members
+	GT bool // only update when the new score is greater
+	LT bool // only update when the new score is lower
+	CH bool // count changed members instead of only added ones
+}
+
+// sorted set operations:
+// ZAdd: add entries to the sorted set stored at key, or update their score.
+// Returns the number of added members (or changed ones with CH).
+func (k *Kv) ZAdd(key string, opts ZAddOpts, entries ...zsetEntry) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		z = NewSortedSet()
+	}
+	changed := 0
+	for _, e := range entries {
+		old, exists := z.members[e.member]
+		if (opts.NX && exists) || (opts.XX && !exists) {
+			continue
+		}
+		if exists && ((opts.GT && e.score <= old) || (opts.LT && e.score >= old)) {
+			continue
+		}
+		if z.Add(e.member, e.score) || (opts.CH && old != e.score) {
+			changed++
+		}
+	}
+	if z.Len() > 0 {
+		k.zsets[key] = z
+		k.wake(key)
+	}
+	return changed, nil
+}
+
+// ZRange: get the entries of the sorted set stored at key within the
+// inclusive, possibly negative, rank range [start, stop]
+func (k *Kv) ZRange(key string, start, stop int) ([]zsetEntry, error) {
+	return k.zrangeByRank(key, start, stop, false)
+}
+
+// ZRevRange: get the entries within the rank range [start, stop], ranks
+// counting from the highest score
+func (k *Kv) ZRevRange(key string, start, stop int) ([]zsetEntry, error) {
+	return k.zrangeByRank(key, start, stop, true)
+}
+
+func (k *Kv) zrangeByRank(key string, start, stop int, rev bool) ([]zsetEntry, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return nil, nil
+	}
+	return z.rankRange(start, stop, rev), nil
+}
+
+// ZRem: remove members from the sorted set stored at key, deleting the key
+// once it is empty. Returns the number of removed members.
+func (k *Kv) ZRem(key string, members ...string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return 0, nil
+	}
+	removed := 0
+	for _, m := range members {
+		if z.Remove(m) {
+			removed++
+		}
+	}
+	if z.Len() == 0 {
+		k.deleteLocked(key)
+	}
+	return removed, nil
+}
+
+// ZCard: get the number of members of the sorted set stored at key
+func (k *Kv) ZCard(key string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, err
+	}
+	if z, ok := k.zsets[key]; ok {
+		return z.Len(), nil
+	}
+	return 0, nil
+}
+
+// ZIncrBy: add delta to the score of member, which starts at 0 when it does
+// not exist yet. Returns the new score.
+func (k *Kv) ZIncrBy(key, member string, delta float64) (float64, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		z = NewSortedSet()
+		k.zsets[key] = z
+	}
+	score := z.members[member] + delta
+	if math.IsNaN(score) {
+		if z.Len() == 0 {
+			k.deleteLocked(key)
+		}
+		return 0, errors.New("resulting score is not a number (NaN)")
+	}
+	// Add re-splices the member at its new position in the index
+	z.Add(member, score)
+	k.wake(key)
+	return score, nil
+}
+
+// ZScore: get the score of member in the sorted set stored at key
+func (k *Kv) ZScore(key, member string) (float64, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, false, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return 0, false, nil
+	}
+	score, ok := z.members[member]
+	return score, ok, nil
+}
+
+// ZMScore: get the scores of several members, nil for missing ones
+func (k *Kv) ZMScore(key string, members []string) ([]*float64, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+	scores := make([]*float64, len(members))
+	z, ok := k.zsets[key]
+	if !ok {
+		return scores, nil
+	}
+	for i, m := range members {
+		if score, ok := z.members[m]; ok {
+			scores[i] = &score
+		}
+	}
+	return scores, nil
+}
+
+// ZScan: iterate the sorted set stored at key in score order, the cursor
+// being an offset into the sorted index. Returns the next cursor (0 when
+// done) and a flat member, score... slice of the members matching match
+// (if not empty).
+func (k *Kv) ZScan(key string, cursor int, match string, count int) (int, []string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, nil, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return 0, nil, nil
+	}
+	next, lo, hi := scanBounds(z.Len(), cursor, count)
+	out := make([]string, 0, 2*(hi-lo))
+	for _, e := range z.index[lo:hi] {
+		if match == "" || globMatch(match, e.member) {
+			out = append(out, e.member, formatFloat(e.score))
+		}
+	}
+	return next, out, nil
+}
+
+// ZRank: get the rank of member in ascending score order
+func (k *Kv) ZRank(key, member string) (int, bool, error) {
+	rank, _, ok, err := k.zrank(key, member, false)
+	return rank, ok, err
+}
+
+// ZRevRank: get the rank of member in descending score order
+func (k *Kv) ZRevRank(key, member string) (int, bool, error) {
+	rank, _, ok, err := k.zrank(key, member, true)
+	return rank, ok, err
+}
+
+// zrank returns the rank of member, in descending order when rev is set,
+// along with its score
+func (k *Kv) zrank(key, member string, rev bool) (int, float64, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, 0, false, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return 0, 0, false, nil
+	}
+	rank, ok := z.Rank(member)
+	if ok && rev {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, z.members[member], ok, nil
+}
+
+// ZCount: count the members with a score between min and max
+func (k *Kv) ZCount(key string, min, max float64, minEx, maxEx bool) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return 0, nil
+	}
+	lo, hi := z.scoreSpan(min, max, minEx, maxEx)
+	return hi - lo, nil
+}
+
+// ZRangeByScore: get the entries with a score between min and max in
+// ascending order, skipping offset of them and returning at most count
+// (all when count is negative)
+func (k *Kv) ZRangeByScore(key string, min, max float64, minEx, maxEx bool, offset, count int) ([]zsetEntry, error) {
+	return k.zrangeByScore(key, min, max, minEx, maxEx, false, offset, count)
+}
+
+// ZRevRangeByScore: like ZRangeByScore, in descending score order
+func (k *Kv) ZRevRangeByScore(key string, min, max float64, minEx, maxEx bool, offset, count int) ([]zsetEntry, error) {
+	return k.zrangeByScore(key, min, max, minEx, maxEx, true, offset, count)
+}
+
+func (k *Kv) zrangeByScore(key string, min, max float64, minEx, maxEx, rev bool, offset, count int) ([]zsetEntry, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return nil, nil
+	}
+	return z.scoreRange(min, max, minEx, maxEx, rev, offset, count), nil
+}
+
+// ZRangeByLex: get the entries whose member lies between min and max, for a
+// sorted set where all members have the same score
+func (k *Kv) ZRangeByLex(key string, min, max lexBound, offset, count int) ([]zsetEntry, error) {
+	return k.zrangeByLex(key, min, max, false, offset, count)
+}
+
+// ZRevRangeByLex: like ZRangeByLex, in descending order
+func (k *Kv) ZRevRangeByLex(key string, min, max lexBound, offset, count int) ([]zsetEntry, error) {
+	return k.zrangeByLex(key, min, max, true, offset, count)
+}
+
+func (k *Kv) zrangeByLex(key string, min, max lexBound, rev bool, offset, count int) ([]zsetEntry, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return nil, nil
+	}
+	lo, hi := z.lexSpan(min, max)
+	return z.window(lo, hi, rev, offset, count), nil
+}
+
+// ZLexCount: count the members between min and max
+func (k *Kv) ZLexCount(key string, min, max lexBound) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return 0, err
+	}
+	z, ok := k.zsets[key]
+	if !ok {
+		return 0, nil
+	}
+	lo, hi := z.lexSpan(min, max)
+	return hi - lo, nil
+}
+
+// ZPopMin: remove and return up to count members with the lowest scores
+func (k *Kv) ZPopMin(key string, count int) ([]zsetEntry, error) {
+	return k.zpop(key, count, false)
+}
+
+// ZPopMax: remove and return up to count members with the highest scores
+func (k *Kv) ZPopMax(key string, count int) ([]zsetEntry, error) {
+	return k.zpop(key, count, true)
+}
+
+func (k *Kv) zpop(key string, count int, max bool) ([]zsetEntry, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkType(key, "zset"); err != nil {
+		return nil, err
+	}
+	return k.zpopLocked(key, count, max), nil
+}
+
+// zpopLocked pops from the sorted set at key, deleting the key once it is
+// empty. Callers must hold k.mu.
+func (k *Kv) zpopLocked(key string, count int, max bool) []zsetEntry {
+	z, ok := k.zsets[key]
+	if !ok {
+		return nil
+	}
+	out := z.pop(count, max)
+	if z.Len() == 0 {
+		k.deleteLocked(key)
+	}
+	return out
+}
+
+// ZUnionStore: store in dst the union of the sorted sets at keys, each
+// score being multiplied by the weight of its set (1 when weights is nil)
+// and combined with agg ("SUM", "MIN" or "MAX"). Returns the cardinality of
+// the result.
+func (k *Kv) ZUnionStore(dst string, keys []string, weights []float64, agg string) (int, error) {
+	return k.zsetAlgebraStore(dst, keys, weights, agg, false)
+}
+
+// ZInterStore: like ZUnionStore, keeping only the members present in every
+// sorted set
+func (k *Kv) ZInterStore(dst string, keys []string, weights []float64, agg string) (int, error) {
+	return k.zsetAlgebraStore(dst, keys, weights, agg, true)
+}
+
+func (k *Kv) zsetAlgebraStore(dst string, keys []string, weights []float64, agg string, inter bool) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	scores, err := k.zsetSourcesLocked(keys)
+	if err != nil {
+		return 0, err
+	}
+	res := combineScores(scores, weights, agg, inter)
+	return k.storeZsetLocked(dst, res), nil
+}
+
+// ZDiffStore: store in dst the members of the first sorted set that are in
+// none of the others, keeping their scores. Returns the cardinality of the
+// result.
+func (k *Kv) ZDiffStore(dst string, keys []string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	scores, err := k.zsetSourcesLocked(keys)
+	if err != nil {
+		return 0, err
+	}
+	res := make(map[string]float64)
+	for m, score := range scores[0] {
+		res[m] = score
+	}
+	for _, set := range scores[1:] {
+		for m := range set {
+			delete(res, m)
+		}
+	}
+	return k.storeZsetLocked(dst, res), nil
+}
+
+// ZInterCard: count the members of the intersection of the sorted sets at
+// keys, stopping once limit is reached (0 = no limit)
+func (k *Kv) ZInterCard(keys []string, limit int) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	scores, err := k.zsetSourcesLocked(keys)
+	if err != nil {
+		return 0, err
+	}
+	smallest := scores[0]
+	for _, set := range scores[1:] {
+		if len(set) < len(smallest) {
+			smallest = set
+		}
+	}
+	count := 0
+	for m := range smallest {
+		inAll := true
+		for _, set := range scores {
+			if _, ok := set[m]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if !inAll {
+			continue
+		}
+		count++
+		if limit > 0 && count >= limit {
+			break
+		}
+	}
+	return count, nil
+}
+
+// zsetSourcesLocked returns the member scores of each key, which may hold a
+// sorted set or a plain set (whose members all score 1). Missing keys are
+// empty. Callers must hold k.mu.
+func (k *Kv) zsetSourcesLocked(keys []string) ([]map[string]float64, error) {
+	scores := make([]map[string]float64, len(keys))
+	for i, key := range keys {
+		switch k.typeOf(key) {
+		case "zset":
+			scores[i] = k.zsets[key].members
+		case "set":
+			scores[i] = make(map[string]float64, len(k.sets[key]))
+			for m := range k.sets[key] {
+				scores[i][m] = 1
+			}
+		case "none":
+			scores[i] = map[string]float64{}
+		default:
+			return nil, errWrongType
+		}
+	}
+	return scores, nil
+}
+
+// combineScores merges the member scores of several sets, weighting them and
+// aggregating with agg. With inter set only the members of all sets are kept.
+func combineScores(scores []map[string]float64, weights []float64, agg string, inter bool) map[string]float64 {
+	res := make(map[string]float64)
+	for i, set := range scores {
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		for m, score := range set {
+			score *= w
+			if math.IsNaN(score) {
+				// 0 * inf: Redis treats the product as 0
+				score = 0
+			}
+			cur, exists := res[m]
+			if !exists {
+				if i > 0 && inter {
+					continue
+				}
+				res[m] = score
+				continue
+			}
+			switch agg {
+			case "MIN":
+				res[m] = math.Min(cur, score)
+			case "MAX":
+				res[m] = math.Max(cur, score)
+			default:
+				sum := cur + score
+				if math.IsNaN(sum) {
+					// inf + -inf
+					sum = 0
+				}
+				res[m] = sum
+			}
+		}
+		if inter && i > 0 {
+			for m := range res {
+				if _, ok := set[m]; !ok {
+					delete(res, m)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// storeZsetLocked replaces dst with a sorted set holding scores, deleting it
+// when scores is empty. Returns the number of stored members. Callers must
+// hold k.mu.
+func (k *Kv) storeZsetLocked(dst string, scores map[string]float64) int {
+	k.deleteLocked(dst)
+	if len(scores) == 0 {
+		return 0
+	}
+	z := NewSortedSet()
+	for m, score := range scores {
+		z.members[m] = score
+		z.index = append(z.index, zsetEntry{score: score, member: m})
+	}
+	sort.Slice(z.index, func(i, j int) bool { return entryLess(z.index[i], z.index[j]) })
+	k.zsets[dst] = z
+	n := z.Len()
+	k.wake(dst)
+	return n
+}
+
+// ZMPop: pop up to count members from the first non-empty sorted set among
+// keys, the lowest scores first when side is "MIN" and the highest when it
+// is "MAX". Returns the popped key, or an empty key when all are empty.
+func (k *Kv) ZMPop(keys []string, side string, count int) (string, []zsetEntry, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range keys {
+		if err := k.checkType(key, "zset"); err != nil {
+			return "", nil, err
+		}
+	}
+	for _, key := range keys {
+		if entries := k.zpopLocked(key, count, strings.EqualFold(side, "MAX")); len(entries) > 0 {
+			return key, entries, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// parseScoreBound parses a ZRANGEBYSCORE style bound: a score, optionally
+// prefixed by "(" to make it exclusive, or "-inf"/"+inf"
+func parseScoreBound(s string) (float64, bool, error) {
+	exclusive := false
+	if strings.HasPrefix(s, "(") {
+		exclusive = true
+		s = s[1:]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false, errors.New("min or max is not a float")
+	}
+	return f, exclusive, nil
+}
+
+// parseScoreRangeOpts parses the "[WITHSCORES] [LIMIT offset count]" options
+// of the *BYSCORE commands
+func parseScoreRangeOpts(args []string) (withScores bool, offset, count int, err error) {
+	count = -1
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "WITHSCORES"):
+			withScores = true
+		case strings.EqualFold(args[i], "LIMIT") && i+2 < len(args):
+			offset, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				return false, 0, 0, errors.New("value is not an integer or out of range")
+			}
+			count, err = strconv.Atoi(args[i+2])
+			if err != nil {
+				return false, 0, 0, errors.New("value is not an integer or out of range")
+			}
+			if offset < 0 {
+				// a negative offset selects nothing
+				count = 0
+				offset = 0
+			}
+			i += 2
+		default:
+			return false, 0, 0, errors.New("syntax error")
+		}
+	}
+	return withScores, offset, count, nil
+}
+
+// parseScore parses a sorted set score, accepting "inf", "+inf" and "-inf"
+func parseScore(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errors.New("value is not a valid float")
+	}
+	return f, nil
+}
+
+// zsetReply formats entries as an array of members, interleaved with their
+// scores when withScores is set
+func zsetReply(entries []zsetEntry, withScores bool) Array {
+	respArray := make(Array, 0, len(entries)*2)
+	for _, e := range entries {
+		respArray = append(respArray, BulkString(e.member))
+		if withScores {
+			respArray = append(respArray, Double(e.score))
+		}
+	}
+	return respArray
+}
+
+// Handlers for sorted set commands
+
+func zadd(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("ZADD requires at least three arguments")
+	}
+	var opts ZAddOpts
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		default:
+			break flags
+		}
+	}
+	if opts.NX && opts.XX {
+		return nil, errors.New("XX and NX options at the same time are not compatible")
+	}
+	if (opts.GT && opts.LT) || (opts.NX && (opts.GT || opts.LT)) {
+		return nil, errors.New("GT, LT, and/or NX options at the same time are not compatible")
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, errors.New("syntax error")
+	}
+	entries := make([]zsetEntry, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := parseScore(pairs[j])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, zsetEntry{score: score, member: pairs[j+1]})
+	}
+	n, err := kv.ZAdd(args[0], opts, entries...)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func zrange(args []string, kv *Kv) (RespValue, error) {
+	return zrangeCmd(args, kv, false)
+}
+
+func zrevrange(args []string, kv *Kv) (RespValue, error) {
+	return zrangeCmd(args, kv, true)
+}
+
+// zrangeCmd implements ZRANGE and ZREVRANGE
+func zrangeCmd(args []string, kv *Kv, rev bool) (RespValue, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	withScores := false
+	if len(args) == 4 {
+		if !strings.EqualFold(args[3], "WITHSCORES") {
+			return nil, errors.New("syntax error")
+		}
+		withScores = true
+	}
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errors.New("invalid start index")
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, errors.New("invalid stop index")
+	}
+	entries, err := kv.zrangeByRank(args[0], start, stop, rev)
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(entries, withScores), nil
+}
+
+func zrem(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("ZREM requires at least two arguments")
+	}
+	n, err := kv.ZRem(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func zcard(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 1 {
+		return nil, errors.New("ZCARD requires exactly one argument")
+	}
+	n, err := kv.ZCard(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func zscore(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 2 {
+		return nil, errors.New("ZSCORE requires exactly two arguments")
+	}
+	score, ok, err := kv.ZScore(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return Double(score), nil
+}
+
+func zrank(args []string, kv *Kv) (RespValue, error) {
+	return zrankCmd(args, kv, false)
+}
+
+func zrevrank(args []string, kv *Kv) (RespValue, error) {
+	return zrankCmd(args, kv, true)
+}
+
+// zrankCmd implements ZRANK and ZREVRANK, with the optional WITHSCORE flag
+func zrankCmd(args []string, kv *Kv, rev bool) (RespValue, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	withScore := false
+	if len(args) == 3 {
+		if !strings.EqualFold(args[2], "WITHSCORE") {
+			return nil, errors.New("syntax error")
+		}
+		withScore = true
+	}
+	rank, score, ok, err := kv.zrank(args[0], args[1], rev)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	if withScore {
+		return Array{integer(rank), Double(score)}, nil
+	}
+	return integer(rank), nil
+}
+
+func zincrby(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("ZINCRBY requires exactly three arguments")
+	}
+	delta, err := parseScore(args[1])
+	if err != nil {
+		return nil, err
+	}
+	score, err := kv.ZIncrBy(args[0], args[2], delta)
+	if err != nil {
+		return nil, err
+	}
+	return Double(score), nil
+}
+
+func zcount(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("ZCOUNT requires exactly three arguments")
+	}
+	min, minEx, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, maxEx, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	n, err := kv.ZCount(args[0], min, max, minEx, maxEx)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func zrangebyscore(args []string, kv *Kv) (RespValue, error) {
+	return zrangeByScoreCmd(args, kv, false)
+}
+
+func zrevrangebyscore(args []string, kv *Kv) (RespValue, error) {
+	return zrangeByScoreCmd(args, kv, true)
+}
+
+// zrangeByScoreCmd implements ZRANGEBYSCORE key min max and
+// ZREVRANGEBYSCORE key max min, which takes its bounds in reverse order
+func zrangeByScoreCmd(args []string, kv *Kv, rev bool) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	minArg, maxArg := args[1], args[2]
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	min, minEx, err := parseScoreBound(minArg)
+	if err != nil {
+		return nil, err
+	}
+	max, maxEx, err := parseScoreBound(maxArg)
+	if err != nil {
+		return nil, err
+	}
+	withScores, offset, count, err := parseScoreRangeOpts(args[3:])
+	if err != nil {
+		return nil, err
+	}
+	entries, err := kv.zrangeByScore(args[0], min, max, minEx, maxEx, rev, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(entries, withScores), nil
+}
+
+func zrangebylex(args []string, kv *Kv) (RespValue, error) {
+	return zrangeByLexCmd(args, kv, false)
+}
+
+func zrevrangebylex(args []string, kv *Kv) (RespValue, error) {
+	return zrangeByLexCmd(args, kv, true)
+}
+
+// zrangeByLexCmd implements ZRANGEBYLEX key min max and
+// ZREVRANGEBYLEX key max min
+func zrangeByLexCmd(args []string, kv *Kv, rev bool) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	minArg, maxArg := args[1], args[2]
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	min, err := parseLexBound(minArg)
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseLexBound(maxArg)
+	if err != nil {
+		return nil, err
+	}
+	withScores, offset, count, err := parseScoreRangeOpts(args[3:])
+	if err != nil || withScores {
+		return nil, errors.New("syntax error")
+	}
+	entries, err := kv.zrangeByLex(args[0], min, max, rev, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(entries, false), nil
+}
+
+func zlexcount(args []string, kv *Kv) (RespValue, error) {
+	if len(args) != 3 {
+		return nil, errors.New("ZLEXCOUNT requires exactly three arguments")
+	}
+	min, err := parseLexBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseLexBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	n, err := kv.ZLexCount(args[0], min, max)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func zpopmin(args []string, kv *Kv) (RespValue, error) {
+	return zpopCmd(args, kv, false)
+}
+
+func zpopmax(args []string, kv *Kv) (RespValue, error) {
+	return zpopCmd(args, kv, true)
+}
+
+// zpopCmd implements ZPOPMIN and ZPOPMAX, replying with a flat
+// member, score... array
+func zpopCmd(args []string, kv *Kv, max bool) (RespValue, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(args[1])
+		if err != nil || count < 0 {
+			return nil, errors.New("value is out of range, must be positive")
+		}
+	}
+	entries, err := kv.zpop(args[0], count, max)
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(entries, true), nil
+}
+
+func zunionstore(args []string, kv *Kv) (RespValue, error) {
+	return zsetAlgebraStoreCmd(args, kv.ZUnionStore)
+}
+
+func zinterstore(args []string, kv *Kv) (RespValue, error) {
+	return zsetAlgebraStoreCmd(args, kv.ZInterStore)
+}
+
+// zsetAlgebraStoreCmd implements ZUNIONSTORE and ZINTERSTORE:
+// destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func zsetAlgebraStoreCmd(args []string, op func(string, []string, []float64, string) (int, error)) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("wrong number of arguments")
+	}
+	keys, rest, err := parseNumKeys(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	var weights []float64
+	agg := "SUM"
+	for i := 0; i < len(rest); i++ {
+		switch strings.ToUpper(rest[i]) {
+		case "WEIGHTS":
+			if i+len(keys) >= len(rest) {
+				return nil, errors.New("syntax error")
+			}
+			weights = make([]float64, len(keys))
+			for j := range keys {
+				w, err := strconv.ParseFloat(rest[i+1+j], 64)
+				if err != nil || math.IsNaN(w) {
+					return nil, errors.New("weight value is not a float")
+				}
+				weights[j] = w
+			}
+			i += len(keys)
+		case "AGGREGATE":
+			if i+1 >= len(rest) {
+				return nil, errors.New("syntax error")
+			}
+			agg = strings.ToUpper(rest[i+1])
+			if agg != "SUM" && agg != "MIN" && agg != "MAX" {
+				return nil, errors.New("syntax error")
+			}
+			i++
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	n, err := op(args[0], keys, weights, agg)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func zdiffstore(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 3 {
+		return nil, errors.New("ZDIFFSTORE requires at least three arguments")
+	}
+	keys, rest, err := parseNumKeys(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("syntax error")
+	}
+	n, err := kv.ZDiffStore(args[0], keys)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func zintercard(args []string, kv *Kv) (RespValue, error) {
+	keys, rest, err := parseNumKeys(args)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := parseLimit(rest)
+	if err != nil {
+		return nil, err
+	}
+	n, err := kv.ZInterCard(keys, limit)
+	if err != nil {
+		return nil, err
+	}
+	return integer(n), nil
+}
+
+func zmscore(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("ZMSCORE requires at least two arguments")
+	}
+	scores, err := kv.ZMScore(args[0], args[1:])
+	if err != nil {
+		return nil, err
+	}
+	respArray := make(Array, len(scores))
+	for i, score := range scores {
+		if score != nil {
+			respArray[i] = Double(*score)
+		}
+	}
+	return respArray, nil
+}
+
+func zscan(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 2 {
+		return nil, errors.New("ZSCAN requires at least two arguments")
+	}
+	opts, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if opts.noValues || opts.typ != "" {
+		return nil, errors.New("syntax error")
+	}
+	next, pairs, err := kv.ZScan(args[0], opts.cursor, opts.match, opts.count)
+	if err != nil {
+		return nil, err
+	}
+	return scanReply(next, pairs), nil
+}
+
+// parseZMPop parses the "numkeys key [key ...] MIN|MAX [COUNT count]"
+// arguments shared by ZMPOP and BZMPOP
+func parseZMPop(args []string) (keys []string, side string, count int, err error) {
+	keys, rest, err := parseNumKeys(args)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if len(rest) == 0 {
+		return nil, "", 0, errors.New("syntax error")
+	}
+	side = strings.ToUpper(rest[0])
+	if side != "MIN" && side != "MAX" {
+		return nil, "", 0, errors.New("syntax error")
+	}
+	count = 1
+	if len(rest) > 1 {
+		if len(rest) != 3 || !strings.EqualFold(rest[1], "COUNT") {
+			return nil, "", 0, errors.New("syntax error")
+		}
+		count, err = strconv.Atoi(rest[2])
+		if err != nil || count <= 0 {
+			return nil, "", 0, errors.New("count should be greater than 0")
+		}
+	}
+	return keys, side, count, nil
+}
+
+// zmpopReply formats a multi-key pop result as [key, [[member, score]...]]
+func zmpopReply(key string, entries []zsetEntry) RespValue {
+	respArray := make(Array, len(entries))
+	for i, e := range entries {
+		respArray[i] = Array{BulkString(e.member), Double(e.score)}
+	}
+	return Array{BulkString(key), respArray}
+}
+
+func zmpop(args []string, kv *Kv) (RespValue, error) {
+	keys, side, count, err := parseZMPop(args)
+	if err != nil {
+		return nil, err
+	}
+	key, entries, err := kv.ZMPop(keys, side, count)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, nil
+	}
+	return zmpopReply(key, entries), nil
+}
+
+func bzmpop(args []string, kv *Kv) (RespValue, error) {
+	if len(args) < 1 {
+		return nil, errors.New("BZMPOP requires a timeout")
+	}
+	timeout, err := parseTimeout(args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys, side, count, err := parseZMPop(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return kv.block(keys, "zset", timeout, func(key string) (RespValue, bool, error) {
+		entries := kv.zpopLocked(key, count, side == "MAX")
+		if len(entries) == 0 {
+			return nil, false, nil
+		}
+		return zmpopReply(key, entries), true, nil
+	})
+}
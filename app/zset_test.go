@@ -0,0 +1,498 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// zsetMembers returns the members of entries in order.
+func zsetMembers(entries []zsetEntry) []string {
+	members := make([]string, len(entries))
+	for i, e := range entries {
+		members[i] = e.member
+	}
+	return members
+}
+
+func TestZAddZRange(t *testing.T) {
+	kv := NewKv()
+	n, err := kv.ZAdd("z", ZAddOpts{}, zsetEntry{3, "c"}, zsetEntry{1, "a"}, zsetEntry{2, "b"}, zsetEntry{2, "aa"})
+	if err != nil || n != 4 {
+		t.Fatalf("ZAdd = %d, %v; want 4", n, err)
+	}
+	got, _ := kv.ZRange("z", 0, -1)
+	if !equalStrings(zsetMembers(got), []string{"a", "aa", "b", "c"}) {
+		t.Fatalf("ZRange = %v", got)
+	}
+	// updating a score moves the member and is not counted as added
+	if n, _ := kv.ZAdd("z", ZAddOpts{}, zsetEntry{0, "c"}); n != 0 {
+		t.Fatalf("expected 0 added on update, got %d", n)
+	}
+	got, _ = kv.ZRange("z", 0, 1)
+	if !equalStrings(zsetMembers(got), []string{"c", "a"}) || got[0].score != 0 {
+		t.Fatalf("ZRange after update = %v", got)
+	}
+	if got, _ := kv.ZRange("z", -2, -1); !equalStrings(zsetMembers(got), []string{"aa", "b"}) {
+		t.Fatalf("ZRange with negative indices = %v", got)
+	}
+}
+
+func TestZAddFlags(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{5, "a"})
+	if n, _ := kv.ZAdd("z", ZAddOpts{NX: true}, zsetEntry{1, "a"}, zsetEntry{1, "b"}); n != 1 {
+		t.Fatalf("ZAdd NX = %d, want 1", n)
+	}
+	if n, _ := kv.ZAdd("z", ZAddOpts{XX: true}, zsetEntry{1, "c"}); n != 0 {
+		t.Fatalf("ZAdd XX on new member = %d, want 0", n)
+	}
+	if n, _ := kv.ZAdd("z", ZAddOpts{GT: true, CH: true}, zsetEntry{3, "a"}, zsetEntry{9, "b"}); n != 1 {
+		t.Fatalf("ZAdd GT CH = %d, want 1", n)
+	}
+	got, _ := kv.ZRange("z", 0, -1)
+	if len(got) != 2 || got[0] != (zsetEntry{5, "a"}) || got[1] != (zsetEntry{9, "b"}) {
+		t.Fatalf("ZRange after flags = %v", got)
+	}
+}
+
+func TestZRemZCard(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1, "a"}, zsetEntry{2, "b"})
+	if n, _ := kv.ZRem("z", "a", "zz"); n != 1 {
+		t.Fatalf("ZRem = %d, want 1", n)
+	}
+	if n, _ := kv.ZCard("z"); n != 1 {
+		t.Fatalf("ZCard = %d, want 1", n)
+	}
+	kv.ZRem("z", "b")
+	if _, ok := kv.zsets["z"]; ok {
+		t.Fatalf("expected empty sorted set to be deleted")
+	}
+	kv.SAdd("s", "a")
+	if _, err := kv.ZAdd("s", ZAddOpts{}, zsetEntry{1, "a"}); !errors.Is(err, errWrongType) {
+		t.Fatalf("expected WRONGTYPE, got %v", err)
+	}
+}
+
+func TestZRangeWithScoresReply(t *testing.T) {
+	kv := NewKv()
+	if _, err := zadd([]string{"z", "1.5", "a", "2", "b"}, kv); err != nil {
+		t.Fatalf("ZADD error: %v", err)
+	}
+	resp, err := zrange([]string{"z", "0", "-1", "WITHSCORES"}, kv)
+	if err != nil {
+		t.Fatalf("ZRANGE error: %v", err)
+	}
+	want := Array{BulkString("a"), Double(1.5), BulkString("b"), Double(2)}
+	arr := resp.(Array)
+	if len(arr) != len(want) {
+		t.Fatalf("ZRANGE WITHSCORES = %v, want %v", arr, want)
+	}
+	for i := range want {
+		if arr[i] != want[i] {
+			t.Fatalf("ZRANGE WITHSCORES = %v, want %v", arr, want)
+		}
+	}
+}
+
+func TestZScoreZRank(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{10, "a"}, zsetEntry{20, "b"}, zsetEntry{30, "c"})
+	if score, ok, _ := kv.ZScore("z", "b"); !ok || score != 20 {
+		t.Fatalf("ZScore = %v, %v; want 20", score, ok)
+	}
+	if _, ok, _ := kv.ZScore("z", "zz"); ok {
+		t.Fatalf("expected missing member to have no score")
+	}
+	if rank, ok, _ := kv.ZRank("z", "c"); !ok || rank != 2 {
+		t.Fatalf("ZRank c = %d, %v; want 2", rank, ok)
+	}
+	if rank, ok, _ := kv.ZRevRank("z", "c"); !ok || rank != 0 {
+		t.Fatalf("ZRevRank c = %d, %v; want 0", rank, ok)
+	}
+	// ranks follow mutations
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{5, "c"})
+	if rank, _, _ := kv.ZRank("z", "c"); rank != 0 {
+		t.Fatalf("ZRank c after update = %d, want 0", rank)
+	}
+	if _, ok, _ := kv.ZRank("missing", "a"); ok {
+		t.Fatalf("expected no rank for missing key")
+	}
+	resp, _ := zrevrank([]string{"z", "a", "WITHSCORE"}, kv)
+	if arr := resp.(Array); arr[0] != integer(1) || arr[1] != Double(10) {
+		t.Fatalf("ZREVRANK WITHSCORE = %v", resp)
+	}
+}
+
+func TestZIncrBy(t *testing.T) {
+	kv := NewKv()
+	if score, err := kv.ZIncrBy("z", "a", 2.5); err != nil || score != 2.5 {
+		t.Fatalf("ZIncrBy on new member = %v, %v; want 2.5", score, err)
+	}
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{5, "b"}, zsetEntry{10, "c"})
+	if score, _ := kv.ZIncrBy("z", "a", 10); score != 12.5 {
+		t.Fatalf("ZIncrBy on existing member = %v, want 12.5", score)
+	}
+	got, _ := kv.ZRange("z", 0, -1)
+	if !equalStrings(zsetMembers(got), []string{"b", "c", "a"}) {
+		t.Fatalf("rank order after ZIncrBy = %v", got)
+	}
+	kv.ZIncrBy("z", "a", -20)
+	got, _ = kv.ZRange("z", 0, -1)
+	if !equalStrings(zsetMembers(got), []string{"a", "b", "c"}) {
+		t.Fatalf("rank order after negative ZIncrBy = %v", got)
+	}
+}
+
+func TestParseScoreBound(t *testing.T) {
+	cases := []struct {
+		in        string
+		want      float64
+		exclusive bool
+		err       bool
+	}{
+		{"1.5", 1.5, false, false},
+		{"(1.5", 1.5, true, false},
+		{"-inf", math.Inf(-1), false, false},
+		{"+inf", math.Inf(1), false, false},
+		{"(+inf", math.Inf(1), true, false},
+		{"(", 0, false, true},
+		{"abc", 0, false, true},
+	}
+	for _, c := range cases {
+		got, ex, err := parseScoreBound(c.in)
+		if (err != nil) != c.err {
+			t.Fatalf("parseScoreBound(%q) error = %v, want error %v", c.in, err, c.err)
+		}
+		if err == nil && (got != c.want || ex != c.exclusive) {
+			t.Fatalf("parseScoreBound(%q) = %v, %v; want %v, %v", c.in, got, ex, c.want, c.exclusive)
+		}
+	}
+}
+
+func TestZCountZRangeByScore(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1, "a"}, zsetEntry{2, "b"}, zsetEntry{2, "c"}, zsetEntry{3, "d"}, zsetEntry{5, "e"})
+	inf := math.Inf(1)
+	if n, _ := kv.ZCount("z", 2, 3, false, false); n != 3 {
+		t.Fatalf("ZCount [2,3] = %d, want 3", n)
+	}
+	if n, _ := kv.ZCount("z", 2, 3, true, false); n != 1 {
+		t.Fatalf("ZCount (2,3] = %d, want 1", n)
+	}
+	if n, _ := kv.ZCount("z", -inf, inf, false, false); n != 5 {
+		t.Fatalf("ZCount [-inf,+inf] = %d, want 5", n)
+	}
+	if n, _ := kv.ZCount("z", 3, 2, false, false); n != 0 {
+		t.Fatalf("ZCount with min > max = %d, want 0", n)
+	}
+	got, _ := kv.ZRangeByScore("z", 2, inf, false, false, 0, -1)
+	if !equalStrings(zsetMembers(got), []string{"b", "c", "d", "e"}) {
+		t.Fatalf("ZRangeByScore [2,+inf] = %v", got)
+	}
+	got, _ = kv.ZRangeByScore("z", 2, inf, false, true, 1, 2)
+	if !equalStrings(zsetMembers(got), []string{"c", "d"}) {
+		t.Fatalf("ZRangeByScore LIMIT 1 2 = %v", got)
+	}
+	resp, err := zrangebyscore([]string{"z", "(1", "2", "WITHSCORES"}, kv)
+	if err != nil {
+		t.Fatalf("ZRANGEBYSCORE error: %v", err)
+	}
+	if arr := resp.(Array); len(arr) != 4 || arr[0] != BulkString("b") || arr[1] != Double(2) {
+		t.Fatalf("ZRANGEBYSCORE WITHSCORES = %v", resp)
+	}
+}
+
+func TestZRevRange(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1, "a"}, zsetEntry{2, "b"}, zsetEntry{3, "c"}, zsetEntry{4, "d"})
+	if got, _ := kv.ZRevRange("z", 0, -1); !equalStrings(zsetMembers(got), []string{"d", "c", "b", "a"}) {
+		t.Fatalf("ZRevRange 0 -1 = %v", got)
+	}
+	if got, _ := kv.ZRevRange("z", 1, 2); !equalStrings(zsetMembers(got), []string{"c", "b"}) {
+		t.Fatalf("ZRevRange 1 2 = %v", got)
+	}
+	if got, _ := kv.ZRevRange("z", -1, -1); !equalStrings(zsetMembers(got), []string{"a"}) {
+		t.Fatalf("ZRevRange -1 -1 = %v", got)
+	}
+}
+
+func TestZRevRangeByScore(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1, "a"}, zsetEntry{2, "b"}, zsetEntry{3, "c"}, zsetEntry{4, "d"}, zsetEntry{5, "e"})
+	// max comes before min
+	resp, err := zrevrangebyscore([]string{"z", "4", "(1"}, kv)
+	if err != nil {
+		t.Fatalf("ZREVRANGEBYSCORE error: %v", err)
+	}
+	want := Array{BulkString("d"), BulkString("c"), BulkString("b")}
+	arr := resp.(Array)
+	if len(arr) != len(want) {
+		t.Fatalf("ZREVRANGEBYSCORE 4 (1 = %v, want %v", arr, want)
+	}
+	for i := range want {
+		if arr[i] != want[i] {
+			t.Fatalf("ZREVRANGEBYSCORE 4 (1 = %v, want %v", arr, want)
+		}
+	}
+	// min before max selects nothing
+	if resp, _ := zrevrangebyscore([]string{"z", "1", "4"}, kv); len(resp.(Array)) != 0 {
+		t.Fatalf("expected empty result with swapped bounds, got %v", resp)
+	}
+	// LIMIT offsets apply in descending order
+	got, _ := kv.ZRevRangeByScore("z", 2, 5, false, false, 1, 2)
+	if !equalStrings(zsetMembers(got), []string{"d", "c"}) {
+		t.Fatalf("ZRevRangeByScore LIMIT 1 2 = %v", got)
+	}
+	got, _ = kv.ZRevRangeByScore("z", 2, 5, false, false, 3, 5)
+	if !equalStrings(zsetMembers(got), []string{"b"}) {
+		t.Fatalf("ZRevRangeByScore LIMIT 3 5 = %v", got)
+	}
+	got, _ = kv.ZRangeByScore("z", 2, 5, false, false, 3, 5)
+	if !equalStrings(zsetMembers(got), []string{"e"}) {
+		t.Fatalf("ZRangeByScore LIMIT 3 5 = %v", got)
+	}
+	got, _ = kv.ZRangeByScore("z", 2, 5, false, false, 1, math.MaxInt)
+	if !equalStrings(zsetMembers(got), []string{"c", "d", "e"}) {
+		t.Fatalf("ZRangeByScore LIMIT 1 MaxInt = %v", got)
+	}
+}
+
+func TestZRangeByLex(t *testing.T) {
+	kv := NewKv()
+	for _, m := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		kv.ZAdd("z", ZAddOpts{}, zsetEntry{0, m})
+	}
+	bound := func(s string) lexBound {
+		b, err := parseLexBound(s)
+		if err != nil {
+			t.Fatalf("parseLexBound(%q) error: %v", s, err)
+		}
+		return b
+	}
+	cases := []struct {
+		min, max string
+		want     []string
+	}{
+		{"-", "+", []string{"a", "b", "c", "d", "e", "f", "g"}},
+		{"-", "[c", []string{"a", "b", "c"}},
+		{"-", "(c", []string{"a", "b"}},
+		{"[aaa", "(g", []string{"b", "c", "d", "e", "f"}},
+		{"(b", "[d", []string{"c", "d"}},
+		{"+", "-", nil},
+	}
+	for _, c := range cases {
+		got, _ := kv.ZRangeByLex("z", bound(c.min), bound(c.max), 0, -1)
+		if !equalStrings(zsetMembers(got), c.want) {
+			t.Fatalf("ZRangeByLex %s %s = %v, want %v", c.min, c.max, zsetMembers(got), c.want)
+		}
+		if n, _ := kv.ZLexCount("z", bound(c.min), bound(c.max)); n != len(c.want) {
+			t.Fatalf("ZLexCount %s %s = %d, want %d", c.min, c.max, n, len(c.want))
+		}
+	}
+	got, _ := kv.ZRevRangeByLex("z", bound("[b"), bound("[f"), 1, 2)
+	if !equalStrings(zsetMembers(got), []string{"e", "d"}) {
+		t.Fatalf("ZRevRangeByLex LIMIT 1 2 = %v", zsetMembers(got))
+	}
+	if _, err := parseLexBound("c"); err == nil {
+		t.Fatalf("expected error for bound without [ or ( prefix")
+	}
+}
+
+func TestZPopMinMax(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1, "a"}, zsetEntry{2, "b"}, zsetEntry{3, "c"}, zsetEntry{4, "d"})
+	got, err := kv.ZPopMin("z", 1)
+	if err != nil || len(got) != 1 || got[0] != (zsetEntry{1, "a"}) {
+		t.Fatalf("ZPopMin = %v, %v; want [{1 a}]", got, err)
+	}
+	got, _ = kv.ZPopMax("z", 2)
+	if !equalStrings(zsetMembers(got), []string{"d", "c"}) {
+		t.Fatalf("ZPopMax 2 = %v", got)
+	}
+	got, _ = kv.ZPopMax("z", 10)
+	if !equalStrings(zsetMembers(got), []string{"b"}) {
+		t.Fatalf("ZPopMax with count larger than the set = %v", got)
+	}
+	if _, ok := kv.zsets["z"]; ok {
+		t.Fatalf("expected emptied sorted set to be deleted")
+	}
+	resp, err := zpopmin([]string{"z"}, kv)
+	if err != nil || len(resp.(Array)) != 0 {
+		t.Fatalf("ZPOPMIN on empty set = %v, %v; want empty array", resp, err)
+	}
+
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1.5, "a"}, zsetEntry{2, "b"})
+	resp, _ = zpopmin([]string{"z"}, kv)
+	if arr := resp.(Array); len(arr) != 2 || arr[0] != BulkString("a") || arr[1] != Double(1.5) {
+		t.Fatalf("ZPOPMIN reply = %v", resp)
+	}
+}
+
+func TestZUnionStore(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("a", ZAddOpts{}, zsetEntry{1, "x"}, zsetEntry{2, "y"})
+	kv.ZAdd("b", ZAddOpts{}, zsetEntry{10, "y"}, zsetEntry{20, "z"})
+	cases := []struct {
+		weights []float64
+		agg     string
+		want    []zsetEntry
+	}{
+		{nil, "SUM", []zsetEntry{{1, "x"}, {12, "y"}, {20, "z"}}},
+		{nil, "MIN", []zsetEntry{{1, "x"}, {2, "y"}, {20, "z"}}},
+		{nil, "MAX", []zsetEntry{{1, "x"}, {10, "y"}, {20, "z"}}},
+		{[]float64{2, 0.5}, "SUM", []zsetEntry{{2, "x"}, {9, "y"}, {10, "z"}}},
+		{[]float64{-1, 1}, "MAX", []zsetEntry{{-1, "x"}, {10, "y"}, {20, "z"}}},
+	}
+	for _, c := range cases {
+		n, err := kv.ZUnionStore("dst", []string{"a", "b"}, c.weights, c.agg)
+		if err != nil || n != len(c.want) {
+			t.Fatalf("ZUnionStore %v %s = %d, %v; want %d", c.weights, c.agg, n, err, len(c.want))
+		}
+		got, _ := kv.ZRange("dst", 0, -1)
+		for i := range c.want {
+			if got[i] != c.want[i] {
+				t.Fatalf("ZUnionStore %v %s stored %v, want %v", c.weights, c.agg, got, c.want)
+			}
+		}
+	}
+}
+
+func TestZInterStore(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("a", ZAddOpts{}, zsetEntry{1, "x"}, zsetEntry{2, "y"}, zsetEntry{3, "z"})
+	kv.ZAdd("b", ZAddOpts{}, zsetEntry{10, "y"}, zsetEntry{20, "z"})
+	kv.SAdd("s", "z")
+	n, err := kv.ZInterStore("dst", []string{"a", "b"}, []float64{1, 2}, "SUM")
+	if err != nil || n != 2 {
+		t.Fatalf("ZInterStore = %d, %v; want 2", n, err)
+	}
+	got, _ := kv.ZRange("dst", 0, -1)
+	if len(got) != 2 || got[0] != (zsetEntry{22, "y"}) || got[1] != (zsetEntry{43, "z"}) {
+		t.Fatalf("ZInterStore stored %v", got)
+	}
+	// plain sets take part with a score of 1
+	kv.ZInterStore("dst", []string{"a", "s"}, nil, "MAX")
+	if got, _ := kv.ZRange("dst", 0, -1); len(got) != 1 || got[0] != (zsetEntry{3, "z"}) {
+		t.Fatalf("ZInterStore with a set stored %v", got)
+	}
+	if n, _ := kv.ZInterStore("dst", []string{"a", "missing"}, nil, "SUM"); n != 0 {
+		t.Fatalf("ZInterStore with missing key = %d, want 0", n)
+	}
+	if _, ok := kv.zsets["dst"]; ok {
+		t.Fatalf("expected empty result to delete the destination")
+	}
+	resp, err := zinterstore([]string{"dst", "2", "a", "b", "WEIGHTS", "1", "1", "AGGREGATE", "min"}, kv)
+	if err != nil || resp != integer(2) {
+		t.Fatalf("ZINTERSTORE reply = %v, %v; want 2", resp, err)
+	}
+	if _, err := zunionstore([]string{"dst", "2", "a", "b", "WEIGHTS", "1"}, kv); err == nil {
+		t.Fatalf("expected syntax error with too few weights")
+	}
+}
+
+func TestZDiffStore(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("level1", ZAddOpts{}, zsetEntry{10, "ann"}, zsetEntry{20, "bob"}, zsetEntry{30, "cid"})
+	kv.ZAdd("level2", ZAddOpts{}, zsetEntry{99, "bob"})
+	n, err := kv.ZDiffStore("dst", []string{"level1", "level2", "missing"})
+	if err != nil || n != 2 {
+		t.Fatalf("ZDiffStore = %d, %v; want 2", n, err)
+	}
+	got, _ := kv.ZRange("dst", 0, -1)
+	if len(got) != 2 || got[0] != (zsetEntry{10, "ann"}) || got[1] != (zsetEntry{30, "cid"}) {
+		t.Fatalf("ZDiffStore stored %v", got)
+	}
+	if n, _ := kv.ZDiffStore("dst", []string{"missing", "level1"}); n != 0 {
+		t.Fatalf("ZDiffStore of missing key = %d, want 0", n)
+	}
+}
+
+func TestZMScore(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("z", ZAddOpts{}, zsetEntry{1, "a"}, zsetEntry{2.5, "b"})
+	scores, err := kv.ZMScore("z", []string{"b", "missing", "a"})
+	if err != nil {
+		t.Fatalf("ZMScore error: %v", err)
+	}
+	if len(scores) != 3 || scores[0] == nil || *scores[0] != 2.5 || scores[1] != nil || scores[2] == nil || *scores[2] != 1 {
+		t.Fatalf("ZMScore = %v", scores)
+	}
+	resp, _ := zmscore([]string{"z", "a", "nope"}, kv)
+	if arr := resp.(Array); len(arr) != 2 || arr[0] != Double(1) || arr[1] != nil {
+		t.Fatalf("ZMSCORE reply = %v", resp)
+	}
+}
+
+func TestZScanFullIteration(t *testing.T) {
+	kv := NewKv()
+	for i := 0; i < 17; i++ {
+		kv.ZAdd("z", ZAddOpts{}, zsetEntry{float64(i), "m" + strconv.Itoa(i)})
+	}
+	seen := make(map[string]int)
+	cursor, calls := 0, 0
+	for {
+		next, pairs, err := kv.ZScan("z", cursor, "", 2)
+		if err != nil {
+			t.Fatalf("ZScan error: %v", err)
+		}
+		for i := 0; i < len(pairs); i += 2 {
+			seen[pairs[i]]++
+			if pairs[i] != "m"+pairs[i+1] {
+				t.Fatalf("member %q paired with wrong score %q", pairs[i], pairs[i+1])
+			}
+		}
+		calls++
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 17 || calls != 9 {
+		t.Fatalf("expected 17 members over 9 calls, got %d over %d", len(seen), calls)
+	}
+	for m, n := range seen {
+		if n != 1 {
+			t.Fatalf("member %q returned %d times", m, n)
+		}
+	}
+}
+
+func TestZMPop(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("b", ZAddOpts{}, zsetEntry{1, "x"}, zsetEntry{2, "y"}, zsetEntry{3, "z"})
+	key, got, err := kv.ZMPop([]string{"a", "b"}, "MAX", 2)
+	if err != nil || key != "b" || !equalStrings(zsetMembers(got), []string{"z", "y"}) {
+		t.Fatalf("ZMPop MAX 2 = %q %v, %v", key, got, err)
+	}
+	resp, _ := zmpop([]string{"2", "a", "b", "MIN"}, kv)
+	arr := resp.(Array)
+	pair := arr[1].(Array)[0].(Array)
+	if arr[0] != BulkString("b") || pair[0] != BulkString("x") || pair[1] != Double(1) {
+		t.Fatalf("ZMPOP reply = %v", resp)
+	}
+	if resp, _ := zmpop([]string{"2", "a", "b", "MIN"}, kv); resp != nil {
+		t.Fatalf("expected nil when all sorted sets are empty, got %v", resp)
+	}
+}
+
+func TestZInterCard(t *testing.T) {
+	kv := NewKv()
+	kv.ZAdd("a", ZAddOpts{}, zsetEntry{1, "x"}, zsetEntry{2, "y"}, zsetEntry{3, "z"})
+	kv.ZAdd("b", ZAddOpts{}, zsetEntry{5, "y"}, zsetEntry{6, "z"}, zsetEntry{7, "w"})
+	if n, err := kv.ZInterCard([]string{"a", "b"}, 0); err != nil || n != 2 {
+		t.Fatalf("ZInterCard = %d, %v; want 2", n, err)
+	}
+	if n, _ := kv.ZInterCard([]string{"a", "b"}, 1); n != 1 {
+		t.Fatalf("ZInterCard with LIMIT 1 = %d, want 1", n)
+	}
+	if n, _ := kv.ZInterCard([]string{"a", "missing"}, 0); n != 0 {
+		t.Fatalf("ZInterCard with missing key = %d, want 0", n)
+	}
+	resp, err := zintercard([]string{"2", "a", "b", "LIMIT", "5"}, kv)
+	if err != nil || resp != integer(2) {
+		t.Fatalf("ZINTERCARD reply = %v, %v; want 2", resp, err)
+	}
+}